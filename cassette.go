@@ -0,0 +1,392 @@
+package req
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrCassetteNoMatch is returned when a request is replayed from a cassette
+// and no interaction of the cassette matches it.
+var ErrCassetteNoMatch = errors.New("req: no interaction of the cassette matches the request")
+
+// CassetteMode is the mode of a Cassette.
+type CassetteMode uint8
+
+// The modes of a Cassette.
+const (
+	// CassetteRecordOnce records the interactions if the cassette file does
+	// not exist yet, and replays them otherwise. Delete the file to record
+	// again.
+	CassetteRecordOnce CassetteMode = iota
+	// CassetteReplayOnly replays the interactions of the cassette file and
+	// never sends the requests to the network, it is an error if the file
+	// does not exist.
+	CassetteReplayOnly
+	// CassettePassthrough sends the requests to the network, without
+	// recording nor replaying them.
+	CassettePassthrough
+)
+
+// CassetteRequest is a request recorded in a cassette.
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	// BodyEncoding is "base64" if Body is base64 encoded because the body
+	// is not valid UTF-8.
+	BodyEncoding string `json:"body_encoding,omitempty"`
+}
+
+// CassetteResponse is a response recorded in a cassette.
+type CassetteResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Proto        string      `json:"proto"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// CassetteInteraction is a request and its response recorded in a
+// cassette.
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteMatcher reports whether the recorded request matches the request
+// being sent. Both requests are redacted, see CassetteOptions.
+type CassetteMatcher func(r, recorded *CassetteRequest) bool
+
+// MatchMethod matches the requests with the same method.
+func MatchMethod(r, recorded *CassetteRequest) bool {
+	return r.Method == recorded.Method
+}
+
+// MatchURL matches the requests with the same URL, including the query.
+func MatchURL(r, recorded *CassetteRequest) bool {
+	return r.URL == recorded.URL
+}
+
+// MatchBody matches the requests with the same body.
+func MatchBody(r, recorded *CassetteRequest) bool {
+	return r.Body == recorded.Body && r.BodyEncoding == recorded.BodyEncoding
+}
+
+// MatchHeaders returns a CassetteMatcher which matches the requests with
+// the same values of the specified headers.
+func MatchHeaders(names ...string) CassetteMatcher {
+	return func(r, recorded *CassetteRequest) bool {
+		for _, name := range names {
+			if !slices.Equal(r.Header.Values(name), recorded.Header.Values(name)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// CassetteOptions is the options of a Cassette.
+type CassetteOptions struct {
+	// Mode is the mode of the cassette, CassetteRecordOnce by default.
+	Mode CassetteMode
+
+	// Matchers are the matchers a recorded request must all satisfy to be
+	// replayed, MatchMethod and MatchURL by default.
+	Matchers []CassetteMatcher
+
+	// RedactHeaders are the headers whose values are replaced with
+	// "REDACTED" before the interactions are saved, Authorization,
+	// Proxy-Authorization, Cookie and Set-Cookie by default. Set it to an
+	// empty slice to redact no headers.
+	RedactHeaders []string
+
+	// Redact, if not nil, is called once to remove the secrets of an
+	// interaction before it is saved, after RedactHeaders are redacted.
+	// When replaying, it is called with the request being sent and an
+	// empty response before the matching, so that the redacted requests
+	// still match.
+	Redact func(i *CassetteInteraction)
+}
+
+var defaultCassetteRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Cassette records the interactions of a Client or a Transport with the
+// servers to a file, and replays them without network for deterministic
+// tests, see Client.EnableRecording. It is safe for concurrent use.
+//
+// The response bodies are read entirely when recorded, and the requests
+// which fail without response are not recorded.
+type Cassette struct {
+	filename      string
+	mode          CassetteMode
+	matchers      []CassetteMatcher
+	redactHeaders []string
+	redact        func(i *CassetteInteraction)
+
+	mu           sync.Mutex
+	recording    bool
+	interactions []*CassetteInteraction
+	replayed     []bool
+}
+
+type cassetteFile struct {
+	Version      int                    `json:"version"`
+	Interactions []*CassetteInteraction `json:"interactions"`
+}
+
+// NewCassette returns a Cassette of the file, with specified options, nil
+// for the defaults. The file is usually in the testdata directory of the
+// tests.
+func NewCassette(filename string, opts *CassetteOptions) (*Cassette, error) {
+	if opts == nil {
+		opts = &CassetteOptions{}
+	}
+	c := &Cassette{
+		filename:      filename,
+		mode:          opts.Mode,
+		matchers:      opts.Matchers,
+		redactHeaders: opts.RedactHeaders,
+		redact:        opts.Redact,
+	}
+	if c.matchers == nil {
+		c.matchers = []CassetteMatcher{MatchMethod, MatchURL}
+	}
+	if c.redactHeaders == nil {
+		c.redactHeaders = defaultCassetteRedactHeaders
+	}
+	if c.mode == CassettePassthrough {
+		return c, nil
+	}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) && c.mode == CassetteRecordOnce {
+		c.recording = true
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f cassetteFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", filename, err)
+	}
+	c.interactions = f.Interactions
+	c.replayed = make([]bool, len(f.Interactions))
+	return c, nil
+}
+
+// Recording reports whether the cassette records the interactions rather
+// than replays them.
+func (c *Cassette) Recording() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recording
+}
+
+// Interactions returns the interactions of the cassette.
+func (c *Cassette) Interactions() []*CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.interactions)
+}
+
+// Save writes the interactions to the file of the cassette, it is called
+// after each recorded interaction.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(&cassetteFile{Version: 1, Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.filename); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(c.filename, append(data, '\n'), 0o644)
+}
+
+func (c *Cassette) roundTrip(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if c.mode == CassettePassthrough {
+		return next(req)
+	}
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	i := &CassetteInteraction{Request: CassetteRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+	}}
+	i.Request.Body, i.Request.BodyEncoding = cassetteBody(body)
+
+	c.mu.Lock()
+	recording := c.recording
+	c.mu.Unlock()
+	if !recording {
+		c.redactInteraction(i)
+		return c.replay(req, &i.Request)
+	}
+
+	resp, err := next(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	i.Response = CassetteResponse{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header.Clone(),
+	}
+	i.Response.Body, i.Response.BodyEncoding = cassetteBody(respBody)
+	c.redactInteraction(i)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, i)
+	c.replayed = append(c.replayed, true)
+	if err := c.save(); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to save cassette %s: %w", c.filename, err)
+	}
+	return resp, nil
+}
+
+// replay returns the response of the first interaction matching r which
+// is not replayed yet, or of the last matching one if all of them are
+// replayed, so that the same requests get the responses in the order they
+// were recorded.
+func (c *Cassette) replay(req *http.Request, r *CassetteRequest) (*http.Response, error) {
+	c.mu.Lock()
+	var found *CassetteInteraction
+	for idx, i := range c.interactions {
+		if !c.match(r, &i.Request) {
+			continue
+		}
+		found = i
+		if !c.replayed[idx] {
+			c.replayed[idx] = true
+			break
+		}
+	}
+	c.mu.Unlock()
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrCassetteNoMatch, req.Method, r.URL)
+	}
+
+	body, err := cassetteBodyBytes(found.Response.Body, found.Response.BodyEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", c.filename, err)
+	}
+	resp := &http.Response{
+		Status:        strconv.Itoa(found.Response.StatusCode) + " " + http.StatusText(found.Response.StatusCode),
+		StatusCode:    found.Response.StatusCode,
+		Proto:         found.Response.Proto,
+		Header:        found.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	var ok bool
+	if resp.ProtoMajor, resp.ProtoMinor, ok = http.ParseHTTPVersion(resp.Proto); !ok {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	return resp, nil
+}
+
+func (c *Cassette) match(r, recorded *CassetteRequest) bool {
+	for _, m := range c.matchers {
+		if !m(r, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cassette) redactInteraction(i *CassetteInteraction) {
+	for _, name := range c.redactHeaders {
+		for _, h := range []http.Header{i.Request.Header, i.Response.Header} {
+			if values := h.Values(name); len(values) > 0 {
+				h.Set(name, "REDACTED")
+			}
+		}
+	}
+	if c.redact != nil {
+		c.redact(i)
+	}
+}
+
+// cassetteBody returns the body as recorded, base64 encoded if it is not
+// valid UTF-8.
+func cassetteBody(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func cassetteBodyBytes(text, encoding string) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "":
+		return []byte(text), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(text)
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+}
+
+// SetCassette set the Cassette which records and replays the requests of
+// the transport, nil to disable it.
+func (t *Transport) SetCassette(c *Cassette) *Transport {
+	t.cassette = c
+	return t
+}
+
+// GetCassette returns the Cassette of the transport, nil if it is
+// disabled.
+func (t *Transport) GetCassette() *Cassette {
+	return t.cassette
+}
+
+// roundTripCassette is the innermost round trip of the transport, which
+// goes through the cassette if any.
+func (t *Transport) roundTripCassette(req *http.Request) (*http.Response, error) {
+	if t.cassette != nil {
+		return t.cassette.roundTrip(req, t.roundTrip)
+	}
+	return t.roundTrip(req)
+}
@@ -0,0 +1,114 @@
+package req
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+func TestCassetteRecordOnce(t *testing.T) {
+	cassetteHits.Store(0)
+	filename := filepath.Join(t.TempDir(), "cassettes", "test.json")
+
+	c := tc().EnableRecording(filename)
+	tests.AssertEqual(t, true, c.GetCassette().Recording())
+	resp, err := c.R().SetBearerAuthToken("secret").Get("/cassette/get")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "GET  1", resp.String())
+	resp, err = c.R().SetBody("hello").Post("/cassette/post")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "POST hello 2", resp.String())
+	resp, err = c.R().Get("/cassette/get")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "GET  3", resp.String())
+	resp, err = c.R().Get("/cassette/binary")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, []byte{0xff, 0x00}, resp.Bytes())
+	resp, err = c.R().Get("/cassette/login")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "session=secret", resp.GetHeader("Set-Cookie"))
+
+	data, err := os.ReadFile(filename)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, false, strings.Contains(string(data), "secret"))
+	tests.AssertContains(t, string(data), `"redacted"`, true)
+
+	// Replayed without network, in the order they were recorded.
+	c = tc().EnableRecording(filename)
+	tests.AssertEqual(t, false, c.GetCassette().Recording())
+	for _, want := range []string{"GET  1", "GET  3", "GET  3"} {
+		resp, err = c.R().Get("/cassette/get")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, want, resp.String())
+	}
+	resp, err = c.R().SetBody("other").Post("/cassette/post")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "POST hello 2", resp.String())
+	tests.AssertEqual(t, "2", resp.GetHeader("X-Hit"))
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+	resp, err = c.R().Get("/cassette/binary")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, []byte{0xff, 0x00}, resp.Bytes())
+	tests.AssertEqual(t, int32(5), cassetteHits.Load())
+
+	_, err = c.R().Get("/cassette/missing")
+	if !errors.Is(err, ErrCassetteNoMatch) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCassetteOptions(t *testing.T) {
+	cassetteHits.Store(0)
+	filename := filepath.Join(t.TempDir(), "test.json")
+
+	_, err := NewCassette(filename, &CassetteOptions{Mode: CassetteReplayOnly})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var redactions int
+	opts := &CassetteOptions{
+		Matchers:      []CassetteMatcher{MatchMethod, MatchURL, MatchBody, MatchHeaders("X-Version")},
+		RedactHeaders: []string{},
+		Redact: func(i *CassetteInteraction) {
+			redactions++
+			i.Request.URL = strings.ReplaceAll(i.Request.URL, "key=secret", "key=REDACTED")
+		},
+	}
+	cassette, err := NewCassette(filename, opts)
+	tests.AssertNoError(t, err)
+	c := tc().SetCassette(cassette)
+	for _, version := range []string{"1", "2"} {
+		resp, err := c.R().SetHeader("X-Version", version).SetBody(version).Post("/cassette/post?key=secret")
+		assertSuccess(t, resp, err)
+	}
+	tests.AssertEqual(t, 2, len(cassette.Interactions()))
+	tests.AssertEqual(t, 2, redactions)
+	tests.AssertEqual(t, getTestServerURL()+"/cassette/post?key=REDACTED", cassette.Interactions()[0].Request.URL)
+
+	opts.Mode = CassetteReplayOnly
+	cassette, err = NewCassette(filename, opts)
+	tests.AssertNoError(t, err)
+	c.SetCassette(cassette)
+	resp, err := c.R().SetHeader("X-Version", "2").SetBody("2").Post("/cassette/post?key=secret")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "POST 2 2", resp.String())
+	_, err = c.R().SetHeader("X-Version", "2").SetBody("1").Post("/cassette/post?key=secret")
+	if !errors.Is(err, ErrCassetteNoMatch) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests.AssertEqual(t, int32(2), cassetteHits.Load())
+
+	opts.Mode = CassettePassthrough
+	cassette, err = NewCassette(filename, opts)
+	tests.AssertNoError(t, err)
+	c.SetCassette(cassette)
+	resp, err = c.R().SetBody("1").Post("/cassette/post")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "POST 1 3", resp.String())
+	tests.AssertEqual(t, 0, len(cassette.Interactions()))
+}
@@ -0,0 +1,152 @@
+package req
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	reqtls "github.com/imroc/req/v3/pkg/tls"
+)
+
+// ErrCertificatePinMismatch is returned when no certificate of the chain
+// of a host matches the pins of the host, see Client.SetCertificatePins.
+var ErrCertificatePinMismatch = errors.New("req: certificate pin mismatch")
+
+// CertificatePin returns the pin of cert, the base64 encoded SHA-256 hash
+// of its SubjectPublicKeyInfo, prefixed with "sha256/".
+func CertificatePin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// parseCertificatePin returns the hash of a pin returned by CertificatePin,
+// the "sha256/" prefix is optional.
+func parseCertificatePin(pin string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+	if err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid certificate pin %q", pin)
+	}
+	return string(b), nil
+}
+
+// setCertificatePins set the pins of host, see Client.SetCertificatePins.
+func (t *Transport) setCertificatePins(host string, pins ...string) error {
+	host = strings.ToLower(host)
+	if len(pins) == 0 {
+		delete(t.certPins, host)
+		return nil
+	}
+	hashes := make([]string, 0, len(pins))
+	for _, pin := range pins {
+		hash, err := parseCertificatePin(pin)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+	}
+	if t.certPins == nil {
+		t.certPins = make(map[string][]string)
+	}
+	t.certPins[host] = hashes
+	return nil
+}
+
+// hostCertificatePins returns the pins of host, or of its closest wildcard.
+func (t *Transport) hostCertificatePins(host string) []string {
+	host = strings.ToLower(host)
+	if pins, ok := t.certPins[host]; ok {
+		return pins
+	}
+	for {
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return nil
+		}
+		host = host[i+1:]
+		if pins, ok := t.certPins["*."+host]; ok {
+			return pins
+		}
+	}
+}
+
+// verifyCertificatePins checks the certificates of the connection to host
+// against the pins of host, the server name of cs is empty for IP addresses.
+func (t *Transport) verifyCertificatePins(host string, cs tls.ConnectionState) error {
+	if len(t.certPins) == 0 {
+		return nil
+	}
+	pins := t.hostCertificatePins(host)
+	if pins == nil {
+		return nil
+	}
+	chains := cs.VerifiedChains
+	if len(chains) == 0 && len(cs.PeerCertificates) > 0 {
+		// The other certificates sent by the server are not verified
+		// without a verified chain, only the certificate of the server
+		// can be trusted to match.
+		chains = [][]*x509.Certificate{cs.PeerCertificates[:1]}
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if pin == string(sum[:]) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w for %s", ErrCertificatePinMismatch, host)
+}
+
+// verifyDialTLSConnection checks the connections to host returned by
+// DialTLSContext with verifyConnection, the certificates of the connections
+// which do not implement tls.Conn are unknown, they are rejected if host
+// has pins.
+func (t *Transport) verifyDialTLSConnection(ctx context.Context, host string, conn net.Conn) error {
+	if len(t.certPins) == 0 && t.revocation == nil {
+		return nil
+	}
+	tc, ok := conn.(reqtls.Conn)
+	if !ok {
+		if t.hostCertificatePins(host) != nil {
+			return fmt.Errorf("%w for %s: the connection of DialTLSContext does not implement tls.Conn", ErrCertificatePinMismatch, host)
+		}
+		return nil
+	}
+	return t.verifyConnection(ctx, host, tc.ConnectionState())
+}
+
+// verifyConnection checks the certificate pins of host and the revocation
+// status of its certificate, ctx is the context of the handshake.
+func (t *Transport) verifyConnection(ctx context.Context, host string, cs tls.ConnectionState) error {
+	if err := t.verifyCertificatePins(host, cs); err != nil {
+		return err
+	}
+	if t.revocation != nil {
+		return t.revocation.verify(ctx, host, cs)
+	}
+	return nil
+}
+
+// wrapVerifyConnection returns a VerifyConnection function which calls fn
+// and checks the connection to host with verifyConnection.
+func (t *Transport) wrapVerifyConnection(ctx context.Context, fn func(tls.ConnectionState) error, host string) func(tls.ConnectionState) error {
+	if len(t.certPins) == 0 && t.revocation == nil {
+		return fn
+	}
+	return func(cs tls.ConnectionState) error {
+		if fn != nil {
+			if err := fn(cs); err != nil {
+				return err
+			}
+		}
+		return t.verifyConnection(ctx, host, cs)
+	}
+}
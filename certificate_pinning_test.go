@@ -0,0 +1,153 @@
+package req
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const testWrongPin = "sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+func TestCertificatePins(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	pin := CertificatePin(srv.Certificate())
+
+	for _, c := range []*Client{C(), C().ImpersonateChrome()} {
+		c.EnableInsecureSkipVerify().DisableKeepAlives()
+		// A backup pin matches.
+		resp, err := c.SetCertificatePins("127.0.0.1", testWrongPin, pin).R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "HTTP/2.0", resp.String())
+
+		_, err = c.SetCertificatePins("127.0.0.1", testWrongPin).R().Get(srv.URL)
+		tests.AssertEqual(t, true, errors.Is(err, ErrCertificatePinMismatch))
+
+		// Hosts without pins are not checked.
+		_, err = c.SetCertificatePins("127.0.0.1").R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+	}
+
+	c := C().SetCertificatePins("example.com", "not a pin")
+	tests.AssertEqual(t, 0, len(c.certPins))
+}
+
+func TestCertificatePinsUnverifiedChain(t *testing.T) {
+	pki := newRevocationTestPKI(t)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cert := pki.leaf
+	cert.Certificate = append(cert.Certificate, pki.ca.Raw)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The chain sent by the server is only trusted once verified.
+	c := C().EnableInsecureSkipVerify().DisableKeepAlives().SetCertificatePins("127.0.0.1", CertificatePin(pki.ca))
+	_, err := c.R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificatePinMismatch))
+	_, err = c.SetCertificatePins("127.0.0.1", CertificatePin(pki.leaf.Leaf)).R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+
+	c = C().SetRootCertFromString(pki.caPEM).SetCertificatePins("127.0.0.1", CertificatePin(pki.ca))
+	_, err = c.R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+}
+
+func TestCertificatePinsDialTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := C().DisableKeepAlives().SetDialTLS(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+		return d.DialContext(ctx, network, addr)
+	})
+	_, err := c.SetCertificatePins("127.0.0.1", testWrongPin).R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificatePinMismatch))
+	_, err = c.SetCertificatePins("127.0.0.1", CertificatePin(srv.Certificate())).R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+
+	// The certificates of other connections are unknown.
+	c.SetDialTLS(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+		conn, err := d.DialContext(ctx, network, addr)
+		return struct{ net.Conn }{conn}, err
+	})
+	_, err = c.R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificatePinMismatch))
+}
+
+func TestHostCertificatePins(t *testing.T) {
+	tr := T()
+	tests.AssertNoError(t, tr.setCertificatePins("*.Example.com", testWrongPin))
+	tests.AssertNoError(t, tr.setCertificatePins("api.example.com", testWrongPin, testWrongPin))
+	tests.AssertEqual(t, 1, len(tr.hostCertificatePins("a.b.example.com")))
+	tests.AssertEqual(t, 2, len(tr.hostCertificatePins("API.example.com")))
+	tests.AssertEqual(t, 0, len(tr.hostCertificatePins("example.com")))
+	tests.AssertErrorContains(t, tr.setCertificatePins("example.com", "sha256/AAAA"), "invalid certificate pin")
+}
+
+func TestVerifyPeerCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for _, c := range []*Client{C(), C().ImpersonateChrome()} {
+		var subjects []string
+		c.EnableInsecureSkipVerify().SetVerifyPeerCertificate(func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			subjects = append(subjects, cert.Subject.String())
+			if strings.Contains(cert.Subject.String(), "Acme") {
+				return errors.New("untrusted organization")
+			}
+			return nil
+		})
+		_, err := c.R().Get(srv.URL)
+		tests.AssertErrorContains(t, err, "untrusted organization")
+		tests.AssertEqual(t, 1, len(subjects))
+	}
+}
+
+func TestCertificatePinsHTTP3(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "https://" + pc.LocalAddr().String()
+	c := C().EnableInsecureSkipVerify().EnableForceHTTP3().SetCertificatePins("127.0.0.1", CertificatePin(leaf))
+	_, err = c.R().Get(url)
+	tests.AssertNoError(t, err)
+	c = C().EnableInsecureSkipVerify().EnableForceHTTP3().SetCertificatePins("127.0.0.1", testWrongPin)
+	_, err = c.R().Get(url)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificatePinMismatch))
+}
@@ -0,0 +1,204 @@
+package req
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// X509KeyPairWithPassword is like tls.X509KeyPair, but the private key may
+// be a PKCS#8 "ENCRYPTED PRIVATE KEY" encrypted with password. Legacy
+// encrypted PEM blocks with a "Proc-Type: 4,ENCRYPTED" header are rejected,
+// their encryption is insecure, convert them with "openssl pkcs8 -topk8".
+func X509KeyPairWithPassword(certPEMBlock, keyPEMBlock []byte, password string) (tls.Certificate, error) {
+	var block *pem.Block
+	rest := keyPEMBlock
+	for {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return tls.Certificate{}, errors.New("failed to find a private key in the key data")
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			break
+		}
+	}
+	if _, ok := block.Headers["DEK-Info"]; ok {
+		return tls.Certificate{}, errors.New("legacy encrypted PEM private keys are not supported, convert the key to PKCS#8 with \"openssl pkcs8 -topk8\"")
+	}
+	if block.Type != "ENCRYPTED PRIVATE KEY" {
+		return tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+	}
+	key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decrypt the private key, the password may be incorrect: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEMBlock, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// PKCS12KeyPair decodes a PKCS#12 bundle (.p12 or .pfx file) protected by
+// password into a certificate, with its chain.
+func PKCS12KeyPair(data []byte, password string) (tls.Certificate, error) {
+	key, leaf, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	cert := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	for _, ca := range caCerts {
+		cert.Certificate = append(cert.Certificate, ca.Raw)
+	}
+	return cert, nil
+}
+
+// loadCertificateFiles loads a PEM certificate and its key, or a PKCS#12
+// bundle if keyFile is empty.
+func loadCertificateFiles(certFile, keyFile, password string) (tls.Certificate, error) {
+	certData, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if keyFile == "" {
+		return PKCS12KeyPair(certData, password)
+	}
+	keyData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return X509KeyPairWithPassword(certData, keyData, password)
+}
+
+// certificateCheckInterval is the minimum interval between the checks of
+// the files of a ClientCertificateReloader.
+const certificateCheckInterval = time.Second
+
+// ClientCertificateReloader provides a client certificate which is reloaded
+// from its files when they change, e.g. when they are rotated. Use its
+// GetClientCertificate method with Client.SetClientCertificateFunc.
+type ClientCertificateReloader struct {
+	certFile, keyFile, password string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTimes  [2]time.Time
+	nextCheck time.Time // the files are not checked before
+}
+
+// NewClientCertificateReloader loads the PEM certificate certFile and its
+// private key keyFile, encrypted with password if not empty, or the
+// PKCS#12 bundle certFile if keyFile is empty.
+func NewClientCertificateReloader(certFile, keyFile, password string) (*ClientCertificateReloader, error) {
+	r := &ClientCertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		password: password,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *ClientCertificateReloader) fileModTimes() [2]time.Time {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// Reload loads the certificate from its files, the current certificate is
+// kept if it fails.
+func (r *ClientCertificateReloader) Reload() error {
+	modTimes := r.fileModTimes()
+	cert, err := loadCertificateFiles(r.certFile, r.keyFile, r.password)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		// Load the files again on the next handshake, even if they are not
+		// modified anymore.
+		r.modTimes = [2]time.Time{}
+		return err
+	}
+	r.modTimes = modTimes
+	r.cert = &cert
+	return nil
+}
+
+// GetClientCertificate returns the certificate, reloaded if its files
+// changed since the last load, which is checked at most once per second,
+// it can be used as tls.Config.GetClientCertificate.
+func (r *ClientCertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	now := time.Now()
+	r.mu.Lock()
+	cert, modTimes := r.cert, r.modTimes
+	check := !now.Before(r.nextCheck)
+	if check {
+		r.nextCheck = now.Add(certificateCheckInterval)
+	}
+	r.mu.Unlock()
+	if check && modTimes != r.fileModTimes() {
+		// A rotation may be in progress, the current certificate is used
+		// until the files are consistent.
+		r.Reload()
+		r.mu.Lock()
+		cert = r.cert
+		r.mu.Unlock()
+	}
+	return cert, nil
+}
+
+// toUTLSCertificate converts cert for the utls handshakes.
+func toUTLSCertificate(cert *tls.Certificate) *utls.Certificate {
+	c := &utls.Certificate{
+		Certificate:                 cert.Certificate,
+		PrivateKey:                  cert.PrivateKey,
+		OCSPStaple:                  cert.OCSPStaple,
+		SignedCertificateTimestamps: cert.SignedCertificateTimestamps,
+		Leaf:                        cert.Leaf,
+	}
+	for _, s := range cert.SupportedSignatureAlgorithms {
+		c.SupportedSignatureAlgorithms = append(c.SupportedSignatureAlgorithms, utls.SignatureScheme(s))
+	}
+	return c
+}
+
+// toUTLSGetClientCertificate adapts fn to the utls handshakes, the context
+// of the CertificateRequestInfo passed to fn is nil.
+func toUTLSGetClientCertificate(fn func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) func(*utls.CertificateRequestInfo) (*utls.Certificate, error) {
+	return func(info *utls.CertificateRequestInfo) (*utls.Certificate, error) {
+		cri := &tls.CertificateRequestInfo{
+			AcceptableCAs: info.AcceptableCAs,
+			Version:       info.Version,
+		}
+		for _, s := range info.SignatureSchemes {
+			cri.SignatureSchemes = append(cri.SignatureSchemes, tls.SignatureScheme(s))
+		}
+		cert, err := fn(cri)
+		if err != nil || cert == nil {
+			return nil, err
+		}
+		return toUTLSCertificate(cert), nil
+	}
+}
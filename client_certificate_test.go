@@ -0,0 +1,159 @@
+package req
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestX509KeyPairWithPassword(t *testing.T) {
+	certPEM := getTestFileContent(t, "sample-client.pem")
+	want, err := tls.X509KeyPair(certPEM, getTestFileContent(t, "sample-client-key.pem"))
+	tests.AssertNoError(t, err)
+
+	cert, err := X509KeyPairWithPassword(certPEM, getTestFileContent(t, "sample-client-key-encrypted.pem"), "secret")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, cert.PrivateKey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(want.PrivateKey))
+
+	_, err = X509KeyPairWithPassword(certPEM, getTestFileContent(t, "sample-client-key-encrypted.pem"), "wrong")
+	tests.AssertErrorContains(t, err, "password")
+
+	// The insecure legacy PEM encryption is rejected.
+	_, err = X509KeyPairWithPassword(certPEM, getTestFileContent(t, "sample-client-key-legacy.pem"), "secret")
+	tests.AssertErrorContains(t, err, "openssl pkcs8 -topk8")
+
+	// Unencrypted keys are accepted too.
+	_, err = X509KeyPairWithPassword(certPEM, getTestFileContent(t, "sample-client-key.pem"), "")
+	tests.AssertNoError(t, err)
+}
+
+func TestPKCS12KeyPair(t *testing.T) {
+	cert, err := PKCS12KeyPair(getTestFileContent(t, "sample-client.p12"), "secret")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, cert.Leaf != nil)
+	tests.AssertEqual(t, true, cert.PrivateKey != nil)
+
+	_, err = PKCS12KeyPair(getTestFileContent(t, "sample-client.p12"), "wrong")
+	tests.AssertNotNil(t, err)
+}
+
+func TestClientCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	os.WriteFile(certFile, getTestFileContent(t, "sample-client.pem"), 0o600)
+	os.WriteFile(keyFile, getTestFileContent(t, "sample-client-key-encrypted.pem"), 0o600)
+
+	r, err := NewClientCertificateReloader(certFile, keyFile, "secret")
+	tests.AssertNoError(t, err)
+	first, err := r.GetClientCertificate(nil)
+	tests.AssertNoError(t, err)
+	cert, _ := r.GetClientCertificate(nil)
+	tests.AssertEqual(t, true, first == cert)
+
+	// A broken rotation keeps the current certificate.
+	os.WriteFile(keyFile, []byte("broken"), 0o600)
+	tests.AssertNotNil(t, r.Reload())
+	cert, _ = r.GetClientCertificate(nil)
+	tests.AssertEqual(t, true, first == cert)
+
+	os.WriteFile(certFile, getTestFileContent(t, "sample-server.pem"), 0o600)
+	os.WriteFile(keyFile, getTestFileContent(t, "sample-server-key.pem"), 0o600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	// The files are not checked again within a second.
+	cert, _ = r.GetClientCertificate(nil)
+	tests.AssertEqual(t, true, first == cert)
+	r.nextCheck = time.Time{}
+	cert, _ = r.GetClientCertificate(nil)
+	tests.AssertEqual(t, false, first == cert)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	tests.AssertNoError(t, err)
+	server, _ := tls.X509KeyPair(getTestFileContent(t, "sample-server.pem"), getTestFileContent(t, "sample-server-key.pem"))
+	tests.AssertEqual(t, server.Certificate[0], leaf.Raw)
+
+	_, err = NewClientCertificateReloader(filepath.Join(dir, "missing.pem"), keyFile, "")
+	tests.AssertNotNil(t, err)
+}
+
+func TestClientCertificates(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	cert, err := tls.X509KeyPair(getTestFileContent(t, "sample-client.pem"), getTestFileContent(t, "sample-client-key.pem"))
+	tests.AssertNoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	tests.AssertNoError(t, err)
+	cn := leaf.Subject.CommonName
+
+	for _, newClient := range []func() *Client{
+		func() *Client { return C() },
+		func() *Client { return C().ImpersonateChrome() },
+	} {
+		resp, err := newClient().EnableInsecureSkipVerify().SetCerts(cert).R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, cn, resp.String())
+
+		calls := 0
+		resp, err = newClient().EnableInsecureSkipVerify().
+			SetClientCertificateFunc(func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				calls++
+				return &cert, nil
+			}).R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, cn, resp.String())
+		tests.AssertEqual(t, 1, calls)
+
+		resp, err = newClient().EnableInsecureSkipVerify().
+			SetCertFromPKCS12File(tests.GetTestFilePath("sample-client.p12"), "secret").R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, cn, resp.String())
+
+		resp, err = newClient().EnableInsecureSkipVerify().
+			SetCertFromFileAutoReload(tests.GetTestFilePath("sample-client.pem"), tests.GetTestFilePath("sample-client-key-encrypted.pem"), "secret").
+			R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, cn, resp.String())
+	}
+}
+
+func TestClientCertificateHTTP3(t *testing.T) {
+	serverCert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAnyClientCert,
+		}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+
+	c := C().EnableInsecureSkipVerify().EnableForceHTTP3().
+		SetCertFromFileAutoReload(tests.GetTestFilePath("sample-client.p12"), "", "secret")
+	resp, err := c.R().Get("https://" + pc.LocalAddr().String())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, resp.String() != "")
+}
@@ -0,0 +1,470 @@
+package req
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/imroc/req/v3/http2"
+	utls "github.com/refraction-networking/utls"
+)
+
+// HTTP2Fingerprint is the HTTP/2 fingerprint of a client, as described by
+// the Akamai fingerprint format
+// (https://www.blackhat.com/docs/eu-17/materials/eu-17-Shuster-Passive-Fingerprinting-Of-HTTP2-Clients-wp.pdf).
+type HTTP2Fingerprint struct {
+	// Settings is the ordered SETTINGS frame.
+	Settings []http2.Setting
+	// ConnectionFlow is the increment of the initial WINDOW_UPDATE frame,
+	// 0 if none is sent.
+	ConnectionFlow uint32
+	// PriorityFrames are the ordered PRIORITY frames sent after the
+	// connection preface.
+	PriorityFrames []http2.PriorityFrame
+	// PseudoHeaderOrder is the order of the pseudo headers, e.g.
+	// [":method", ":authority", ":scheme", ":path"].
+	PseudoHeaderOrder []string
+}
+
+var akamaiPseudoHeaders = map[string]string{
+	"m": ":method",
+	"a": ":authority",
+	"s": ":scheme",
+	"p": ":path",
+}
+
+// ParseAkamaiHTTP2Fingerprint parses an Akamai HTTP/2 fingerprint of the
+// form SETTINGS|WINDOW_UPDATE|PRIORITY|PSEUDO_HEADER_ORDER, for example
+// "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p". PRIORITY is either 0
+// or a comma-separated list of StreamID:Exclusive:DependsOn:Weight.
+func ParseAkamaiHTTP2Fingerprint(fingerprint string) (*HTTP2Fingerprint, error) {
+	parts := strings.Split(strings.TrimSpace(fingerprint), "|")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid akamai http2 fingerprint %q: want 4 parts separated by '|', got %d", fingerprint, len(parts))
+	}
+	fp := &HTTP2Fingerprint{}
+	if parts[0] != "" {
+		for _, s := range strings.Split(parts[0], ";") {
+			id, val, ok := strings.Cut(s, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid akamai http2 setting %q", s)
+			}
+			n, err := strconv.ParseUint(id, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid akamai http2 setting id %q", id)
+			}
+			v, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid akamai http2 setting value %q", val)
+			}
+			fp.Settings = append(fp.Settings, http2.Setting{ID: http2.SettingID(n), Val: uint32(v)})
+		}
+	}
+	if parts[1] != "" && parts[1] != "00" {
+		flow, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid akamai http2 window update %q", parts[1])
+		}
+		fp.ConnectionFlow = uint32(flow)
+	}
+	if parts[2] != "" && parts[2] != "0" {
+		for _, s := range strings.Split(parts[2], ",") {
+			fields := strings.Split(s, ":")
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("invalid akamai http2 priority frame %q", s)
+			}
+			var nums [4]uint64
+			for i, f := range fields {
+				n, err := strconv.ParseUint(f, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid akamai http2 priority frame %q", s)
+				}
+				nums[i] = n
+			}
+			// The fingerprint has the actual weight, between 1 and 256,
+			// the frame has the weight minus one.
+			if nums[1] > 1 || nums[3] < 1 || nums[3] > 256 {
+				return nil, fmt.Errorf("invalid akamai http2 priority frame %q", s)
+			}
+			fp.PriorityFrames = append(fp.PriorityFrames, http2.PriorityFrame{
+				StreamID: uint32(nums[0]),
+				PriorityParam: http2.PriorityParam{
+					Exclusive: nums[1] == 1,
+					StreamDep: uint32(nums[2]),
+					Weight:    uint8(nums[3] - 1),
+				},
+			})
+		}
+	}
+	if parts[3] != "" {
+		for _, s := range strings.Split(parts[3], ",") {
+			h, ok := akamaiPseudoHeaders[s]
+			if !ok {
+				return nil, fmt.Errorf("invalid akamai http2 pseudo header %q", s)
+			}
+			fp.PseudoHeaderOrder = append(fp.PseudoHeaderOrder, h)
+		}
+	}
+	return fp, nil
+}
+
+// ParseJA3 parses a JA3 string of the form
+// SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats
+// into a ClientHelloSpec.
+//
+// JA3 does not record the content of the extensions, common values used
+// by browsers are filled in (e.g. the signature algorithms and
+// ALPN "h2" and "http/1.1"). The pre_shared_key extension is dropped, as
+// browsers only send it when resuming a session.
+func ParseJA3(ja3 string) (*utls.ClientHelloSpec, error) {
+	fields := strings.Split(strings.TrimSpace(ja3), ",")
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid ja3 %q: want 5 fields separated by ',', got %d", ja3, len(fields))
+	}
+	version, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 tls version %q", fields[0])
+	}
+	ciphers, err := parseUint16List(fields[1], "-", 10)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 ciphers: %w", err)
+	}
+	extensions, err := parseUint16List(fields[2], "-", 10)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 extensions: %w", err)
+	}
+	curves, err := parseUint16List(fields[3], "-", 10)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 elliptic curves: %w", err)
+	}
+	points, err := parseUint16List(fields[4], "-", 10)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 point formats: %w", err)
+	}
+	b := &clientHelloBuilder{
+		version:    uint16(version),
+		ciphers:    ciphers,
+		extensions: extensions,
+		curves:     curves,
+		alpn:       []string{"h2", "http/1.1"},
+	}
+	for _, p := range points {
+		b.points = append(b.points, uint8(p))
+	}
+	return b.build()
+}
+
+var errJA4Hashed = errors.New("the hashes of a ja4 fingerprint can not be reversed, use the raw ja4_r or ja4_ro form")
+
+// ParseJA4 parses the raw form of a JA4 fingerprint (JA4_r or JA4_ro), for
+// example "t13d1516h2_002f,0035,..._0005,000a,..._0403,0804,...", into a
+// ClientHelloSpec. The hashed JA4 form can not be parsed, since hashes can
+// not be reversed.
+//
+// JA4_r lists ciphers and extensions sorted, so the extension order of the
+// resulting ClientHelloSpec is not the one of the client, which has no
+// effect when the client randomizes its extension order as Chrome does. The
+// SNI and ALPN extensions missing from JA4_r are added according to the
+// prefix, and the elliptic curves, which JA4 does not record, default to
+// X25519, P-256 and P-384.
+func ParseJA4(ja4 string) (*utls.ClientHelloSpec, error) {
+	fields := strings.Split(strings.TrimSpace(ja4), "_")
+	if len(fields) < 3 || len(fields) > 4 || len(fields[0]) != 10 {
+		return nil, fmt.Errorf("invalid ja4 %q", ja4)
+	}
+	prefix := fields[0]
+	if prefix[0] == 'q' {
+		return nil, errors.New("ja4 of a QUIC client can not be used for TCP connections")
+	}
+	if prefix[0] != 't' {
+		return nil, fmt.Errorf("invalid ja4 protocol %q", prefix[:1])
+	}
+	var version uint16
+	switch prefix[1:3] {
+	case "13":
+		version = utls.VersionTLS13
+	case "12":
+		version = utls.VersionTLS12
+	case "11":
+		version = utls.VersionTLS11
+	case "10":
+		version = utls.VersionTLS10
+	default:
+		return nil, fmt.Errorf("invalid ja4 tls version %q", prefix[1:3])
+	}
+	if len(fields[1]) == 12 && !strings.Contains(fields[1], ",") {
+		if _, err := strconv.ParseUint(fields[1], 16, 64); err == nil {
+			return nil, errJA4Hashed
+		}
+	}
+	ciphers, err := parseUint16List(fields[1], ",", 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja4 ciphers: %w", err)
+	}
+	extensions, err := parseUint16List(fields[2], ",", 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja4 extensions: %w", err)
+	}
+	var sigAlgs []uint16
+	if len(fields) == 4 {
+		if sigAlgs, err = parseUint16List(fields[3], ",", 16); err != nil {
+			return nil, fmt.Errorf("invalid ja4 signature algorithms: %w", err)
+		}
+	}
+	b := &clientHelloBuilder{
+		version:    utls.VersionTLS12,
+		ciphers:    ciphers,
+		extensions: extensions,
+		curves:     []uint16{uint16(utls.X25519), uint16(utls.CurveP256), uint16(utls.CurveP384)},
+		points:     []uint8{0},
+	}
+	if version < utls.VersionTLS12 {
+		b.version = version
+	}
+	for _, alg := range sigAlgs {
+		b.sigAlgs = append(b.sigAlgs, utls.SignatureScheme(alg))
+	}
+	switch alpn := prefix[8:10]; alpn {
+	case "00":
+	case "h2":
+		b.alpn = []string{"h2", "http/1.1"}
+	case "h1":
+		b.alpn = []string{"http/1.1"}
+	default:
+		b.alpn = []string{alpn}
+	}
+	// JA4_r leaves out the SNI and ALPN extensions, JA4_ro keeps them.
+	if prefix[3] == 'd' && !containsUint16(extensions, 0x0000) {
+		b.extensions = append([]uint16{0x0000}, b.extensions...)
+	}
+	if b.alpn != nil && !containsUint16(extensions, 0x0010) {
+		b.extensions = append(b.extensions, 0x0010)
+	}
+	if version == utls.VersionTLS13 && !containsUint16(b.extensions, 0x002b) {
+		b.extensions = append(b.extensions, 0x002b)
+	}
+	return b.build()
+}
+
+func parseUint16List(s, sep string, base int) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var list []uint16
+	for _, f := range strings.Split(s, sep) {
+		n, err := strconv.ParseUint(f, base, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", f)
+		}
+		list = append(list, uint16(n))
+	}
+	return list, nil
+}
+
+func containsUint16(list []uint16, v uint16) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// defaultSignatureAlgorithms are the signature algorithms sent by Chrome,
+// used when the fingerprint does not record them.
+var defaultSignatureAlgorithms = []utls.SignatureScheme{
+	utls.ECDSAWithP256AndSHA256,
+	utls.PSSWithSHA256,
+	utls.PKCS1WithSHA256,
+	utls.ECDSAWithP384AndSHA384,
+	utls.PSSWithSHA384,
+	utls.PKCS1WithSHA384,
+	utls.PSSWithSHA512,
+	utls.PKCS1WithSHA512,
+}
+
+// clientHelloBuilder builds a ClientHelloSpec from the values recorded by
+// a TLS fingerprint, filling in the content of the extensions.
+type clientHelloBuilder struct {
+	version    uint16
+	ciphers    []uint16
+	extensions []uint16
+	curves     []uint16
+	points     []uint8
+	sigAlgs    []utls.SignatureScheme
+	alpn       []string
+}
+
+func (b *clientHelloBuilder) build() (*utls.ClientHelloSpec, error) {
+	if len(b.ciphers) == 0 {
+		return nil, errors.New("no cipher suite in tls fingerprint")
+	}
+	grease := false
+	for _, c := range b.ciphers {
+		if isGREASE(c) {
+			grease = true
+		}
+	}
+	sigAlgs := b.sigAlgs
+	if len(sigAlgs) == 0 {
+		sigAlgs = defaultSignatureAlgorithms
+	}
+	var curves []utls.CurveID
+	for _, c := range b.curves {
+		if isGREASE(c) {
+			curves = append(curves, utls.GREASE_PLACEHOLDER)
+			continue
+		}
+		curves = append(curves, utls.CurveID(c))
+	}
+
+	spec := &utls.ClientHelloSpec{
+		CompressionMethods: []uint8{0},
+	}
+	for _, c := range b.ciphers {
+		if isGREASE(c) {
+			c = utls.GREASE_PLACEHOLDER
+		}
+		spec.CipherSuites = append(spec.CipherSuites, c)
+	}
+	tls13 := containsUint16(b.extensions, 0x002b)
+	if !tls13 {
+		spec.TLSVersMin = utls.VersionTLS10
+		spec.TLSVersMax = b.version
+	}
+	for _, id := range b.extensions {
+		ext := utls.ExtensionFromID(id)
+		switch e := ext.(type) {
+		case nil:
+			ext = &utls.GenericExtension{Id: id}
+		case utls.PreSharedKeyExtension:
+			continue
+		case *utls.QUICTransportParametersExtension:
+			return nil, errors.New("quic_transport_parameters extension can not be used for TCP connections")
+		case *utls.SupportedCurvesExtension:
+			e.Curves = curves
+		case *utls.SupportedPointsExtension:
+			e.SupportedPoints = b.points
+		case *utls.SignatureAlgorithmsExtension:
+			e.SupportedSignatureAlgorithms = sigAlgs
+		case *utls.SignatureAlgorithmsCertExtension:
+			e.SupportedSignatureAlgorithms = sigAlgs
+		case *utls.ALPNExtension:
+			e.AlpnProtocols = b.alpn
+		case *utls.UtlsPaddingExtension:
+			e.GetPaddingLen = utls.BoringPaddingStyle
+		case *utls.UtlsCompressCertExtension:
+			e.Algorithms = []utls.CertCompressionAlgo{utls.CertCompressionBrotli}
+		case *utls.FakeRecordSizeLimitExtension:
+			e.Limit = 0x4001
+		case *utls.FakeDelegatedCredentialsExtension:
+			e.SupportedSignatureAlgorithms = []utls.SignatureScheme{
+				utls.ECDSAWithP256AndSHA256,
+				utls.ECDSAWithP384AndSHA384,
+				utls.ECDSAWithP521AndSHA512,
+				utls.ECDSAWithSHA1,
+			}
+		case *utls.SupportedVersionsExtension:
+			if grease {
+				e.Versions = append(e.Versions, utls.GREASE_PLACEHOLDER)
+			}
+			e.Versions = append(e.Versions, utls.VersionTLS13, utls.VersionTLS12)
+		case *utls.PSKKeyExchangeModesExtension:
+			e.Modes = []uint8{utls.PskModeDHE}
+		case *utls.KeyShareExtension:
+			e.KeyShares = keySharesFor(curves)
+		case *utls.ApplicationSettingsExtension:
+			e.SupportedProtocols = []string{"h2"}
+		case *utls.ApplicationSettingsExtensionNew:
+			e.SupportedProtocols = []string{"h2"}
+		case *utls.GREASEEncryptedClientHelloExtension:
+			ext = utls.BoringGREASEECH()
+		case *utls.RenegotiationInfoExtension:
+			e.Renegotiation = utls.RenegotiateOnceAsClient
+		}
+		spec.Extensions = append(spec.Extensions, ext)
+	}
+	return spec, nil
+}
+
+// keySharesFor returns the key shares sent for the supported curves: a
+// GREASE one if the curves start with GREASE, then the first curve and,
+// when it is a post-quantum hybrid, the next one as a fallback.
+func keySharesFor(curves []utls.CurveID) []utls.KeyShare {
+	var shares []utls.KeyShare
+	if len(curves) > 0 && curves[0] == utls.GREASE_PLACEHOLDER {
+		shares = append(shares, utls.KeyShare{Group: utls.GREASE_PLACEHOLDER, Data: []byte{0}})
+		curves = curves[1:]
+	}
+	if len(curves) == 0 {
+		return shares
+	}
+	shares = append(shares, utls.KeyShare{Group: curves[0]})
+	if (curves[0] == utls.X25519MLKEM768 || curves[0] == utls.X25519Kyber768Draft00) && len(curves) > 1 {
+		shares = append(shares, utls.KeyShare{Group: curves[1]})
+	}
+	return shares
+}
+
+// tlsFingerprintParser returns ParseJA3 or ParseJA4 according to the form
+// of fingerprint.
+func tlsFingerprintParser(fingerprint string) func(string) (*utls.ClientHelloSpec, error) {
+	if strings.Count(fingerprint, ",") == 4 {
+		return ParseJA3
+	}
+	return ParseJA4
+}
+
+// ImpersonateFromFingerprint impersonates a client from its fingerprints:
+// tlsFingerprint is a JA3 string or a raw JA4 (see ParseJA3 and ParseJA4),
+// akamaiH2 is an Akamai HTTP/2 fingerprint (see
+// ParseAkamaiHTTP2Fingerprint), headerOrder is the order of the http
+// headers. Empty values are ignored. The fingerprints are usually taken
+// from a fingerprinting service such as https://tls.peet.ws/api/all.
+//
+// The client is left unchanged if a fingerprint can not be parsed, use
+// ParseJA3, ParseJA4 or ParseAkamaiHTTP2Fingerprint to get the error.
+func (c *Client) ImpersonateFromFingerprint(tlsFingerprint, akamaiH2 string, headerOrder ...string) *Client {
+	var (
+		parseTLS func(string) (*utls.ClientHelloSpec, error)
+		h2       *HTTP2Fingerprint
+		err      error
+	)
+	if tlsFingerprint != "" {
+		parseTLS = tlsFingerprintParser(tlsFingerprint)
+		if _, err = parseTLS(tlsFingerprint); err != nil {
+			c.log.Errorf("failed to parse tls fingerprint: %v", err)
+			return c
+		}
+	}
+	if akamaiH2 != "" {
+		if h2, err = ParseAkamaiHTTP2Fingerprint(akamaiH2); err != nil {
+			c.log.Errorf("failed to parse http2 fingerprint: %v", err)
+			return c
+		}
+	}
+	if parseTLS != nil {
+		// The extensions are stateful, so each handshake gets its own spec.
+		c.SetTLSFingerprintSpec(func() utls.ClientHelloSpec {
+			spec, _ := parseTLS(tlsFingerprint)
+			return *spec
+		})
+	}
+	if h2 != nil {
+		c.SetHTTP2SettingsFrame(h2.Settings...).
+			SetHTTP2ConnectionFlow(h2.ConnectionFlow).
+			SetHTTP2PriorityFrames(h2.PriorityFrames...)
+		if len(h2.PseudoHeaderOrder) > 0 {
+			c.SetCommonPseudoHeaderOder(h2.PseudoHeaderOrder...)
+		}
+	}
+	if len(headerOrder) > 0 {
+		c.SetCommonHeaderOrder(headerOrder...)
+	}
+	return c
+}
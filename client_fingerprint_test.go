@@ -0,0 +1,138 @@
+package req
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/imroc/req/v3/pkg/fingerprint"
+	utls "github.com/refraction-networking/utls"
+)
+
+const (
+	testChromeJA3     = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21,29-23-24,0"
+	testChromeJA4R    = "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0804,0401,0503,0805,0501,0806,0601"
+	testFirefoxAkamai = "1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s"
+)
+
+func TestParseAkamaiHTTP2Fingerprint(t *testing.T) {
+	fp, err := ParseAkamaiHTTP2Fingerprint(testFirefoxAkamai)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 3, len(fp.Settings))
+	tests.AssertEqual(t, uint32(131072), fp.Settings[1].Val)
+	tests.AssertEqual(t, uint32(12517377), fp.ConnectionFlow)
+	tests.AssertEqual(t, firefoxPriorityFrames, fp.PriorityFrames)
+	tests.AssertEqual(t, firefoxPseudoHeaderOrder, fp.PseudoHeaderOrder)
+
+	fp, err = ParseAkamaiHTTP2Fingerprint("1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 0, len(fp.PriorityFrames))
+	tests.AssertEqual(t, chromePseudoHeaderOrder, fp.PseudoHeaderOrder)
+
+	for _, s := range []string{"1:1|0|0", "1|0|0|m", "1:1|0|3:0:0:0|m", "1:1|0|0|x"} {
+		_, err = ParseAkamaiHTTP2Fingerprint(s)
+		if err == nil {
+			t.Errorf("ParseAkamaiHTTP2Fingerprint(%q) should fail", s)
+		}
+	}
+}
+
+func TestParseJA3(t *testing.T) {
+	spec, err := ParseJA3(testChromeJA3)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 15, len(spec.CipherSuites))
+	tests.AssertEqual(t, 16, len(spec.Extensions))
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *utls.SupportedCurvesExtension:
+			tests.AssertEqual(t, []utls.CurveID{utls.X25519, utls.CurveP256, utls.CurveP384}, e.Curves)
+		case *utls.KeyShareExtension:
+			tests.AssertEqual(t, 1, len(e.KeyShares))
+			tests.AssertEqual(t, utls.X25519, e.KeyShares[0].Group)
+		case *utls.GenericExtension:
+			t.Errorf("extension %d should be known", e.Id)
+		}
+	}
+
+	_, err = ParseJA3("771,,0,29,0")
+	tests.AssertErrorContains(t, err, "no cipher suite")
+}
+
+func TestParseJA4(t *testing.T) {
+	spec, err := ParseJA4(testChromeJA4R)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 15, len(spec.CipherSuites))
+	// SNI and ALPN are added back to the extensions of JA4_r.
+	tests.AssertEqual(t, 15, len(spec.Extensions))
+	_, isSNI := spec.Extensions[0].(*utls.SNIExtension)
+	tests.AssertEqual(t, true, isSNI)
+
+	_, err = ParseJA4("t13d1516h2_8daaf6152771_02713d6af862")
+	tests.AssertEqual(t, errJA4Hashed, err)
+}
+
+func TestImpersonateFromFingerprint(t *testing.T) {
+	srv, err := fingerprint.NewServer()
+	tests.AssertNoError(t, err)
+	defer srv.Close()
+	const akamai = "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"
+
+	var fp fingerprint.Fingerprint
+	c := C().EnableInsecureSkipVerify().ImpersonateFromFingerprint(testChromeJA3, akamai, "user-agent", "accept")
+	_, err = c.R().SetSuccessResult(&fp).Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/2.0", fp.Proto)
+	// No SNI is sent to an IP address.
+	tests.AssertEqual(t, strings.Replace(testChromeJA3, ",0-", ",", 1), fp.JA3)
+	tests.AssertEqual(t, akamai, fp.Akamai)
+	tests.AssertEqual(t, chromePseudoHeaderOrder, fp.PseudoHeaderOrder)
+
+	c = C().EnableInsecureSkipVerify().ImpersonateFromFingerprint(testChromeJA4R, akamai, "user-agent", "accept")
+	_, err = c.R().SetSuccessResult(&fp).Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/2.0", fp.Proto)
+	// Without SNI, the ClientHello has one extension less.
+	want := strings.Split(testChromeJA4R, "_")
+	want[0] = "t13i1514h2"
+	tests.AssertEqual(t, strings.Join(want, "_"), fp.JA4R)
+	tests.AssertEqual(t, akamai, fp.Akamai)
+}
+
+func TestImpersonateFingerprints(t *testing.T) {
+	srv, err := fingerprint.NewServer()
+	tests.AssertNoError(t, err)
+	defer srv.Close()
+	tests.AssertNoError(t, srv.EnableHTTP3())
+
+	var fp fingerprint.Fingerprint
+	_, err = C().EnableInsecureSkipVerify().ImpersonateChrome().R().SetSuccessResult(&fp).Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/2.0", fp.Proto)
+	// No SNI is sent to an IP address, and the padding extension is only
+	// sent for some lengths of the ClientHello, which vary with the GREASE
+	// ECH extension.
+	ja4 := strings.Split(strings.Replace(fp.JA4R, ",0015", "", 1), "_")
+	tests.AssertEqual(t, 4, len(ja4))
+	tests.AssertContains(t, ja4[0], "t13i15", true)
+	tests.AssertEqual(t, "002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9", ja4[1])
+	tests.AssertEqual(t, "0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,fe0d,ff01", ja4[2])
+	tests.AssertEqual(t, "0403,0804,0401,0503,0805,0501,0806,0601", ja4[3])
+	tests.AssertEqual(t, "1:65536;2:0;3:1000;4:6291456;6:262144|15663105|0|m,a,s,p", fp.Akamai)
+	tests.AssertEqual(t, chromePseudoHeaderOrder, fp.PseudoHeaderOrder)
+	tests.AssertEqual(t, []string{
+		"pragma", "cache-control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+		"upgrade-insecure-requests", "user-agent", "accept", "sec-fetch-site", "sec-fetch-mode",
+		"sec-fetch-user", "sec-fetch-dest", "accept-encoding", "accept-language",
+	}, fp.HeaderOrder)
+
+	_, err = C().EnableInsecureSkipVerify().ImpersonateFirefox().R().SetSuccessResult(&fp).Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, testFirefoxAkamai, fp.Akamai)
+	tests.AssertEqual(t, firefoxPseudoHeaderOrder, fp.PseudoHeaderOrder)
+
+	_, err = C().EnableInsecureSkipVerify().EnableForceHTTP3().R().SetSuccessResult(&fp).Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/3.0", fp.Proto)
+	tests.AssertContains(t, fp.JA4, "q13i", true)
+	tests.AssertEqual(t, 3, len(srv.Fingerprints()))
+}
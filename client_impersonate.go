@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	"github.com/imroc/req/v3/http2"
-	utls "github.com/refraction-networking/utls"
 )
 
 // Identical for both Blink-based browsers (Chrome, Chromium, etc.) and WebKit-based browsers (Safari, etc.)
@@ -102,22 +101,6 @@ var (
 		"cookie",
 	}
 
-	chromeHeaders = map[string]string{
-		"pragma":                    "no-cache",
-		"cache-control":             "no-cache",
-		"sec-ch-ua":                 `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
-		"sec-ch-ua-mobile":          "?0",
-		"sec-ch-ua-platform":        `"macOS"`,
-		"upgrade-insecure-requests": "1",
-		"user-agent":                "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"accept":                    "text/html,application/xhtml+xml,application/xml,application/json;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
-		"sec-fetch-site":            "none",
-		"sec-fetch-mode":            "navigate",
-		"sec-fetch-user":            "?1",
-		"sec-fetch-dest":            "document",
-		"accept-language":           "zh-CN,zh;q=0.9",
-	}
-
 	chromeHeaderPriority = http2.PriorityParam{
 		StreamDep: 0,
 		Exclusive: true,
@@ -125,18 +108,11 @@ var (
 	}
 )
 
-// ImpersonateChrome impersonates Chrome browser (version 120).
+// ImpersonateChrome impersonates Chrome 120 on macOS, see Impersonate. The
+// version is pinned so that the fingerprint does not change with the
+// registered profiles, use Impersonate("chrome") for the latest one.
 func (c *Client) ImpersonateChrome() *Client {
-	c.
-		SetTLSFingerprint(utls.HelloChrome_120).
-		SetHTTP2SettingsFrame(chromeHttp2Settings...).
-		SetHTTP2ConnectionFlow(15663105).
-		SetCommonPseudoHeaderOder(chromePseudoHeaderOrder...).
-		SetCommonHeaderOrder(chromeHeaderOrder...).
-		SetCommonHeaders(chromeHeaders).
-		SetHTTP2HeaderPriority(chromeHeaderPriority).
-		SetMultipartBoundaryFunc(webkitMultipartBoundaryFunc)
-	return c
+	return c.Impersonate("chrome-120")
 }
 
 var (
@@ -228,18 +204,6 @@ var (
 		"te",
 	}
 
-	firefoxHeaders = map[string]string{
-		"user-agent":                "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:120.0) Gecko/20100101 Firefox/120.0",
-		"accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
-		"accept-language":           "zh-CN,zh;q=0.8,zh-TW;q=0.7,zh-HK;q=0.5,en-US;q=0.3,en;q=0.2",
-		"upgrade-insecure-requests": "1",
-		"sec-fetch-dest":            "document",
-		"sec-fetch-mode":            "navigate",
-		"sec-fetch-site":            "same-origin",
-		"sec-fetch-user":            "?1",
-		//"te":                        "trailers",
-	}
-
 	firefoxHeaderPriority = http2.PriorityParam{
 		StreamDep: 13,
 		Exclusive: false,
@@ -247,19 +211,11 @@ var (
 	}
 )
 
-// ImpersonateFirefox impersonates Firefox browser (version 120).
+// ImpersonateFirefox impersonates Firefox 120 on macOS, see Impersonate. The
+// version is pinned so that the fingerprint does not change with the
+// registered profiles, use Impersonate("firefox") for the latest one.
 func (c *Client) ImpersonateFirefox() *Client {
-	c.
-		SetTLSFingerprint(utls.HelloFirefox_120).
-		SetHTTP2SettingsFrame(firefoxHttp2Settings...).
-		SetHTTP2ConnectionFlow(12517377).
-		SetHTTP2PriorityFrames(firefoxPriorityFrames...).
-		SetCommonPseudoHeaderOder(firefoxPseudoHeaderOrder...).
-		SetCommonHeaderOrder(firefoxHeaderOrder...).
-		SetCommonHeaders(firefoxHeaders).
-		SetHTTP2HeaderPriority(firefoxHeaderPriority).
-		SetMultipartBoundaryFunc(firefoxMultipartBoundaryFunc)
-	return c
+	return c.Impersonate("firefox-120")
 }
 
 var (
@@ -293,15 +249,6 @@ var (
 		"accept-encoding",
 	}
 
-	safariHeaders = map[string]string{
-		"accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		"sec-fetch-site":  "same-origin",
-		"sec-fetch-dest":  "document",
-		"accept-language": "zh-CN,zh-Hans;q=0.9",
-		"sec-fetch-mode":  "navigate",
-		"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
-	}
-
 	safariHeaderPriority = http2.PriorityParam{
 		StreamDep: 0,
 		Exclusive: false,
@@ -309,16 +256,9 @@ var (
 	}
 )
 
-// ImpersonateSafari impersonates Safari browser (version 16.6).
+// ImpersonateSafari impersonates Safari 16.6 on macOS, see Impersonate. The
+// version is pinned so that the fingerprint does not change with the
+// registered profiles, use Impersonate("safari") for the latest one.
 func (c *Client) ImpersonateSafari() *Client {
-	c.
-		SetTLSFingerprint(utls.HelloSafari_16_0).
-		SetHTTP2SettingsFrame(safariHttp2Settings...).
-		SetHTTP2ConnectionFlow(10485760).
-		SetCommonPseudoHeaderOder(safariPseudoHeaderOrder...).
-		SetCommonHeaderOrder(safariHeaderOrder...).
-		SetCommonHeaders(safariHeaders).
-		SetHTTP2HeaderPriority(safariHeaderPriority).
-		SetMultipartBoundaryFunc(webkitMultipartBoundaryFunc)
-	return c
+	return c.Impersonate("safari-16.6")
 }
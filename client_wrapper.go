@@ -3,6 +3,7 @@ package req
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"io"
 	"net"
 	"net/http"
@@ -81,12 +82,96 @@ func SetCertFromFile(certFile, keyFile string) *Client {
 	return defaultClient.SetCertFromFile(certFile, keyFile)
 }
 
+// SetCertFromFileWithPassword is a global wrapper methods which delegated
+// to the default client's Client.SetCertFromFileWithPassword.
+func SetCertFromFileWithPassword(certFile, keyFile, password string) *Client {
+	return defaultClient.SetCertFromFileWithPassword(certFile, keyFile, password)
+}
+
+// SetCertFromPKCS12File is a global wrapper methods which delegated
+// to the default client's Client.SetCertFromPKCS12File.
+func SetCertFromPKCS12File(file, password string) *Client {
+	return defaultClient.SetCertFromPKCS12File(file, password)
+}
+
+// SetCertFromFileAutoReload is a global wrapper methods which delegated
+// to the default client's Client.SetCertFromFileAutoReload.
+func SetCertFromFileAutoReload(certFile, keyFile, password string) *Client {
+	return defaultClient.SetCertFromFileAutoReload(certFile, keyFile, password)
+}
+
+// SetClientCertificateFunc is a global wrapper methods which delegated
+// to the default client's Client.SetClientCertificateFunc.
+func SetClientCertificateFunc(fn func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) *Client {
+	return defaultClient.SetClientCertificateFunc(fn)
+}
+
 // SetCerts is a global wrapper methods which delegated
 // to the default client's Client.SetCerts.
 func SetCerts(certs ...tls.Certificate) *Client {
 	return defaultClient.SetCerts(certs...)
 }
 
+// SetECHConfigList is a global wrapper methods which delegated
+// to the default client's Client.SetECHConfigList.
+func SetECHConfigList(list []byte) *Client {
+	return defaultClient.SetECHConfigList(list)
+}
+
+// EnableECHFromDNS is a global wrapper methods which delegated
+// to the default client's Client.EnableECHFromDNS.
+func EnableECHFromDNS() *Client {
+	return defaultClient.EnableECHFromDNS()
+}
+
+// EnableECHRequired is a global wrapper methods which delegated
+// to the default client's Client.EnableECHRequired.
+func EnableECHRequired() *Client {
+	return defaultClient.EnableECHRequired()
+}
+
+// DisableECHRequired is a global wrapper methods which delegated
+// to the default client's Client.DisableECHRequired.
+func DisableECHRequired() *Client {
+	return defaultClient.DisableECHRequired()
+}
+
+// SetECHConfigLookup is a global wrapper methods which delegated
+// to the default client's Client.SetECHConfigLookup.
+func SetECHConfigLookup(fn ECHConfigLookupFunc) *Client {
+	return defaultClient.SetECHConfigLookup(fn)
+}
+
+// SetCertificatePins is a global wrapper methods which delegated
+// to the default client's Client.SetCertificatePins.
+func SetCertificatePins(host string, pins ...string) *Client {
+	return defaultClient.SetCertificatePins(host, pins...)
+}
+
+// SetVerifyPeerCertificate is a global wrapper methods which delegated
+// to the default client's Client.SetVerifyPeerCertificate.
+func SetVerifyPeerCertificate(fn func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) *Client {
+	return defaultClient.SetVerifyPeerCertificate(fn)
+}
+
+// SetTLSKeyLogFile is a global wrapper methods which delegated
+// to the default client's Client.SetTLSKeyLogFile.
+func SetTLSKeyLogFile(path string) *Client {
+	return defaultClient.SetTLSKeyLogFile(path)
+}
+
+// EnableRevocationCheck is a global wrapper methods which delegated
+// to the default client's Client.EnableRevocationCheck.
+func EnableRevocationCheck(opts *RevocationOptions) *Client {
+	return defaultClient.EnableRevocationCheck(opts)
+}
+
+// DisableRevocationCheck is a global wrapper methods which delegated
+// to the default client's Client.DisableRevocationCheck.
+func DisableRevocationCheck() *Client {
+	return defaultClient.DisableRevocationCheck()
+}
+
 // SetRootCertFromString is a global wrapper methods which delegated
 // to the default client's Client.SetRootCertFromString.
 func SetRootCertFromString(pemContent string) *Client {
@@ -309,6 +394,48 @@ func EnableDumpAllWithoutBody() *Client {
 	return defaultClient.EnableDumpAllWithoutBody()
 }
 
+// EnableHARRecording is a global wrapper methods which delegated
+// to the default client's Client.EnableHARRecording.
+func EnableHARRecording() *Client {
+	return defaultClient.EnableHARRecording()
+}
+
+// DisableHARRecording is a global wrapper methods which delegated
+// to the default client's Client.DisableHARRecording.
+func DisableHARRecording() *Client {
+	return defaultClient.DisableHARRecording()
+}
+
+// SetHARRecorder is a global wrapper methods which delegated
+// to the default client's Client.SetHARRecorder.
+func SetHARRecorder(rec *HARRecorder) *Client {
+	return defaultClient.SetHARRecorder(rec)
+}
+
+// EnableRecording is a global wrapper methods which delegated
+// to the default client's Client.EnableRecording.
+func EnableRecording(cassetteFile string) *Client {
+	return defaultClient.EnableRecording(cassetteFile)
+}
+
+// DisableRecording is a global wrapper methods which delegated
+// to the default client's Client.DisableRecording.
+func DisableRecording() *Client {
+	return defaultClient.DisableRecording()
+}
+
+// SetCassette is a global wrapper methods which delegated
+// to the default client's Client.SetCassette.
+func SetCassette(cassette *Cassette) *Client {
+	return defaultClient.SetCassette(cassette)
+}
+
+// SetFaultInjector is a global wrapper methods which delegated
+// to the default client's Client.SetFaultInjector.
+func SetFaultInjector(f *FaultInjector) *Client {
+	return defaultClient.SetFaultInjector(f)
+}
+
 // EnableDumpEachRequest is a global wrapper methods which delegated
 // to the default client's Client.EnableDumpEachRequest.
 func EnableDumpEachRequest() *Client {
@@ -459,6 +586,24 @@ func SetHTTP2ConnectionFlow(flow uint32) *Client {
 	return defaultClient.SetHTTP2ConnectionFlow(flow)
 }
 
+// SetHTTP3Settings is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3Settings.
+func SetHTTP3Settings(settings ...HTTP3Setting) *Client {
+	return defaultClient.SetHTTP3Settings(settings...)
+}
+
+// SetHTTP3PseudoHeaderOrder is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3PseudoHeaderOrder.
+func SetHTTP3PseudoHeaderOrder(keys ...string) *Client {
+	return defaultClient.SetHTTP3PseudoHeaderOrder(keys...)
+}
+
+// SetQUICParameters is a global wrapper methods which delegated
+// to the default client's Client.SetQUICParameters.
+func SetQUICParameters(params *QUICParameters) *Client {
+	return defaultClient.SetQUICParameters(params)
+}
+
 // SetHTTP2HeaderPriority is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2HeaderPriority.
 func SetHTTP2HeaderPriority(priority http2.PriorityParam) *Client {
@@ -519,6 +664,24 @@ func ImpersonateSafari() *Client {
 	return defaultClient.ImpersonateFirefox()
 }
 
+// ImpersonateFromFingerprint is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateFromFingerprint.
+func ImpersonateFromFingerprint(tlsFingerprint, akamaiH2 string, headerOrder ...string) *Client {
+	return defaultClient.ImpersonateFromFingerprint(tlsFingerprint, akamaiH2, headerOrder...)
+}
+
+// Impersonate is a global wrapper methods which delegated
+// to the default client's Client.Impersonate.
+func Impersonate(id string) *Client {
+	return defaultClient.Impersonate(id)
+}
+
+// ImpersonateProfile is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateProfile.
+func ImpersonateProfile(p *ImpersonationProfile) *Client {
+	return defaultClient.ImpersonateProfile(p)
+}
+
 // SetCommonContentType is a global wrapper methods which delegated
 // to the default client's Client.SetCommonContentType.
 func SetCommonContentType(ct string) *Client {
@@ -543,6 +706,24 @@ func SetProxy(proxy func(*http.Request) (*url.URL, error)) *Client {
 	return defaultClient.SetProxy(proxy)
 }
 
+// SetProxyPool is a global wrapper methods which delegated
+// to the default client's Client.SetProxyPool.
+func SetProxyPool(pool *ProxyPool) *Client {
+	return defaultClient.SetProxyPool(pool)
+}
+
+// EnableHTTP2Proxy is a global wrapper methods which delegated
+// to the default client's Client.EnableHTTP2Proxy.
+func EnableHTTP2Proxy() *Client {
+	return defaultClient.EnableHTTP2Proxy()
+}
+
+// DisableHTTP2Proxy is a global wrapper methods which delegated
+// to the default client's Client.DisableHTTP2Proxy.
+func DisableHTTP2Proxy() *Client {
+	return defaultClient.DisableHTTP2Proxy()
+}
+
 // OnBeforeRequest is a global wrapper methods which delegated
 // to the default client's Client.OnBeforeRequest.
 func OnBeforeRequest(m RequestMiddleware) *Client {
@@ -561,6 +742,12 @@ func SetProxyURL(proxyUrl string) *Client {
 	return defaultClient.SetProxyURL(proxyUrl)
 }
 
+// SetProxyChain is a global wrapper methods which delegated
+// to the default client's Client.SetProxyChain.
+func SetProxyChain(proxyURLs ...string) *Client {
+	return defaultClient.SetProxyChain(proxyURLs...)
+}
+
 // DisableTraceAll is a global wrapper methods which delegated
 // to the default client's Client.DisableTraceAll.
 func DisableTraceAll() *Client {
@@ -573,6 +760,18 @@ func EnableTraceAll() *Client {
 	return defaultClient.EnableTraceAll()
 }
 
+// SetMetrics is a global wrapper methods which delegated
+// to the default client's Client.SetMetrics.
+func SetMetrics(m Metrics) *Client {
+	return defaultClient.SetMetrics(m)
+}
+
+// SetConnEventHook is a global wrapper methods which delegated
+// to the default client's Client.SetConnEventHook.
+func SetConnEventHook(hook func(e *ConnEvent)) *Client {
+	return defaultClient.SetConnEventHook(hook)
+}
+
 // SetCookieJar is a global wrapper methods which delegated
 // to the default client's Client.SetCookieJar.
 func SetCookieJar(jar http.CookieJar) *Client {
@@ -749,10 +948,22 @@ func SetUnixSocket(file string) *Client {
 
 // SetResolver is a global wrapper methods which delegated
 // to the default client's Client.SetResolver.
-func SetResolver(r *net.Resolver) *Client {
+func SetResolver(r Resolver) *Client {
 	return defaultClient.SetResolver(r)
 }
 
+// SetIPPreference is a global wrapper methods which delegated
+// to the default client's Client.SetIPPreference.
+func SetIPPreference(p IPPreference) *Client {
+	return defaultClient.SetIPPreference(p)
+}
+
+// SetResolveOverride is a global wrapper methods which delegated
+// to the default client's Client.SetResolveOverride.
+func SetResolveOverride(host string, addrs ...string) *Client {
+	return defaultClient.SetResolveOverride(host, addrs...)
+}
+
 // SetHosts is a global wrapper methods which delegated
 // to the default client's Client.SetHosts.
 func SetHosts(hosts map[string]string) *Client {
@@ -836,3 +1047,21 @@ func NewRequest() *Request {
 func R() *Request {
 	return defaultClient.R()
 }
+
+// RequestFromCurl is a global wrapper methods which delegated
+// to the default client's Client.RequestFromCurl.
+func RequestFromCurl(cmd string) (*Request, error) {
+	return defaultClient.RequestFromCurl(cmd)
+}
+
+// RequestsFromHAR is a global wrapper methods which delegated
+// to the default client's Client.RequestsFromHAR.
+func RequestsFromHAR(filename string) ([]*Request, error) {
+	return defaultClient.RequestsFromHAR(filename)
+}
+
+// RequestFromHAREntry is a global wrapper methods which delegated
+// to the default client's Client.RequestFromHAREntry.
+func RequestFromHAREntry(e *HAREntry) (*Request, error) {
+	return defaultClient.RequestFromHAREntry(e)
+}
@@ -1,9 +1,17 @@
 package req
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // GenerateCurlCommand generates a curl command that is equivalent to the
@@ -128,3 +136,514 @@ func buildCurlCommand(req *http.Request, body []byte) string {
 func shellEscape(s string) string {
 	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
+
+// RequestFromCurl parses a curl command, e.g. copied from the browser
+// devtools with "Copy as cURL", into a request of the client which can be
+// sent with Request.Do:
+//
+//	r, err := client.RequestFromCurl(`curl 'https://api.example.com/users' -H 'Accept: application/json' -d 'name=req'`)
+//	if err != nil {
+//		return err
+//	}
+//	resp := r.Do()
+//
+// The supported options are -X, -H, -d, --data-raw, --data-binary,
+// --data-urlencode, -F, --form-string, -G, -I, -u, -A, -e, -b, --url,
+// --compressed, -k, --http1.1, --http2, --http3, -x and -m, options which
+// do not change the request (e.g. -s, -v, -L, -o) are ignored, and the other
+// ones are rejected. Redirects follow the redirect policy of the client, and
+// --compressed has no effect since the client decompresses responses
+// transparently. The options -k, --http1.1, --http2, --http3, -x and -m,
+// which are not supported by a request, are set on a clone of the client.
+func (c *Client) RequestFromCurl(cmd string) (*Request, error) {
+	args, err := splitShellWords(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl") || strings.EqualFold(args[0], "curl.exe")) {
+		args = args[1:]
+	}
+	cc := &curlCommand{headers: make(http.Header)}
+	if err := cc.parse(args); err != nil {
+		return nil, err
+	}
+	return cc.request(c)
+}
+
+// curlOptionNames maps the short options of curl to their long names.
+var curlOptionNames = map[byte]string{
+	'X': "request", 'H': "header", 'd': "data", 'F': "form", 'u': "user",
+	'A': "user-agent", 'e': "referer", 'b': "cookie", 'k': "insecure",
+	'x': "proxy", 'm': "max-time", 'G': "get", 'I': "head", 'o': "output",
+	's': "silent", 'S': "show-error", 'v': "verbose", 'i': "include",
+	'L': "location", 'f': "fail", 'g': "globoff", 'N': "no-buffer",
+	'#': "progress-bar",
+}
+
+// curlOptionsWithArg are the long names of the curl options which have an
+// argument.
+var curlOptionsWithArg = map[string]bool{
+	"request": true, "header": true, "data": true, "data-ascii": true,
+	"data-raw": true, "data-binary": true, "data-urlencode": true,
+	"form": true, "form-string": true, "user": true, "user-agent": true,
+	"referer": true, "cookie": true, "url": true, "proxy": true,
+	"max-time": true, "output": true, "connect-timeout": true,
+	"retry": true, "max-redirs": true,
+}
+
+// curlIgnoredOptions are the long names of the curl options which do not
+// change the request.
+var curlIgnoredOptions = map[string]bool{
+	"output": true, "connect-timeout": true, "retry": true,
+	"max-redirs": true, "silent": true, "show-error": true, "verbose": true,
+	"include": true, "location": true, "fail": true, "globoff": true,
+	"no-buffer": true, "progress-bar": true, "compressed": true,
+}
+
+// curlFormPart is a part of a multipart form set with -F or --form-string.
+type curlFormPart struct {
+	name, value string
+	file        string // path of the file to upload, if any
+	fileName    string
+	contentType string
+}
+
+// curlCommand is a parsed curl command.
+type curlCommand struct {
+	method      string
+	url         string
+	headers     http.Header
+	data        []string
+	form        []curlFormPart
+	user        string
+	get, head   bool
+	insecure    bool
+	httpVersion string
+	proxy       string
+	timeout     time.Duration
+}
+
+func (cc *curlCommand) parse(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var names []string
+		var attached string // argument attached to a short option, e.g. -XPOST
+		switch {
+		case strings.HasPrefix(arg, "--") && len(arg) > 2:
+			names = []string{arg[2:]}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				name, ok := curlOptionNames[arg[j]]
+				if !ok {
+					return fmt.Errorf("unsupported curl option -%c", arg[j])
+				}
+				names = append(names, name)
+				if curlOptionsWithArg[name] {
+					attached = arg[j+1:]
+					break
+				}
+			}
+		default:
+			if cc.url != "" {
+				return fmt.Errorf("unexpected curl argument %q", arg)
+			}
+			cc.url = arg
+			continue
+		}
+		for _, name := range names {
+			var value string
+			if curlOptionsWithArg[name] {
+				if attached != "" {
+					value = attached
+				} else if i++; i < len(args) {
+					value = args[i]
+				} else {
+					return fmt.Errorf("missing argument of curl option --%s", name)
+				}
+			}
+			if err := cc.option(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	if cc.url == "" {
+		return errors.New("missing url in curl command")
+	}
+	return nil
+}
+
+func (cc *curlCommand) option(name, value string) error {
+	switch name {
+	case "request":
+		cc.method = value
+	case "header":
+		k, v, ok := strings.Cut(value, ":")
+		if !ok {
+			return fmt.Errorf("bad curl header %q", value)
+		}
+		// "Name:" removes the header in curl, there is nothing to remove.
+		if v = strings.TrimSpace(v); v != "" {
+			cc.headers.Add(strings.TrimSpace(k), v)
+		}
+	case "data", "data-ascii":
+		if file, ok := strings.CutPrefix(value, "@"); ok {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			value = strings.NewReplacer("\r", "", "\n", "").Replace(string(b))
+		}
+		cc.data = append(cc.data, value)
+	case "data-raw":
+		cc.data = append(cc.data, value)
+	case "data-binary":
+		if file, ok := strings.CutPrefix(value, "@"); ok {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			value = string(b)
+		}
+		cc.data = append(cc.data, value)
+	case "data-urlencode":
+		data, err := curlURLEncode(value)
+		if err != nil {
+			return err
+		}
+		cc.data = append(cc.data, data)
+	case "form", "form-string":
+		part, err := parseCurlFormPart(value, name == "form-string")
+		if err != nil {
+			return err
+		}
+		cc.form = append(cc.form, part)
+	case "user":
+		cc.user = value
+	case "user-agent":
+		cc.headers.Set("User-Agent", value)
+	case "referer":
+		cc.headers.Set("Referer", value)
+	case "cookie":
+		if !strings.Contains(value, "=") {
+			return fmt.Errorf("curl cookie file %q is not supported", value)
+		}
+		cc.headers.Add("Cookie", value)
+	case "url":
+		cc.url = value
+	case "get":
+		cc.get = true
+	case "head":
+		cc.head = true
+	case "insecure":
+		cc.insecure = true
+	case "http1.1", "http2", "http2-prior-knowledge", "http3", "http3-only":
+		cc.httpVersion = name
+	case "proxy":
+		cc.proxy = value
+	case "max-time":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("bad curl max time %q", value)
+		}
+		cc.timeout = time.Duration(seconds * float64(time.Second))
+	default:
+		if !curlIgnoredOptions[name] {
+			return fmt.Errorf("unsupported curl option --%s", name)
+		}
+	}
+	return nil
+}
+
+// curlURLEncode returns the data of --data-urlencode, which is "content",
+// "=content", "name=content", "@file" or "name@file".
+func curlURLEncode(value string) (string, error) {
+	if i := strings.IndexAny(value, "=@"); i >= 0 {
+		name, content := value[:i], value[i+1:]
+		if value[i] == '@' {
+			b, err := os.ReadFile(content)
+			if err != nil {
+				return "", err
+			}
+			content = string(b)
+		}
+		if name == "" {
+			return url.QueryEscape(content), nil
+		}
+		return name + "=" + url.QueryEscape(content), nil
+	}
+	return url.QueryEscape(value), nil
+}
+
+// parseCurlFormPart parses the argument of -F, which is "name=value",
+// "name=@file" or "name=<file" with optional ";type=" and ";filename="
+// parameters, or of --form-string, which is a literal "name=value".
+func parseCurlFormPart(value string, literal bool) (curlFormPart, error) {
+	name, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return curlFormPart{}, fmt.Errorf("bad curl form %q", value)
+	}
+	part := curlFormPart{name: name, value: v}
+	if literal || (!strings.HasPrefix(v, "@") && !strings.HasPrefix(v, "<")) {
+		return part, nil
+	}
+	params := strings.Split(v[1:], ";")
+	path := params[0]
+	for _, p := range params[1:] {
+		k, pv, _ := strings.Cut(p, "=")
+		switch strings.TrimSpace(k) {
+		case "type":
+			part.contentType = pv
+		case "filename":
+			part.fileName = pv
+		}
+	}
+	if v[0] == '<' {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return curlFormPart{}, err
+		}
+		part.value = string(b)
+		return part, nil
+	}
+	part.value = ""
+	part.file = path
+	if part.fileName == "" {
+		part.fileName = filepath.Base(path)
+	}
+	return part, nil
+}
+
+func (cc *curlCommand) request(c *Client) (*Request, error) {
+	if cc.insecure || cc.httpVersion != "" || cc.proxy != "" || cc.timeout > 0 {
+		c = c.Clone()
+		if cc.insecure {
+			c.EnableInsecureSkipVerify()
+		}
+		switch cc.httpVersion {
+		case "http1.1":
+			c.EnableForceHTTP1()
+		case "http2", "http2-prior-knowledge":
+			c.EnableForceHTTP2()
+		case "http3", "http3-only":
+			c.EnableForceHTTP3()
+		}
+		if cc.proxy != "" {
+			proxy := cc.proxy
+			if !strings.Contains(proxy, "://") {
+				proxy = "http://" + proxy
+			}
+			c.SetProxyURL(proxy)
+		}
+		if cc.timeout > 0 {
+			c.SetTimeout(cc.timeout)
+		}
+	}
+
+	r := c.R()
+	rawURL := cc.url
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	if cc.get && len(cc.data) > 0 {
+		sep := "?"
+		if strings.Contains(rawURL, "?") {
+			sep = "&"
+		}
+		rawURL += sep + strings.Join(cc.data, "&")
+	}
+	r.SetURL(rawURL)
+	r.Headers = cc.headers
+
+	switch {
+	case cc.method != "":
+		r.Method = cc.method
+	case cc.head:
+		r.Method = http.MethodHead
+	case (len(cc.data) > 0 && !cc.get) || len(cc.form) > 0:
+		r.Method = http.MethodPost
+	default:
+		r.Method = http.MethodGet
+	}
+
+	if cc.user != "" {
+		username, password, _ := strings.Cut(cc.user, ":")
+		r.SetBasicAuth(username, password)
+	}
+	if len(cc.data) > 0 && !cc.get {
+		r.SetBodyString(strings.Join(cc.data, "&"))
+		if r.Headers.Get("Content-Type") == "" {
+			r.SetContentType("application/x-www-form-urlencoded")
+		}
+	}
+	if len(cc.form) > 0 {
+		r.EnableForceMultipart()
+		for _, part := range cc.form {
+			if part.file == "" {
+				r.SetOrderedFormData(part.name, part.value)
+				continue
+			}
+			path := part.file
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			r.SetFileUpload(FileUpload{
+				ParamName: part.name,
+				FileName:  part.fileName,
+				GetFileContent: func() (io.ReadCloser, error) {
+					return os.Open(path)
+				},
+				FileSize:    info.Size(),
+				ContentType: part.contentType,
+			})
+		}
+	}
+	return r, nil
+}
+
+// splitShellWords splits the POSIX shell command s into words, handling
+// single quotes, double quotes, ANSI-C $'...' quotes, backslash escapes and
+// line continuations.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '\\':
+			if i+1 < len(s) {
+				i++
+				if s[i] == '\n' { // line continuation
+					continue
+				}
+				if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+					i++
+					continue
+				}
+				word.WriteByte(s[i])
+			}
+			inWord = true
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote in command")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := readANSICQuote(s[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 1
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated double quote in command")
+			}
+			inWord = true
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// readANSICQuote writes the content of the $'...' quote, which s starts
+// after, to w, and returns the length of the quote in s including the
+// closing quote.
+func readANSICQuote(s string, w *strings.Builder) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				break
+			}
+			i++
+			switch c := s[i]; c {
+			case 'n':
+				w.WriteByte('\n')
+			case 't':
+				w.WriteByte('\t')
+			case 'r':
+				w.WriteByte('\r')
+			case 'a':
+				w.WriteByte('\a')
+			case 'b':
+				w.WriteByte('\b')
+			case 'e', 'E':
+				w.WriteByte(0x1b)
+			case 'f':
+				w.WriteByte('\f')
+			case 'v':
+				w.WriteByte('\v')
+			case 'x', 'u', 'U':
+				digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+				j := i + 1
+				for j < len(s) && j < i+1+digits && isHexDigit(s[j]) {
+					j++
+				}
+				if j == i+1 {
+					w.WriteByte('\\')
+					w.WriteByte(c)
+					continue
+				}
+				v, _ := strconv.ParseUint(s[i+1:j], 16, 32)
+				if c == 'x' {
+					w.WriteByte(byte(v))
+				} else {
+					w.WriteRune(rune(v))
+				}
+				i = j - 1
+			default:
+				if c >= '0' && c <= '7' {
+					j := i
+					for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+						j++
+					}
+					v, _ := strconv.ParseUint(s[i:j], 8, 8)
+					w.WriteByte(byte(v))
+					i = j - 1
+					continue
+				}
+				// \\, \', \" and unknown escapes.
+				if c != '\\' && c != '\'' && c != '"' && c != '?' {
+					w.WriteByte('\\')
+				}
+				w.WriteByte(c)
+			}
+			continue
+		default:
+			w.WriteByte(s[i])
+		}
+	}
+	return 0, errors.New("unterminated $' quote in command")
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -132,3 +132,82 @@ func TestGenerateCurlCommandHostOverride(t *testing.T) {
 		t.Fatalf("expected Host header override in curl command, got: %s", cmd)
 	}
 }
+
+func TestSplitShellWords(t *testing.T) {
+	words, err := splitShellWords(`curl 'a b' "c \"d\" \$e" f\ g \
+  $'h\'i\nj\x41é' k"l"'m'`)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []string{"curl", "a b", `c "d" $e`, "f g", "h'i\njAé", "klm"}, words)
+
+	_, err = splitShellWords(`curl 'a`)
+	tests.AssertErrorContains(t, err, "unterminated single quote")
+}
+
+// curlEcho is the request echoed by the "/curl/" paths of the test server.
+type curlEcho struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+func doCurl(t *testing.T, c *Client, cmd string) *curlEcho {
+	t.Helper()
+	r, err := c.RequestFromCurl(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var echo curlEcho
+	resp := r.SetSuccessResult(&echo).Do()
+	assertSuccess(t, resp, resp.Err)
+	return &echo
+}
+
+func TestRequestFromCurl(t *testing.T) {
+	base := getTestServerURL() + "/curl"
+	c := tc()
+
+	echo := doCurl(t, c, `curl '`+base+`/users?page=2' -H 'Accept: application/json' -H 'x-token: abc' --compressed -sSL`)
+	tests.AssertEqual(t, http.MethodGet, echo.Method)
+	tests.AssertEqual(t, "/curl/users?page=2", echo.URL)
+	tests.AssertEqual(t, "application/json", echo.Header.Get("Accept"))
+	tests.AssertEqual(t, "abc", echo.Header.Get("X-Token"))
+
+	echo = doCurl(t, c, `curl `+base+` -d name=req -d 'lang=go'`)
+	tests.AssertEqual(t, http.MethodPost, echo.Method)
+	tests.AssertEqual(t, "name=req&lang=go", echo.Body)
+	tests.AssertEqual(t, "application/x-www-form-urlencoded", echo.Header.Get("Content-Type"))
+
+	echo = doCurl(t, c, `curl -XPUT `+base+` -H 'Content-Type: application/json' --data-raw $'{"name":"req\'s"}' -u imroc:123456`)
+	tests.AssertEqual(t, http.MethodPut, echo.Method)
+	tests.AssertEqual(t, `{"name":"req's"}`, echo.Body)
+	tests.AssertEqual(t, "application/json", echo.Header.Get("Content-Type"))
+	tests.AssertEqual(t, "Basic aW1yb2M6MTIzNDU2", echo.Header.Get("Authorization"))
+
+	echo = doCurl(t, c, `curl -G `+base+`/search --data-urlencode 'q=a b' -b 'sid=abc; theme=dark' -A test-agent`)
+	tests.AssertEqual(t, http.MethodGet, echo.Method)
+	tests.AssertEqual(t, "/curl/search?q=a+b", echo.URL)
+	tests.AssertEqual(t, "sid=abc; theme=dark", echo.Header.Get("Cookie"))
+	tests.AssertEqual(t, "test-agent", echo.Header.Get("User-Agent"))
+
+	echo = doCurl(t, c, `curl `+base+` -F name=req -F 'file=@`+tests.GetTestFilePath("sample-file.txt")+`;type=text/plain'`)
+	tests.AssertEqual(t, http.MethodPost, echo.Method)
+	tests.AssertContains(t, echo.Header.Get("Content-Type"), "multipart/form-data", true)
+	tests.AssertContains(t, echo.Body, `name="name"`, true)
+	tests.AssertContains(t, echo.Body, `filename="sample-file.txt"`, true)
+	tests.AssertContains(t, echo.Body, "content-type: text/plain", true)
+
+	c = C()
+	r, err := c.RequestFromCurl(`curl -k --http1.1 https://example.com`)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, r.client != c)
+	tests.AssertEqual(t, true, r.client.TLSClientConfig.InsecureSkipVerify)
+	tests.AssertEqual(t, false, c.TLSClientConfig.InsecureSkipVerify)
+
+	_, err = c.RequestFromCurl(`curl --unknown https://example.com`)
+	tests.AssertErrorContains(t, err, "unsupported curl option --unknown")
+	_, err = c.RequestFromCurl(`curl -H`)
+	tests.AssertErrorContains(t, err, "missing argument")
+	_, err = c.RequestFromCurl(`curl -s`)
+	tests.AssertErrorContains(t, err, "missing url")
+}
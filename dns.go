@@ -0,0 +1,328 @@
+package req
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsExchangeFunc sends DNS queries and returns their responses, in order.
+type dnsExchangeFunc func(ctx context.Context, queries [][]byte) ([][]byte, error)
+
+// newDNSQuery returns a recursive query of the records of type typ of host,
+// with an EDNS(0) OPT record advertising udpSize if it is not zero.
+func newDNSQuery(host string, typ dnsmessage.Type, id, udpSize uint16) ([]byte, error) {
+	name, err := dnsmessage.NewName(dnsFQDN(host))
+	if err != nil {
+		return nil, err
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err = b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err = b.Question(dnsmessage.Question{Name: name, Type: typ, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	if udpSize > 0 {
+		if err = b.StartAdditionals(); err != nil {
+			return nil, err
+		}
+		var rh dnsmessage.ResourceHeader
+		if err = rh.SetEDNS0(int(udpSize), dnsmessage.RCodeSuccess, false); err != nil {
+			return nil, err
+		}
+		if err = b.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// lookupDNS resolves host with exchange, the IPv4 addresses first, and
+// returns the smallest TTL of the records.
+func lookupDNS(ctx context.Context, exchange dnsExchangeFunc, network, host string, randomIDs bool) ([]netip.Addr, time.Duration, error) {
+	var types []dnsmessage.Type
+	switch network {
+	case "ip4":
+		types = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6":
+		types = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		types = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	}
+	queries := make([][]byte, len(types))
+	for i, typ := range types {
+		var id uint16
+		if randomIDs {
+			var b [2]byte
+			rand.Read(b[:])
+			id = binary.BigEndian.Uint16(b[:])
+		}
+		q, err := newDNSQuery(host, typ, id, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		queries[i] = q
+	}
+	responses, err := exchange(ctx, queries)
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, IsTemporary: true}
+	}
+
+	var addrs []netip.Addr
+	var ttl time.Duration
+	var firstErr error
+	for _, resp := range responses {
+		a, t, err := parseDNSResponse(resp, host)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		addrs = append(addrs, a...)
+		if len(a) > 0 && (ttl == 0 || t < ttl) {
+			ttl = t
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs, ttl, nil
+	}
+	var dnsErr *net.DNSError
+	if errors.As(firstErr, &dnsErr) && dnsErr.IsNotFound {
+		return nil, negativeTTL, firstErr
+	}
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	return nil, negativeTTL, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// parseDNSResponse returns the addresses of the A and AAAA records of the
+// answer, following CNAMEs is left to the recursive server.
+func parseDNSResponse(resp []byte, host string) ([]netip.Addr, time.Duration, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+	}
+	switch h.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	default:
+		return nil, 0, &net.DNSError{Err: "server misbehaving: " + h.RCode.String(), Name: host, IsTemporary: true}
+	}
+	if err = p.SkipAllQuestions(); err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+	}
+	var addrs []netip.Addr
+	var ttl time.Duration
+	for {
+		rh, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+		}
+		var addr netip.Addr
+		switch rh.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+			}
+			addr = netip.AddrFrom4(r.A)
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+			}
+			addr = netip.AddrFrom16(r.AAAA)
+		default:
+			if err = p.SkipAnswer(); err != nil {
+				return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+			}
+			continue
+		}
+		addrs = append(addrs, addr)
+		if d := time.Duration(rh.TTL) * time.Second; len(addrs) == 1 || d < ttl {
+			ttl = d
+		}
+	}
+	return addrs, ttl, nil
+}
+
+// resolverExchange returns the function which sends the DNS queries of r,
+// nil if r does not send them itself, e.g. *net.Resolver.
+func resolverExchange(r Resolver) dnsExchangeFunc {
+	switch r := r.(type) {
+	case *DoHResolver:
+		return r.exchange
+	case *DoTResolver:
+		return r.exchange
+	case *CachingResolver:
+		return resolverExchange(r.r)
+	}
+	return nil
+}
+
+// DoHResolver resolves host names with a DNS over HTTPS server (RFC 8484),
+// see NewDoHResolver.
+type DoHResolver struct {
+	url    string
+	client *Client
+}
+
+// NewDoHResolver returns a resolver which sends the DNS queries to the DNS
+// over HTTPS server at serverURL, e.g. "https://1.1.1.1/dns-query", with
+// the bootstrap client, or C() if nil. The bootstrap client must not use
+// the resolver itself, use an IP address in serverURL or
+// Client.SetResolveOverride on the bootstrap client to not depend on the
+// system resolver.
+func NewDoHResolver(serverURL string, bootstrap *Client) *DoHResolver {
+	if bootstrap == nil {
+		bootstrap = C()
+	}
+	return &DoHResolver{url: serverURL, client: bootstrap}
+}
+
+// LookupNetIP implements Resolver.
+func (r *DoHResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, _, err := r.lookupNetIPTTL(ctx, network, host)
+	return addrs, err
+}
+
+func (r *DoHResolver) lookupNetIPTTL(ctx context.Context, network, host string) ([]netip.Addr, time.Duration, error) {
+	// The ID is 0 so that the responses can be cached by HTTP caches.
+	return lookupDNS(ctx, r.exchange, network, host, false)
+}
+
+func (r *DoHResolver) exchange(ctx context.Context, queries [][]byte) ([][]byte, error) {
+	responses := make([][]byte, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Go(func() {
+			resp, err := r.client.R().
+				SetContext(ctx).
+				SetHeader("Accept", "application/dns-message").
+				SetContentType("application/dns-message").
+				SetBodyBytes(query).
+				Post(r.url)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				errs[i] = fmt.Errorf("unexpected status %s from %s", resp.Status, r.url)
+				return
+			}
+			responses[i] = resp.Bytes()
+		})
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+// DoTResolver resolves host names with a DNS over TLS server (RFC 7858),
+// see NewDoTResolver.
+type DoTResolver struct {
+	addr      string
+	tlsConfig *tls.Config
+}
+
+// NewDoTResolver returns a resolver which sends the DNS queries to the DNS
+// over TLS server at addr, e.g. "1.1.1.1:853" or "dns.example.com", the port
+// is 853 by default. The ServerName of tlsConfig, which may be nil,
+// defaults to the host of addr.
+func NewDoTResolver(addr string, tlsConfig *tls.Config) *DoTResolver {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		addr = net.JoinHostPort(addr, "853")
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	return &DoTResolver{addr: addr, tlsConfig: tlsConfig}
+}
+
+// LookupNetIP implements Resolver.
+func (r *DoTResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, _, err := r.lookupNetIPTTL(ctx, network, host)
+	return addrs, err
+}
+
+func (r *DoTResolver) lookupNetIPTTL(ctx context.Context, network, host string) ([]netip.Addr, time.Duration, error) {
+	return lookupDNS(ctx, r.exchange, network, host, true)
+}
+
+// exchange pipelines the queries over a new connection.
+func (r *DoTResolver) exchange(ctx context.Context, queries [][]byte) ([][]byte, error) {
+	d := tls.Dialer{Config: r.tlsConfig}
+	conn, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	var buf []byte
+	for _, q := range queries {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(q)))
+		buf = append(buf, q...)
+	}
+	if _, err = conn.Write(buf); err != nil {
+		return nil, err
+	}
+	responses := make([][]byte, len(queries))
+	for range queries {
+		var l [2]byte
+		if _, err = io.ReadFull(conn, l[:]); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err = io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		if len(resp) < 2 {
+			return nil, errors.New("short DNS response")
+		}
+		// The responses may come out of order (RFC 7766).
+		i := 0
+		for i < len(queries) && (responses[i] != nil || queries[i][0] != resp[0] || queries[i][1] != resp[1]) {
+			i++
+		}
+		if i == len(queries) {
+			return nil, errors.New("unexpected DNS response ID")
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
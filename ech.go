@@ -0,0 +1,316 @@
+package req
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ECHConfigLookupFunc returns the ECHConfigList of host used for Encrypted
+// Client Hello, or nil if host does not support ECH.
+type ECHConfigLookupFunc func(ctx context.Context, host string) ([]byte, error)
+
+// echNegativeTTL is how long the absence of an ECH configuration is cached.
+const echNegativeTTL = 5 * time.Minute
+
+// SetECHConfigLookup set the function which returns the ECHConfigList of
+// each host, the ClientHello is encrypted if it returns a non-empty list.
+// A configuration set by Client.SetECHConfigList takes precedence.
+//
+// Note it is not used by HTTP3 and for the TLS handshake with the proxy.
+func (t *Transport) SetECHConfigLookup(fn ECHConfigLookupFunc) *Transport {
+	t.echLookup = fn
+	t.echCache = nil
+	return t
+}
+
+// EnableECHRequired makes the requests fail if the ECH configuration of
+// their host can not be looked up, by default the ClientHello is sent
+// without ECH in this case.
+func (t *Transport) EnableECHRequired() *Transport {
+	t.echRequired = true
+	return t
+}
+
+// DisableECHRequired sends the ClientHello without ECH if the ECH
+// configuration of the host can not be looked up, which is the default.
+func (t *Transport) DisableECHRequired() *Transport {
+	t.echRequired = false
+	return t
+}
+
+// EnableECHFromDNS retrieves the ECHConfigList of each host from the "ech"
+// parameter of its DNS HTTPS record (RFC 9460), the results are cached
+// until their TTL expire. The record is queried with the resolver of
+// SetResolver if it is a DoH or DoT resolver, possibly wrapped by
+// NewCachingResolver, or from the first nameserver of /etc/resolv.conf
+// otherwise. On systems without /etc/resolv.conf, e.g. Windows, a DoH or
+// DoT resolver is needed. Hosts without an HTTPS record are contacted
+// without ECH, as well as the hosts whose record can not be queried,
+// unless EnableECHRequired is called.
+func (t *Transport) EnableECHFromDNS() *Transport {
+	t.echLookup = nil
+	t.echCache = newECHConfigCache(systemNameserver())
+	return t
+}
+
+// echConfigList returns the ECHConfigList used for the handshake with host,
+// cfg is the TLS configuration of the connection.
+func (t *Transport) echConfigList(ctx context.Context, cfg *tls.Config, host string) ([]byte, error) {
+	if cfg.EncryptedClientHelloConfigList != nil || (t.echLookup == nil && t.echCache == nil) || net.ParseIP(host) != nil {
+		return cfg.EncryptedClientHelloConfigList, nil
+	}
+	var list []byte
+	var err error
+	if t.echCache != nil {
+		list, err = t.echCache.lookup(ctx, host, resolverExchange(t.resolver))
+	} else {
+		list, err = t.echLookup(ctx, host)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to lookup ech config of %s: %w", host, err)
+		if t.echRequired {
+			return nil, err
+		}
+		if t.Debugf != nil {
+			t.Debugf("%s, ech is disabled for the connection", err.Error())
+		}
+		return nil, nil
+	}
+	return list, nil
+}
+
+type echCacheEntry struct {
+	list    []byte
+	expires time.Time
+}
+
+// echConfigCache looks up ECHConfigLists in DNS and caches them.
+type echConfigCache struct {
+	// nameserver is queried if the resolver does not send DNS queries,
+	// empty if there is no system nameserver.
+	nameserver string
+
+	mu      sync.Mutex
+	entries map[string]echCacheEntry
+}
+
+func newECHConfigCache(nameserver string) *echConfigCache {
+	return &echConfigCache{
+		nameserver: nameserver,
+		entries:    make(map[string]echCacheEntry),
+	}
+}
+
+// lookup returns the ECHConfigList of host, queried with exchange or from
+// the nameserver of the cache if it is nil.
+func (c *echConfigCache) lookup(ctx context.Context, host string, exchange dnsExchangeFunc) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.list, nil
+	}
+	if exchange == nil {
+		if c.nameserver == "" {
+			return nil, errNoNameserver
+		}
+		exchange = nameserverExchange(c.nameserver)
+	}
+	list, ttl, err := lookupECHConfigList(ctx, host, exchange)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		ttl = echNegativeTTL
+	}
+	now := time.Now()
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[host] = echCacheEntry{list: list, expires: now.Add(ttl)}
+	c.mu.Unlock()
+	return list, nil
+}
+
+// echUDPSize is the UDP payload size advertised with EDNS(0) in the
+// queries of HTTPS records, which often exceed 512 bytes.
+const echUDPSize = 1232
+
+// lookupECHConfigList queries the HTTPS record of host with exchange and
+// returns its "ech" parameter with the TTL of the record.
+func lookupECHConfigList(ctx context.Context, host string, exchange dnsExchangeFunc) ([]byte, time.Duration, error) {
+	var id [2]byte
+	rand.Read(id[:])
+	query, err := newDNSQuery(host, dnsmessage.TypeHTTPS, binary.BigEndian.Uint16(id[:]), echUDPSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	responses, err := exchange(ctx, [][]byte{query})
+	if err != nil {
+		return nil, 0, err
+	}
+	return parseECHConfigList(responses[0])
+}
+
+// nameserverExchange returns the function which sends the DNS queries to
+// nameserver, one by one.
+func nameserverExchange(nameserver string) dnsExchangeFunc {
+	return func(ctx context.Context, queries [][]byte) ([][]byte, error) {
+		responses := make([][]byte, len(queries))
+		for i, query := range queries {
+			resp, err := exchangeDNS(ctx, nameserver, query)
+			if err != nil {
+				return nil, err
+			}
+			responses[i] = resp
+		}
+		return responses, nil
+	}
+}
+
+// exchangeDNS sends query to nameserver over UDP, and over TCP if the
+// response is truncated.
+func exchangeDNS(ctx context.Context, nameserver string, query []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", nameserver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, echUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil || h.ID != binary.BigEndian.Uint16(query) || !h.Response {
+			continue // not the answer to the query
+		}
+		if !h.Truncated {
+			return buf[:n], nil
+		}
+		break
+	}
+
+	// Retry over TCP (RFC 7766).
+	tcpConn, err := d.DialContext(ctx, "tcp", nameserver)
+	if err != nil {
+		return nil, err
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(deadline)
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err = tcpConn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+	var l [2]byte
+	if _, err = io.ReadFull(tcpConn, l[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err = io.ReadFull(tcpConn, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || binary.BigEndian.Uint16(resp) != binary.BigEndian.Uint16(query) {
+		return nil, errors.New("unexpected DNS response ID")
+	}
+	return resp, nil
+}
+
+// parseECHConfigList returns the "ech" parameter of the HTTPS record of
+// the DNS response, with the TTL of the record.
+func parseECHConfigList(resp []byte) ([]byte, time.Duration, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, 0, err
+	}
+	if h.RCode == dnsmessage.RCodeNameError {
+		return nil, 0, nil
+	}
+	if h.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("dns query failed: %s", h.RCode)
+	}
+	if err = p.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+	for {
+		rh, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return nil, 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if rh.Type != dnsmessage.TypeHTTPS {
+			if err = p.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		r, err := p.HTTPSResource()
+		if err != nil {
+			return nil, 0, err
+		}
+		if list, ok := r.GetParam(dnsmessage.SVCParamECH); ok && r.Priority != 0 {
+			return list, time.Duration(rh.TTL) * time.Second, nil
+		}
+	}
+}
+
+func dnsFQDN(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+var errNoNameserver = errors.New("no nameserver in /etc/resolv.conf, a DoH or DoT resolver is required")
+
+// systemNameserver returns the first nameserver of /etc/resolv.conf, the
+// local resolver if it has none, like the resolver of the libc, or an
+// empty string if there is no /etc/resolv.conf.
+func systemNameserver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return "127.0.0.1:53"
+}
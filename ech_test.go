@@ -0,0 +1,220 @@
+package req
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/tests"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestECHKey returns an ECH key for servers and the ECHConfigList of
+// clients, using X25519, HKDF-SHA256 and AES-128-GCM.
+func newTestECHKey(t *testing.T, publicName string) (tls.EncryptedClientHelloKey, []byte) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []byte
+	contents = append(contents, 1)                             // config_id
+	contents = binary.BigEndian.AppendUint16(contents, 0x0020) // DHKEM(X25519, HKDF-SHA256)
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(key.PublicKey().Bytes())))
+	contents = append(contents, key.PublicKey().Bytes()...)
+	contents = binary.BigEndian.AppendUint16(contents, 4)
+	contents = binary.BigEndian.AppendUint16(contents, 0x0001) // HKDF-SHA256
+	contents = binary.BigEndian.AppendUint16(contents, 0x0001) // AES-128-GCM
+	contents = append(contents, 0)                             // maximum_name_length
+	contents = append(contents, byte(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = binary.BigEndian.AppendUint16(contents, 0) // extensions
+
+	config := binary.BigEndian.AppendUint16(nil, 0xfe0d)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+	list := binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	list = append(list, config...)
+	return tls.EncryptedClientHelloKey{Config: config, PrivateKey: key.Bytes(), SendAsRetry: true}, list
+}
+
+func TestECH(t *testing.T) {
+	key, list := newTestECHKey(t, "public.example.com")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %t", r.TLS.ServerName, r.TLS.ECHAccepted)
+	}))
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{key}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, c := range []*Client{C(), C().ImpersonateChrome()} {
+		resp, err := c.EnableInsecureSkipVerify().EnableTraceAll().SetECHConfigList(list).R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, " true", resp.String())
+		tests.AssertEqual(t, true, resp.TraceInfo().ECHAccepted)
+	}
+
+	// The configuration is looked up by host name, the inner SNI is the
+	// host name of the request.
+	var lookups []string
+	addr := srv.Listener.Addr().String()
+	c := C().EnableInsecureSkipVerify().EnableTraceAll().
+		SetDial(func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}).
+		SetECHConfigLookup(func(ctx context.Context, host string) ([]byte, error) {
+			lookups = append(lookups, host)
+			return list, nil
+		})
+	resp, err := c.R().Get("https://example.com/")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "example.com true", resp.String())
+	tests.AssertEqual(t, []string{"example.com"}, lookups)
+
+	resp, err = C().EnableInsecureSkipVerify().EnableTraceAll().R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, false, resp.TraceInfo().ECHAccepted)
+
+	// Lookup failures disable ECH, unless it is required.
+	lookupErr := errors.New("lookup failed")
+	c.CloseIdleConnections()
+	c.SetECHConfigLookup(func(ctx context.Context, host string) ([]byte, error) {
+		return nil, lookupErr
+	})
+	resp, err = c.R().Get("https://example.com/")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "example.com false", resp.String())
+	c.CloseIdleConnections()
+	_, err = c.EnableECHRequired().R().Get("https://example.com/")
+	tests.AssertEqual(t, true, errors.Is(err, lookupErr))
+}
+
+func TestLookupECHConfigList(t *testing.T) {
+	_, list := newTestECHKey(t, "public.example.com")
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// The record of large.example.com only fits in TCP responses.
+	answer := func(query []byte, tcp bool) []byte {
+		var p dnsmessage.Parser
+		h, _ := p.Start(query)
+		q, _ := p.Question()
+		p.SkipAllQuestions()
+		p.SkipAllAnswers()
+		p.SkipAllAuthorities()
+		if rh, err := p.AdditionalHeader(); err != nil || rh.Type != dnsmessage.TypeOPT {
+			return nil // no EDNS(0)
+		}
+		h.Response = true
+		h.Truncated = q.Name.String() == "large.example.com." && !tcp
+		b := dnsmessage.NewBuilder(nil, h)
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+		if q.Name.String() == "ech.example.com." || (q.Name.String() == "large.example.com." && tcp) {
+			b.HTTPSResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.HTTPSResource{
+				SVCBResource: dnsmessage.SVCBResource{
+					Priority: 1,
+					Target:   dnsmessage.MustNewName("."),
+					Params:   []dnsmessage.SVCParam{{Key: dnsmessage.SVCParamECH, Value: list}},
+				},
+			})
+		}
+		msg, _ := b.Finish()
+		return msg
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if msg := answer(buf[:n], false); msg != nil {
+				pc.WriteTo(msg, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var l [2]byte
+			io.ReadFull(conn, l[:])
+			query := make([]byte, binary.BigEndian.Uint16(l[:]))
+			io.ReadFull(conn, query)
+			msg := answer(query, true)
+			conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+			conn.Close()
+		}
+	}()
+
+	got, ttl, err := lookupECHConfigList(context.Background(), "ech.example.com", nameserverExchange(pc.LocalAddr().String()))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, list, got)
+	tests.AssertEqual(t, int64(60), int64(ttl.Seconds()))
+
+	got, _, err = lookupECHConfigList(context.Background(), "plain.example.com", nameserverExchange(pc.LocalAddr().String()))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 0, len(got))
+
+	got, _, err = lookupECHConfigList(context.Background(), "large.example.com", nameserverExchange(pc.LocalAddr().String()))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, list, got)
+
+	cache := newECHConfigCache(pc.LocalAddr().String())
+	got, err = cache.lookup(context.Background(), "ech.example.com", nil)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, list, got)
+	tests.AssertEqual(t, 1, len(cache.entries))
+
+	// The expired entries are evicted when an entry is added.
+	cache.entries["expired.example.com"] = echCacheEntry{expires: time.Now().Add(-time.Second)}
+	_, err = cache.lookup(context.Background(), "plain.example.com", nil)
+	tests.AssertNoError(t, err)
+	_, ok := cache.entries["expired.example.com"]
+	tests.AssertEqual(t, false, ok)
+	tests.AssertEqual(t, 2, len(cache.entries))
+
+	// Without system nameserver, a DoH or DoT resolver is required.
+	_, err = newECHConfigCache("").lookup(context.Background(), "ech.example.com", nil)
+	tests.AssertEqual(t, errNoNameserver, err)
+
+	// The HTTPS records are queried with the DoH or DoT resolver.
+	var dohQueries atomic.Int32
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dohQueries.Add(1)
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answer(query, true))
+	}))
+	defer doh.Close()
+	tr := C().SetResolver(NewCachingResolver(NewDoHResolver(doh.URL, C().EnableInsecureSkipVerify()), 0)).
+		EnableECHFromDNS().GetTransport()
+	tr.echCache.nameserver = "127.0.0.1:1"
+	got, err = tr.echConfigList(context.Background(), &tls.Config{}, "large.example.com")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, list, got)
+	tests.AssertEqual(t, int32(1), dohQueries.Load())
+}
@@ -0,0 +1,250 @@
+package req
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// FaultRule is a rule of a FaultInjector, which injects its faults into the
+// matching requests. The matchers which are set must all match, a rule
+// without matchers matches every request.
+type FaultRule struct {
+	// Name identifies the rule in FaultInjector.Injected.
+	Name string
+
+	// Probability is the probability the faults are injected into a
+	// matching request, between 0 and 1, e.g. 1 injects them into all the
+	// matching requests and 0 into none.
+	Probability float64
+
+	// Hosts are the hosts, with or without the port, the requests must be
+	// sent to one of.
+	Hosts []string
+
+	// Paths are the path.Match patterns the path of the requests must
+	// match one of.
+	Paths []string
+
+	// Headers are the headers the requests must have, with the value, or
+	// with any value if it is empty.
+	Headers map[string]string
+
+	// Match, if not nil, must report true for the requests.
+	Match func(req *http.Request) bool
+
+	// Latency delays the requests, or the other faults, by Latency.
+	Latency time.Duration
+
+	// Reset fails the requests with a connection reset by peer error,
+	// without sending them.
+	Reset bool
+
+	// TLSHandshakeFailure fails the requests with a TLS handshake failure
+	// alert, without sending them.
+	TLSHandshakeFailure bool
+
+	// StatusCode, if not zero, replies to the requests with an empty
+	// response of the status, without sending them.
+	StatusCode int
+
+	// TruncateBody, if positive, drops the connection after TruncateBody
+	// bytes of the response body are read, the read fails with
+	// io.ErrUnexpectedEOF.
+	TruncateBody int
+
+	// SlowBody, if positive, makes the response body read byte by byte,
+	// SlowBody apart.
+	SlowBody time.Duration
+}
+
+func (r *FaultRule) match(req *http.Request) bool {
+	if len(r.Hosts) > 0 && !r.matchHost(req) {
+		return false
+	}
+	if len(r.Paths) > 0 && !r.matchPath(req) {
+		return false
+	}
+	for name, value := range r.Headers {
+		values := req.Header.Values(name)
+		if len(values) == 0 || (value != "" && values[0] != value) {
+			return false
+		}
+	}
+	return r.Match == nil || r.Match(req)
+}
+
+func (r *FaultRule) matchHost(req *http.Request) bool {
+	for _, host := range r.Hosts {
+		if host == req.URL.Host || host == req.URL.Hostname() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *FaultRule) matchPath(req *http.Request) bool {
+	for _, pattern := range r.Paths {
+		if ok, _ := path.Match(pattern, req.URL.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FaultInjector injects faults into the requests of a Client or a
+// Transport for chaos testing, e.g. latency, connection resets, TLS
+// handshake failures, error statuses, truncated or slow bodies, to verify
+// the retries, the timeouts and the circuit breaking behave correctly.
+// Each attempt of a request gets the faults of the first rule it matches,
+// if any, see Client.SetFaultInjector.
+//
+// It is safe for concurrent use.
+type FaultInjector struct {
+	rules   []*FaultRule
+	enabled atomic.Bool
+
+	mu       sync.Mutex
+	injected map[string]int
+}
+
+// NewFaultInjector returns an enabled FaultInjector with the rules.
+func NewFaultInjector(rules ...*FaultRule) *FaultInjector {
+	f := &FaultInjector{rules: rules, injected: make(map[string]int)}
+	f.enabled.Store(true)
+	return f
+}
+
+// SetEnabled enables or disables the injection of the faults.
+func (f *FaultInjector) SetEnabled(enabled bool) *FaultInjector {
+	f.enabled.Store(enabled)
+	return f
+}
+
+// Injected returns the number of requests the faults of the rule with the
+// name are injected into.
+func (f *FaultInjector) Injected(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.injected[name]
+}
+
+func (f *FaultInjector) rule(req *http.Request) *FaultRule {
+	if !f.enabled.Load() {
+		return nil
+	}
+	for _, r := range f.rules {
+		if !r.match(req) {
+			continue
+		}
+		if rand.Float64() >= r.Probability {
+			return nil
+		}
+		f.mu.Lock()
+		f.injected[r.Name]++
+		f.mu.Unlock()
+		return r
+	}
+	return nil
+}
+
+func (f *FaultInjector) roundTrip(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	r := f.rule(req)
+	if r == nil {
+		return next(req)
+	}
+	ctx := req.Context()
+	if r.Latency > 0 {
+		if err := sleepContext(ctx, r.Latency); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+	}
+	switch {
+	case r.Reset:
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case r.TLSHandshakeFailure:
+		closeBody(req)
+		return nil, &net.OpError{Op: "remote error", Err: tls.AlertError(40)} // handshake_failure
+	}
+
+	var resp *http.Response
+	if r.StatusCode != 0 {
+		closeBody(req)
+		resp = &http.Response{
+			Status:     strconv.Itoa(r.StatusCode) + " " + http.StatusText(r.StatusCode),
+			StatusCode: r.StatusCode,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}
+	} else {
+		var err error
+		resp, err = next(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.TruncateBody > 0 || r.SlowBody > 0 {
+		resp.Body = &faultBody{ReadCloser: resp.Body, ctx: ctx, rule: r}
+	}
+	return resp, nil
+}
+
+// faultBody injects the body faults of a rule into a response body.
+type faultBody struct {
+	io.ReadCloser
+	ctx  context.Context
+	rule *FaultRule
+	n    int
+}
+
+func (b *faultBody) Read(p []byte) (int, error) {
+	if t := b.rule.TruncateBody; t > 0 {
+		if b.n >= t {
+			return 0, io.ErrUnexpectedEOF
+		}
+		p = p[:min(len(p), t-b.n)]
+	}
+	if d := b.rule.SlowBody; d > 0 && len(p) > 0 {
+		if err := sleepContext(b.ctx, d); err != nil {
+			return 0, err
+		}
+		p = p[:1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n += n
+	return n, err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// SetFaultInjector set the FaultInjector which injects faults into the
+// requests of the transport, nil to disable it.
+func (t *Transport) SetFaultInjector(f *FaultInjector) *Transport {
+	t.faultInjector = f
+	return t
+}
@@ -0,0 +1,83 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+func TestFaultInjector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer srv.Close()
+
+	var calls atomic.Int32
+	faults := NewFaultInjector(
+		&FaultRule{Name: "reset", Probability: 1, Paths: []string{"/reset/*"}, Reset: true},
+		&FaultRule{Name: "tls", Probability: 1, Headers: map[string]string{"X-Fault": "tls"}, TLSHandshakeFailure: true},
+		&FaultRule{Name: "never", Probability: 0, Paths: []string{"/never"}, StatusCode: 500},
+		&FaultRule{Name: "flaky", Probability: 1, Paths: []string{"/flaky"}, StatusCode: http.StatusServiceUnavailable, Match: func(req *http.Request) bool {
+			return calls.Add(1) == 1
+		}},
+		&FaultRule{Name: "truncate", Probability: 1, Hosts: []string{srv.Listener.Addr().String()}, Paths: []string{"/truncate"}, TruncateBody: 5},
+		&FaultRule{Name: "slow", Probability: 1, Hosts: []string{"127.0.0.1"}, Paths: []string{"/slow"}, SlowBody: 5 * time.Millisecond},
+		&FaultRule{Name: "latency", Probability: 1, Paths: []string{"/latency"}, Latency: time.Second},
+	)
+	c := tc().SetFaultInjector(faults)
+
+	_, err := c.R().Get(srv.URL + "/reset/1")
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = c.R().SetHeader("X-Fault", "tls").Get(srv.URL)
+	tests.AssertErrorContains(t, err, "tls: handshake failure")
+
+	resp, err := c.R().Get(srv.URL + "/never")
+	assertSuccess(t, resp, err)
+
+	resp, err = c.R().
+		SetRetryCount(1).
+		SetRetryCondition(func(resp *Response, err error) bool {
+			return err != nil || resp.StatusCode >= 500
+		}).
+		Get(srv.URL + "/flaky")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "hello world", resp.String())
+	tests.AssertEqual(t, 1, resp.Request.RetryAttempt)
+
+	_, err = c.R().Get(srv.URL + "/truncate")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	resp, err = c.R().Get(srv.URL + "/slow")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "hello world", resp.String())
+	tests.AssertEqual(t, true, time.Since(start) >= 11*5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.R().SetContext(ctx).Get(srv.URL + "/latency")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for name, n := range map[string]int{"reset": 1, "tls": 1, "never": 0, "flaky": 1, "truncate": 1, "slow": 1, "latency": 1} {
+		tests.AssertEqual(t, n, faults.Injected(name))
+	}
+
+	faults.SetEnabled(false)
+	resp, err = c.R().Get(srv.URL + "/reset/1")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 1, faults.Injected("reset"))
+}
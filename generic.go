@@ -0,0 +1,137 @@
+package req
+
+import "fmt"
+
+// ResultError is the error returned by Do when the ResultState of the
+// response is not SuccessState, with the error result of the response.
+type ResultError[E any] struct {
+	// Result is the error result unmarshalled from the response body if the
+	// ResultState is ErrorState, the zero value otherwise.
+	Result E
+
+	// Response is the response.
+	Response *Response
+
+	hasResult bool // whether Result is unmarshalled
+}
+
+// Error returns the message of Result if it is an error, or the status of
+// the response.
+func (e *ResultError[E]) Error() string {
+	if err := e.Unwrap(); err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("req: unexpected response status %s", e.Response.Status)
+}
+
+// Unwrap returns Result if it is an error.
+func (e *ResultError[E]) Unwrap() error {
+	if !e.hasResult {
+		return nil
+	}
+	err, _ := any(e.Result).(error)
+	return err
+}
+
+// Do fires the request, and returns the success result of the response
+// unmarshalled as T. If the ResultState of the response is not
+// SuccessState, the error is a *ResultError[E] with the error result
+// unmarshalled as E, which can be retrieved with errors.As:
+//
+//	user, resp, err := req.Do[*User, *APIError](client.Get(url))
+//	var apiErr *req.ResultError[*APIError]
+//	if errors.As(err, &apiErr) {
+//		fmt.Println(apiErr.Result.Message)
+//	}
+//
+// The results set by Request.SetSuccessResult and Request.SetErrorResult, and
+// the common error result of the client, are replaced by T and E.
+func Do[T, E any](r *Request) (T, *Response, error) {
+	var result T
+	var errResult E
+	resp := r.SetSuccessResult(&result).SetErrorResult(&errResult).Do()
+	return doResult(resp, result, func() E { return errResult })
+}
+
+// GetAs fires a GET request to the url with the client, and returns the
+// success result of the response unmarshalled as T, see Do. If the
+// ResultState of the response is not SuccessState, the error is a
+// *ResultError[any] with the common error result of the client, if any, use
+// Do with the type of the error result instead.
+func GetAs[T any](c *Client, url string) (T, *Response, error) {
+	return doAs[T](c.Get(url))
+}
+
+// PostAs fires a POST request with the body to the url with the client, and
+// returns the success result of the response unmarshalled as T, see Do. The
+// error is a *ResultError[any] as in GetAs.
+func PostAs[T any](c *Client, url string, body any) (T, *Response, error) {
+	return doAs[T](c.Post(url).SetBody(body))
+}
+
+func doAs[T any](r *Request) (T, *Response, error) {
+	var result T
+	resp := r.SetSuccessResult(&result).Do()
+	return doResult(resp, result, resp.ErrorResult)
+}
+
+func doResult[T, E any](resp *Response, result T, errResult func() E) (T, *Response, error) {
+	var zero T
+	if resp.Err != nil {
+		return zero, resp, resp.Err
+	}
+	if resp.ResultState() == SuccessState {
+		return result, resp, nil
+	}
+	return zero, resp, newResultError(resp, errResult)
+}
+
+func newResultError[E any](resp *Response, errResult func() E) *ResultError[E] {
+	e := &ResultError[E]{Response: resp}
+	if resp.ErrorResult() != nil {
+		e.Result, e.hasResult = errResult(), true
+	}
+	return e
+}
+
+// OnSuccess returns a response middleware which calls fn with the success
+// result of the responses if it is a T, or a pointer of T, for the typed
+// hooks of Client.OnAfterResponse and Request.OnAfterResponse:
+//
+//	client.OnAfterResponse(req.OnSuccess(func(c *req.Client, user *User, resp *req.Response) error {
+//		...
+//	}))
+func OnSuccess[T any](fn func(client *Client, result T, resp *Response) error) ResponseMiddleware {
+	return func(client *Client, resp *Response) error {
+		if result, ok := typedResult[T](resp.SuccessResult()); ok {
+			return fn(client, result, resp)
+		}
+		return nil
+	}
+}
+
+// OnError returns a response middleware which calls fn with the error
+// result of the responses if it is an E, or a pointer of E, see OnSuccess.
+func OnError[E any](fn func(client *Client, result E, resp *Response) error) ResponseMiddleware {
+	return func(client *Client, resp *Response) error {
+		if result, ok := typedResult[E](resp.ErrorResult()); ok {
+			return fn(client, result, resp)
+		}
+		return nil
+	}
+}
+
+// typedResult returns the result as a T, the results are unmarshalled to
+// pointers.
+func typedResult[T any](result any) (T, bool) {
+	switch v := result.(type) {
+	case T:
+		return v, true
+	case *T:
+		if v != nil {
+			return *v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,97 @@
+package req
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+type searchError ErrorMessage
+
+func (e *searchError) Error() string {
+	return e.ErrorMessage
+}
+
+func TestDo(t *testing.T) {
+	c := tc()
+	user, resp, err := Do[*UserInfo, *ErrorMessage](c.Get("/search").SetQueryParam("username", "imroc"))
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "roc@imroc.cc", user.Email)
+
+	info, _, err := Do[UserInfo, ErrorMessage](c.Get("/search").SetQueryParams(map[string]string{"username": "imroc", "type": "xml"}))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "roc@imroc.cc", info.Email)
+
+	user, resp, err = Do[*UserInfo, *ErrorMessage](c.Get("/search").SetQueryParam("username", "unknown"))
+	tests.AssertEqual(t, (*UserInfo)(nil), user)
+	var resultErr *ResultError[*ErrorMessage]
+	if !errors.As(err, &resultErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests.AssertEqual(t, 10001, resultErr.Result.ErrorCode)
+	tests.AssertEqual(t, resp, resultErr.Response)
+	tests.AssertEqual(t, "req: unexpected response status 404 Not Found", err.Error())
+
+	// The error result is returned as the error if it is one.
+	_, _, err = Do[*UserInfo, *searchError](c.Get("/search"))
+	tests.AssertEqual(t, "need username", err.Error())
+	var se *searchError
+	tests.AssertEqual(t, true, errors.As(err, &se))
+	tests.AssertEqual(t, 10000, se.ErrorCode)
+
+	// The responses neither in success nor error state are errors.
+	c.SetResultStateCheckFunc(func(resp *Response) ResultState {
+		return UnknownState
+	})
+	_, resp, err = Do[string, *searchError](c.Get("/search"))
+	tests.AssertEqual(t, http.StatusBadRequest, resp.StatusCode)
+	tests.AssertErrorContains(t, err, "unexpected response status 400")
+
+	_, _, err = Do[string, string](c.Get("http://127.0.0.1:0"))
+	if err == nil {
+		t.Fatal("err is nil")
+	}
+}
+
+func TestGetAs(t *testing.T) {
+	c := tc().SetCommonErrorResult(&ErrorMessage{})
+	user, resp, err := GetAs[*UserInfo](c, "/search?username=imroc")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "imroc", user.Username)
+
+	_, _, err = GetAs[*UserInfo](c, "/search")
+	var resultErr *ResultError[any]
+	if !errors.As(err, &resultErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests.AssertEqual(t, "need username", resultErr.Result.(*ErrorMessage).ErrorMessage)
+
+	echo, resp, err := PostAs[Echo](c, "/echo", map[string]string{"username": "imroc"})
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, `{"username":"imroc"}`, echo.Body)
+}
+
+func TestTypedHooks(t *testing.T) {
+	var emails []string
+	var codes []int
+	c := tc().
+		OnAfterResponse(OnSuccess(func(client *Client, user *UserInfo, resp *Response) error {
+			emails = append(emails, user.Email)
+			return nil
+		})).
+		OnAfterResponse(OnError(func(client *Client, e ErrorMessage, resp *Response) error {
+			codes = append(codes, e.ErrorCode)
+			return errors.New(e.ErrorMessage)
+		}))
+
+	resp, err := c.R().SetSuccessResult(&UserInfo{}).SetQueryParam("username", "imroc").Get("/search")
+	assertSuccess(t, resp, err)
+	resp, err = c.R().SetSuccessResult(&ErrorMessage{}).SetQueryParam("username", "imroc").Get("/search")
+	assertSuccess(t, resp, err)
+	_, err = c.R().SetErrorResult(&ErrorMessage{}).Get("/search")
+	tests.AssertErrorContains(t, err, "need username")
+	tests.AssertEqual(t, []string{"roc@imroc.cc"}, emails)
+	tests.AssertEqual(t, []int{10000}, codes)
+}
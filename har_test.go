@@ -0,0 +1,206 @@
+package req
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+func TestHARRecording(t *testing.T) {
+	c := tc().EnableHARRecording()
+	resp, err := c.R().Get("/har/redirect")
+	assertSuccess(t, resp, err)
+	resp, err = c.R().SetFormData(map[string]string{"name": "roc"}).Post("/har/form")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "roc", resp.String())
+	resp, err = c.R().Get("/har/binary")
+	assertSuccess(t, resp, err)
+
+	entries := c.GetHARRecorder().HAR().Log.Entries
+	tests.AssertEqual(t, 4, len(entries))
+
+	e := entries[0]
+	tests.AssertEqual(t, "GET", e.Request.Method)
+	tests.AssertEqual(t, getTestServerURL()+"/har/redirect", e.Request.URL)
+	tests.AssertEqual(t, "HTTP/2.0", e.Request.HTTPVersion)
+	tests.AssertEqual(t, http.StatusFound, e.Response.Status)
+	tests.AssertEqual(t, "Found", e.Response.StatusText)
+	tests.AssertEqual(t, "/har/final?x=1&y=a+b", e.Response.RedirectURL)
+	tests.AssertEqual(t, []HARCookie{{Name: "session", Value: "REDACTED"}}, e.Response.Cookies)
+	tests.AssertEqual(t, "127.0.0.1", e.ServerIPAddress)
+	tests.AssertEqual(t, true, e.Timings.Connect >= 0)
+	tests.AssertEqual(t, true, e.Timings.SSL >= 0)
+	tests.AssertEqual(t, true, e.Time > 0)
+
+	e = entries[1]
+	tests.AssertEqual(t, []HARNameValue{{Name: "x", Value: "1"}, {Name: "y", Value: "a b"}}, e.Request.QueryString)
+	tests.AssertEqual(t, []HARCookie{{Name: "session", Value: "REDACTED"}}, e.Request.Cookies)
+	tests.AssertEqual(t, "hello world", e.Response.Content.Text)
+	tests.AssertEqual(t, int64(11), e.Response.Content.Size)
+	tests.AssertEqual(t, int64(11), e.Response.BodySize)
+	tests.AssertEqual(t, "text/plain", e.Response.Content.MimeType)
+	// The connection of the redirect is reused.
+	tests.AssertEqual(t, float64(-1), e.Timings.Connect)
+
+	e = entries[2]
+	tests.AssertEqual(t, "POST", e.Request.Method)
+	tests.AssertEqual(t, int64(8), e.Request.BodySize)
+	tests.AssertEqual(t, "name=roc", e.Request.PostData.Text)
+	tests.AssertEqual(t, []HARNameValue{{Name: "name", Value: "roc"}}, e.Request.PostData.Params)
+
+	e = entries[3]
+	tests.AssertEqual(t, "base64", e.Response.Content.Encoding)
+	tests.AssertEqual(t, "//4A", e.Response.Content.Text)
+
+	// The exported HAR is valid JSON.
+	filename := filepath.Join(t.TempDir(), "session.har")
+	tests.AssertNoError(t, c.GetHARRecorder().WriteFile(filename))
+	data, err := os.ReadFile(filename)
+	tests.AssertNoError(t, err)
+	var har HAR
+	tests.AssertNoError(t, json.Unmarshal(data, &har))
+	tests.AssertEqual(t, "1.2", har.Log.Version)
+	tests.AssertEqual(t, 4, len(har.Log.Entries))
+	tests.AssertEqual(t, entries[1].Request.QueryString, har.Log.Entries[1].Request.QueryString)
+
+	c.GetHARRecorder().Reset()
+	tests.AssertEqual(t, 0, len(c.GetHARRecorder().HAR().Log.Entries))
+	c.DisableHARRecording()
+	tests.AssertEqual(t, (*HARRecorder)(nil), c.GetHARRecorder())
+}
+
+func TestHARRecordingBodyLimit(t *testing.T) {
+	rec := NewHARRecorder(&HAROptions{MaxBodySize: 5})
+	c := tc().SetHARRecorder(rec)
+	resp, err := c.R().SetBody("hello request").Post("/har/")
+	assertSuccess(t, resp, err)
+
+	e := rec.HAR().Log.Entries[0]
+	tests.AssertEqual(t, "hello", e.Request.PostData.Text)
+	tests.AssertEqual(t, int64(13), e.Request.BodySize)
+	tests.AssertEqual(t, "hello", e.Response.Content.Text)
+	tests.AssertEqual(t, int64(11), e.Response.Content.Size)
+	tests.AssertEqual(t, "request body truncated, response body truncated", e.Comment)
+
+	rec = NewHARRecorder(&HAROptions{MaxBodySize: -1})
+	c.SetHARRecorder(rec)
+	resp, err = c.R().SetBody("hello request").Post("/har/")
+	assertSuccess(t, resp, err)
+	e = rec.HAR().Log.Entries[0]
+	tests.AssertEqual(t, (*HARPostData)(nil), e.Request.PostData)
+	tests.AssertEqual(t, "", e.Response.Content.Text)
+	tests.AssertEqual(t, "", e.Comment)
+}
+
+func TestHARRecordingRedaction(t *testing.T) {
+	u, _ := url.Parse(getTestServerURL() + "/har/redirect")
+	u.User = url.UserPassword("user", "secret")
+
+	rec := NewHARRecorder(nil)
+	c := tc().SetHARRecorder(rec).SetRedirectPolicy(NoRedirectPolicy())
+	resp, err := c.R().SetHeader("Authorization", "Bearer token").
+		SetCookies(&http.Cookie{Name: "sid", Value: "abc"}).Get(u.String())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.StatusFound, resp.StatusCode)
+
+	e := rec.HAR().Log.Entries[0]
+	tests.AssertEqual(t, strings.Replace(u.String(), "secret", "REDACTED", 1), e.Request.URL)
+	for _, h := range append(e.Request.Headers, e.Response.Headers...) {
+		switch h.Name {
+		case "Authorization", "Cookie", "Set-Cookie":
+			tests.AssertEqual(t, "REDACTED", h.Value)
+		}
+	}
+	tests.AssertEqual(t, []HARCookie{{Name: "sid", Value: "REDACTED"}}, e.Request.Cookies)
+	tests.AssertEqual(t, []HARCookie{{Name: "session", Value: "REDACTED"}}, e.Response.Cookies)
+
+	rec = NewHARRecorder(&HAROptions{RedactHeaders: []string{}, KeepURLCredentials: true})
+	c.SetHARRecorder(rec)
+	_, err = c.R().SetHeader("Authorization", "Bearer token").Get(u.String())
+	tests.AssertNoError(t, err)
+	e = rec.HAR().Log.Entries[0]
+	tests.AssertEqual(t, u.String(), e.Request.URL)
+	tests.AssertEqual(t, []HARCookie{{Name: "session", Value: "abc"}}, e.Response.Cookies)
+	tests.AssertContains(t, fmt.Sprint(e.Request.Headers), "bearer token", true)
+}
+
+func TestHARRecordingError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	ln.Close()
+
+	c := C().EnableHARRecording()
+	_, err = c.R().Get("http://" + ln.Addr().String())
+	if err == nil {
+		t.Fatal("err is nil")
+	}
+	var buf bytes.Buffer
+	_, err = c.GetHARRecorder().WriteTo(&buf)
+	tests.AssertNoError(t, err)
+	var har HAR
+	tests.AssertNoError(t, json.Unmarshal(buf.Bytes(), &har))
+	tests.AssertEqual(t, 1, len(har.Log.Entries))
+	tests.AssertEqual(t, 0, har.Log.Entries[0].Response.Status)
+	tests.AssertContains(t, har.Log.Entries[0].Error, "connection refused", true)
+	tests.AssertContains(t, buf.String(), `"headers": []`, true)
+}
+
+func TestRequestsFromHAR(t *testing.T) {
+	rec := NewHARRecorder(&HAROptions{RedactHeaders: []string{}})
+	c := tc().SetHARRecorder(rec)
+	var want []curlEcho
+	for _, r := range []*Request{
+		c.R().SetHeader("X-Token", "abc").SetQueryParam("page", "2").SetCookies(&http.Cookie{Name: "sid", Value: "abc"}),
+		c.R().SetFormData(map[string]string{"name": "req"}),
+		c.R().SetBody([]byte{0xff, 0x00}).SetContentType("application/octet-stream"),
+	} {
+		var echo curlEcho
+		method := http.MethodGet
+		if r.FormData != nil || r.Body != nil {
+			method = http.MethodPut
+		}
+		resp, err := r.SetSuccessResult(&echo).Send(method, "/curl/echo")
+		assertSuccess(t, resp, err)
+		want = append(want, echo)
+	}
+	filename := filepath.Join(t.TempDir(), "session.har")
+	tests.AssertNoError(t, rec.WriteFile(filename))
+
+	requests, err := tc().RequestsFromHAR(filename)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, len(want), len(requests))
+	for i, r := range requests {
+		var echo curlEcho
+		resp := r.SetSuccessResult(&echo).Do()
+		assertSuccess(t, resp, resp.Err)
+		tests.AssertEqual(t, want[i].Method, echo.Method)
+		tests.AssertEqual(t, want[i].URL, echo.URL)
+		tests.AssertEqual(t, want[i].Body, echo.Body)
+		for _, name := range []string{"X-Token", "Cookie", "Content-Type", "User-Agent"} {
+			tests.AssertEqual(t, want[i].Header.Get(name), echo.Header.Get(name))
+		}
+	}
+
+	// The pseudo headers of HTTP/2 are not replayed.
+	r, err := C().RequestFromHAREntry(&HAREntry{Request: HARRequest{
+		Method:  http.MethodPost,
+		URL:     getTestServerURL(),
+		Headers: []HARNameValue{{Name: ":authority", Value: "example.com"}, {Name: "accept-encoding", Value: "br"}, {Name: "x-foo", Value: "bar"}},
+		PostData: &HARPostData{
+			MimeType: "application/x-www-form-urlencoded",
+			Params:   []HARNameValue{{Name: "a", Value: "1 2"}},
+		},
+	}})
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.Header{"X-Foo": {"bar"}, "Content-Type": {"application/x-www-form-urlencoded"}}, r.Headers)
+	tests.AssertEqual(t, "a=1+2", string(r.Body))
+}
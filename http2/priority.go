@@ -5,16 +5,16 @@ type PriorityParam struct {
 	// StreamDep is a 31-bit stream identifier for the
 	// stream that this stream depends on. Zero means no
 	// dependency.
-	StreamDep uint32
+	StreamDep uint32 `json:"streamDep" yaml:"streamDep"`
 
 	// Exclusive is whether the dependency is exclusive.
-	Exclusive bool
+	Exclusive bool `json:"exclusive" yaml:"exclusive"`
 
 	// Weight is the stream's zero-indexed weight. It should be
 	// set together with StreamDep, or neither should be set. Per
 	// the spec, "Add one to the value to obtain a weight between
 	// 1 and 256."
-	Weight uint8
+	Weight uint8 `json:"weight" yaml:"weight"`
 }
 
 func (p PriorityParam) IsZero() bool {
@@ -23,6 +23,6 @@ func (p PriorityParam) IsZero() bool {
 
 // PriorityFrame represents a http priority frame.
 type PriorityFrame struct {
-	StreamID      uint32
-	PriorityParam PriorityParam
+	StreamID      uint32        `json:"streamID" yaml:"streamID"`
+	PriorityParam PriorityParam `json:"priorityParam" yaml:"priorityParam"`
 }
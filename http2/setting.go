@@ -37,10 +37,10 @@ func (s SettingID) String() string {
 type Setting struct {
 	// ID is which setting is being set.
 	// See https://httpwg.org/specs/rfc7540.html#SettingValues
-	ID SettingID
+	ID SettingID `json:"id" yaml:"id"`
 
 	// Val is the value.
-	Val uint32
+	Val uint32 `json:"val" yaml:"val"`
 }
 
 func (s Setting) String() string {
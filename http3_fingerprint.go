@@ -0,0 +1,103 @@
+package req
+
+import (
+	"time"
+
+	"github.com/imroc/req/v3/internal/http3"
+)
+
+// HTTP/3 setting identifiers, see RFC 9114, RFC 9204, RFC 9220 and
+// RFC 9297.
+const (
+	HTTP3SettingQPACKMaxTableCapacity uint64 = 0x1
+	HTTP3SettingMaxFieldSectionSize   uint64 = 0x6
+	HTTP3SettingQPACKBlockedStreams   uint64 = 0x7
+	HTTP3SettingEnableConnectProtocol uint64 = 0x8
+	HTTP3SettingH3Datagram            uint64 = 0x33
+)
+
+// HTTP3Setting is an HTTP/3 setting parameter sent in the SETTINGS frame.
+type HTTP3Setting struct {
+	ID  uint64 `json:"id" yaml:"id"`
+	Val uint64 `json:"val" yaml:"val"`
+}
+
+// QUICParameters are the QUIC transport parameters advertised by the
+// client, zero values keep the defaults of quic-go.
+type QUICParameters struct {
+	// InitialStreamReceiveWindow is sent as initial_max_stream_data_bidi_local,
+	// initial_max_stream_data_bidi_remote and initial_max_stream_data_uni.
+	InitialStreamReceiveWindow uint64 `json:"initialStreamReceiveWindow,omitempty" yaml:"initialStreamReceiveWindow,omitempty"`
+	MaxStreamReceiveWindow     uint64 `json:"maxStreamReceiveWindow,omitempty" yaml:"maxStreamReceiveWindow,omitempty"`
+	// InitialConnectionReceiveWindow is sent as initial_max_data.
+	InitialConnectionReceiveWindow uint64 `json:"initialConnectionReceiveWindow,omitempty" yaml:"initialConnectionReceiveWindow,omitempty"`
+	MaxConnectionReceiveWindow     uint64 `json:"maxConnectionReceiveWindow,omitempty" yaml:"maxConnectionReceiveWindow,omitempty"`
+	// MaxIncomingUniStreams is sent as initial_max_streams_uni.
+	MaxIncomingUniStreams int64 `json:"maxIncomingUniStreams,omitempty" yaml:"maxIncomingUniStreams,omitempty"`
+	// MaxIdleTimeout is sent as max_idle_timeout.
+	MaxIdleTimeout time.Duration `json:"maxIdleTimeout,omitempty" yaml:"maxIdleTimeout,omitempty"`
+	// InitialPacketSize is the size of the Initial packets, at least 1200.
+	InitialPacketSize uint16 `json:"initialPacketSize,omitempty" yaml:"initialPacketSize,omitempty"`
+}
+
+// SetHTTP3Settings set the exact content of the http3 SETTINGS frame, sent
+// in this order instead of the default settings, which allows to mimic the
+// SETTINGS frame of browsers.
+//
+// Attention: the QPACK decoder does not support the dynamic table, a
+// non-zero HTTP3SettingQPACKMaxTableCapacity allows servers to use it and
+// the requests to those servers fail. The QPACK settings of browsers can
+// therefore not be mimicked, and the built-in impersonation profiles
+// leave them out.
+func (t *Transport) SetHTTP3Settings(settings ...HTTP3Setting) *Transport {
+	t.http3Settings = settings
+	t.applyHTTP3Fingerprint()
+	return t
+}
+
+// SetHTTP3PseudoHeaderOrder set the order of the pseudo headers of http3
+// requests, it takes precedence over the order set by
+// SetCommonPseudoHeaderOder, which is shared by http2 and http3.
+func (t *Transport) SetHTTP3PseudoHeaderOrder(keys ...string) *Transport {
+	t.http3PseudoHeaderOrder = keys
+	t.applyHTTP3Fingerprint()
+	return t
+}
+
+// SetQUICParameters set the QUIC transport parameters advertised by the
+// client. Note that the order of the transport parameters and the
+// ClientHello carried by the QUIC Initial packets are those of quic-go.
+func (t *Transport) SetQUICParameters(params *QUICParameters) *Transport {
+	t.quicParams = params
+	t.applyHTTP3Fingerprint()
+	return t
+}
+
+// applyHTTP3Fingerprint passes the http3 fingerprint settings to the http3
+// transport, they only apply to new connections.
+func (t *Transport) applyHTTP3Fingerprint() {
+	if t.t3 == nil {
+		return
+	}
+	var settings []http3.Setting
+	if t.http3Settings != nil {
+		settings = make([]http3.Setting, 0, len(t.http3Settings))
+		for _, s := range t.http3Settings {
+			settings = append(settings, http3.Setting{ID: s.ID, Val: s.Val})
+		}
+	}
+	t.t3.Settings = settings
+	t.t3.PseudoHeaderOrder = t.http3PseudoHeaderOrder
+	// The defaults are restored when the parameters are cleared.
+	cfg := http3.DefaultQUICConfig()
+	if p := t.quicParams; p != nil {
+		cfg.InitialStreamReceiveWindow = p.InitialStreamReceiveWindow
+		cfg.MaxStreamReceiveWindow = p.MaxStreamReceiveWindow
+		cfg.InitialConnectionReceiveWindow = p.InitialConnectionReceiveWindow
+		cfg.MaxConnectionReceiveWindow = p.MaxConnectionReceiveWindow
+		cfg.MaxIncomingUniStreams = p.MaxIncomingUniStreams
+		cfg.MaxIdleTimeout = p.MaxIdleTimeout
+		cfg.InitialPacketSize = p.InitialPacketSize
+	}
+	t.t3.QUICConfig = cfg
+}
@@ -0,0 +1,71 @@
+package req
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	http3internal "github.com/imroc/req/v3/internal/http3"
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3Fingerprint(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := w.(http3.Settingser)
+			select {
+			case <-s.ReceivedSettings():
+			case <-time.After(5 * time.Second):
+				http.Error(w, "no SETTINGS received", http.StatusInternalServerError)
+				return
+			}
+			settings := s.Settings()
+			fmt.Fprintf(w, "%s datagrams=%t other=%v", r.Proto, settings.EnableDatagrams, settings.Other)
+		}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+
+	client := C().EnableInsecureSkipVerify().EnableForceHTTP3().
+		SetHTTP3Settings(
+			HTTP3Setting{ID: HTTP3SettingMaxFieldSectionSize, Val: 262144},
+			HTTP3Setting{ID: HTTP3SettingH3Datagram, Val: 1},
+			HTTP3Setting{ID: 0x99, Val: 7},
+		).
+		SetHTTP3PseudoHeaderOrder(":method", ":authority", ":scheme", ":path").
+		SetQUICParameters(&QUICParameters{
+			InitialStreamReceiveWindow:     6291456,
+			InitialConnectionReceiveWindow: 15728640,
+			MaxIncomingUniStreams:          103,
+			InitialPacketSize:              1250,
+		})
+	resp, err := client.R().Get("https://" + pc.LocalAddr().String())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/3.0 datagrams=true other=map[153:7]", resp.String())
+
+	// Clearing the QUIC parameters restores the defaults.
+	tests.AssertEqual(t, int64(103), client.t3.QUICConfig.MaxIncomingUniStreams)
+	client.SetQUICParameters(nil)
+	tests.AssertEqual(t, http3internal.DefaultQUICConfig().MaxIncomingUniStreams, client.t3.QUICConfig.MaxIncomingUniStreams)
+	tests.AssertEqual(t, http3internal.DefaultQUICConfig().InitialPacketSize, client.t3.QUICConfig.InitialPacketSize)
+
+	// The profiles of Chromium-based browsers work over HTTP/3.
+	resp, err = C().EnableInsecureSkipVerify().Impersonate("chrome").EnableForceHTTP3().R().
+		Get("https://" + pc.LocalAddr().String())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/3.0 datagrams=true other=map[]", resp.String())
+}
@@ -0,0 +1,465 @@
+package req
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/imroc/req/v3/http2"
+	utls "github.com/refraction-networking/utls"
+	"gopkg.in/yaml.v3"
+)
+
+// ImpersonationProfile describes everything needed to impersonate a
+// client: the TLS fingerprint, the HTTP/2 and HTTP/3 settings, the header
+// orders and the default headers. Profiles can be registered with
+// RegisterImpersonationProfile and used by name with Client.Impersonate,
+// or loaded from and saved to JSON or YAML files.
+type ImpersonationProfile struct {
+	// Name is the name of the client, e.g. "chrome".
+	Name string `json:"name" yaml:"name"`
+	// Version is the version of the client, e.g. "131". Versions are
+	// compared numerically, dot-separated, to find the latest one.
+	Version string `json:"version" yaml:"version"`
+	// Platform is the platform of the client, e.g. "macOS", "Windows",
+	// "Linux", "Android" or "iOS".
+	Platform string `json:"platform,omitempty" yaml:"platform,omitempty"`
+
+	// TLSHelloID is the name of a utls ClientHelloID, e.g. "Chrome-131".
+	TLSHelloID string `json:"tlsHelloID,omitempty" yaml:"tlsHelloID,omitempty"`
+	// TLSFingerprint is a JA3 or raw JA4 fingerprint (see ParseJA3 and
+	// ParseJA4), used if TLSHelloID is empty.
+	TLSFingerprint string `json:"tlsFingerprint,omitempty" yaml:"tlsFingerprint,omitempty"`
+	// ClientHelloSpec, if not nil, is used instead of TLSHelloID and
+	// TLSFingerprint. It can not be saved.
+	ClientHelloSpec func() utls.ClientHelloSpec `json:"-" yaml:"-"`
+
+	HTTP2Settings       []http2.Setting       `json:"http2Settings,omitempty" yaml:"http2Settings,omitempty"`
+	HTTP2ConnectionFlow uint32                `json:"http2ConnectionFlow,omitempty" yaml:"http2ConnectionFlow,omitempty"`
+	HTTP2PriorityFrames []http2.PriorityFrame `json:"http2PriorityFrames,omitempty" yaml:"http2PriorityFrames,omitempty"`
+	HTTP2HeaderPriority *http2.PriorityParam  `json:"http2HeaderPriority,omitempty" yaml:"http2HeaderPriority,omitempty"`
+	// HTTP3Settings is the exact content of the HTTP/3 SETTINGS frame, see
+	// Transport.SetHTTP3Settings. The built-in profiles leave out the QPACK
+	// settings of the browsers, so the QPACK part of their HTTP/3
+	// fingerprint is deliberately not matched.
+	HTTP3Settings          []HTTP3Setting  `json:"http3Settings,omitempty" yaml:"http3Settings,omitempty"`
+	HTTP3PseudoHeaderOrder []string        `json:"http3PseudoHeaderOrder,omitempty" yaml:"http3PseudoHeaderOrder,omitempty"`
+	QUIC                   *QUICParameters `json:"quic,omitempty" yaml:"quic,omitempty"`
+
+	PseudoHeaderOrder []string          `json:"pseudoHeaderOrder,omitempty" yaml:"pseudoHeaderOrder,omitempty"`
+	HeaderOrder       []string          `json:"headerOrder,omitempty" yaml:"headerOrder,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	// MultipartBoundary is the style of the multipart boundary, "webkit"
+	// or "firefox", the default boundary is used if empty.
+	MultipartBoundary string `json:"multipartBoundary,omitempty" yaml:"multipartBoundary,omitempty"`
+	// MultipartBoundaryFunc, if not nil, is used instead of
+	// MultipartBoundary. It can not be saved.
+	MultipartBoundaryFunc func() string `json:"-" yaml:"-"`
+}
+
+// ID returns the name under which the profile is registered, e.g.
+// "chrome-131".
+func (p *ImpersonationProfile) ID() string {
+	return strings.ToLower(p.Name + "-" + p.Version)
+}
+
+// Clone returns a deep copy of the profile.
+func (p *ImpersonationProfile) Clone() *ImpersonationProfile {
+	pp := *p
+	pp.HTTP2Settings = cloneSlice(p.HTTP2Settings)
+	pp.HTTP2PriorityFrames = cloneSlice(p.HTTP2PriorityFrames)
+	if p.HTTP2HeaderPriority != nil {
+		priority := *p.HTTP2HeaderPriority
+		pp.HTTP2HeaderPriority = &priority
+	}
+	pp.HTTP3Settings = cloneSlice(p.HTTP3Settings)
+	pp.HTTP3PseudoHeaderOrder = cloneSlice(p.HTTP3PseudoHeaderOrder)
+	if p.QUIC != nil {
+		params := *p.QUIC
+		pp.QUIC = &params
+	}
+	pp.PseudoHeaderOrder = cloneSlice(p.PseudoHeaderOrder)
+	pp.HeaderOrder = cloneSlice(p.HeaderOrder)
+	if p.Headers != nil {
+		pp.Headers = make(map[string]string, len(p.Headers))
+		for k, v := range p.Headers {
+			pp.Headers[k] = v
+		}
+	}
+	return &pp
+}
+
+var multipartBoundaryFuncs = map[string]func() string{
+	"webkit":  webkitMultipartBoundaryFunc,
+	"firefox": firefoxMultipartBoundaryFunc,
+}
+
+// knownClientHelloIDs are the utls ClientHelloIDs which can be referred to
+// by TLSHelloID.
+var knownClientHelloIDs = []utls.ClientHelloID{
+	utls.HelloChrome_100,
+	utls.HelloChrome_102,
+	utls.HelloChrome_106_Shuffle,
+	utls.HelloChrome_120,
+	utls.HelloChrome_120_PQ,
+	utls.HelloChrome_131,
+	utls.HelloChrome_133,
+	utls.HelloFirefox_102,
+	utls.HelloFirefox_105,
+	utls.HelloFirefox_120,
+	utls.HelloSafari_16_0,
+	utls.HelloIOS_13,
+	utls.HelloIOS_14,
+	utls.HelloEdge_85,
+	utls.HelloEdge_106,
+	utls.HelloAndroid_11_OkHttp,
+}
+
+func lookupClientHelloID(name string) (utls.ClientHelloID, bool) {
+	for _, id := range knownClientHelloIDs {
+		if strings.EqualFold(id.Str(), name) {
+			return id, true
+		}
+	}
+	return utls.ClientHelloID{}, false
+}
+
+// Validate checks that the profile can be used.
+func (p *ImpersonationProfile) Validate() error {
+	if p.Name == "" || p.Version == "" {
+		return errors.New("impersonation profile must have a name and a version")
+	}
+	if p.ClientHelloSpec == nil {
+		if p.TLSHelloID != "" {
+			if _, ok := lookupClientHelloID(p.TLSHelloID); !ok {
+				return fmt.Errorf("impersonation profile %s: unknown tls hello id %q", p.ID(), p.TLSHelloID)
+			}
+		} else if p.TLSFingerprint != "" {
+			if _, err := tlsFingerprintParser(p.TLSFingerprint)(p.TLSFingerprint); err != nil {
+				return fmt.Errorf("impersonation profile %s: %w", p.ID(), err)
+			}
+		}
+	}
+	if p.MultipartBoundary != "" && p.MultipartBoundaryFunc == nil {
+		if _, ok := multipartBoundaryFuncs[p.MultipartBoundary]; !ok {
+			return fmt.Errorf("impersonation profile %s: unknown multipart boundary %q", p.ID(), p.MultipartBoundary)
+		}
+	}
+	return nil
+}
+
+// WithLocale returns a copy of the profile whose accept-language header
+// lists the given locales by decreasing preference, e.g. "fr-FR", "en-US"
+// gives "fr-FR,fr;q=0.9,en-US;q=0.8,en;q=0.7".
+func (p *ImpersonationProfile) WithLocale(locales ...string) *ImpersonationProfile {
+	pp := p.Clone()
+	if len(locales) == 0 {
+		return pp
+	}
+	var langs []string
+	seen := make(map[string]bool)
+	add := func(lang string) {
+		if lang == "" || seen[strings.ToLower(lang)] {
+			return
+		}
+		seen[strings.ToLower(lang)] = true
+		langs = append(langs, lang)
+	}
+	for _, locale := range locales {
+		add(locale)
+		if base, _, ok := strings.Cut(locale, "-"); ok {
+			add(base)
+		}
+	}
+	var sb strings.Builder
+	for i, lang := range langs {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(lang)
+		if i > 0 {
+			q := 10 - i
+			if q < 1 {
+				q = 1
+			}
+			sb.WriteString(";q=0." + strconv.Itoa(q))
+		}
+	}
+	if pp.Headers == nil {
+		pp.Headers = make(map[string]string)
+	}
+	pp.Headers["accept-language"] = sb.String()
+	return pp
+}
+
+// desktopPlatforms are the platform tokens of the user-agent of desktop
+// browsers, Firefox appends its "rv:" token.
+var desktopPlatforms = map[string]string{
+	"windows": "Windows NT 10.0; Win64; x64",
+	"macos":   "Macintosh; Intel Mac OS X 10_15_7",
+	"linux":   "X11; Linux x86_64",
+}
+
+var platformNames = map[string]string{
+	"windows": "Windows",
+	"macos":   "macOS",
+	"linux":   "Linux",
+}
+
+// WithPlatform returns a copy of the profile of a desktop browser
+// running on another desktop platform, "Windows", "macOS" or "Linux":
+// the user-agent and the sec-ch-ua-platform client hint are updated.
+func (p *ImpersonationProfile) WithPlatform(platform string) (*ImpersonationProfile, error) {
+	key := strings.ToLower(platform)
+	token, ok := desktopPlatforms[key]
+	if !ok {
+		return nil, fmt.Errorf("unsupported platform %q: want Windows, macOS or Linux", platform)
+	}
+	switch strings.ToLower(p.Platform) {
+	case "android", "ios":
+		return nil, fmt.Errorf("the platform of the mobile profile %s can not be changed", p.ID())
+	}
+	pp := p.Clone()
+	pp.Platform = platformNames[key]
+	for k, v := range pp.Headers {
+		switch strings.ToLower(k) {
+		case "user-agent":
+			start := strings.IndexByte(v, '(')
+			end := strings.IndexByte(v, ')')
+			if start < 0 || end < start {
+				return nil, fmt.Errorf("unexpected user-agent %q", v)
+			}
+			inner := v[start+1 : end]
+			if strings.Contains(inner, "Mac OS X") && strings.Contains(v, "Safari/605") && key != "macos" {
+				return nil, fmt.Errorf("safari does not run on %s", platform)
+			}
+			newInner := token
+			if i := strings.Index(inner, "; rv:"); i >= 0 {
+				if key == "macos" {
+					newInner = "Macintosh; Intel Mac OS X 10.15"
+				}
+				newInner += inner[i:]
+			}
+			pp.Headers[k] = v[:start+1] + newInner + v[end:]
+		case "sec-ch-ua-platform":
+			pp.Headers[k] = strconv.Quote(pp.Platform)
+		}
+	}
+	return pp, nil
+}
+
+var impersonationProfiles = struct {
+	sync.RWMutex
+	m map[string]*ImpersonationProfile
+}{m: make(map[string]*ImpersonationProfile)}
+
+// RegisterImpersonationProfile registers a profile under its ID, e.g.
+// "chrome-131", replacing any profile with the same ID.
+func RegisterImpersonationProfile(p *ImpersonationProfile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	impersonationProfiles.Lock()
+	impersonationProfiles.m[p.ID()] = p.Clone()
+	impersonationProfiles.Unlock()
+	return nil
+}
+
+// ImpersonationProfileIDs returns the sorted IDs of the registered
+// profiles.
+func ImpersonationProfileIDs() []string {
+	impersonationProfiles.RLock()
+	defer impersonationProfiles.RUnlock()
+	ids := make([]string, 0, len(impersonationProfiles.m))
+	for id := range impersonationProfiles.m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetImpersonationProfile returns a copy of the registered profile with
+// the given ID, e.g. "chrome-131". A name without version, or followed by
+// "-latest", e.g. "chrome" or "chrome-latest", returns the latest version.
+func GetImpersonationProfile(id string) (*ImpersonationProfile, error) {
+	id = strings.ToLower(id)
+	impersonationProfiles.RLock()
+	defer impersonationProfiles.RUnlock()
+	if p, ok := impersonationProfiles.m[id]; ok {
+		return p.Clone(), nil
+	}
+	name := strings.TrimSuffix(id, "-latest")
+	var latest *ImpersonationProfile
+	for _, p := range impersonationProfiles.m {
+		if strings.ToLower(p.Name) != name {
+			continue
+		}
+		if latest == nil || compareVersions(p.Version, latest.Version) > 0 {
+			latest = p
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("unknown impersonation profile %q", id)
+	}
+	return latest.Clone(), nil
+}
+
+// compareVersions compares dot-separated versions numerically, parts
+// which are not numbers are compared as strings.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+func isYAMLFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// LoadImpersonationProfiles reads a list of profiles from a JSON file, or
+// a YAML file if its extension is ".yaml" or ".yml", and registers them.
+func LoadImpersonationProfiles(filename string) ([]*ImpersonationProfile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []*ImpersonationProfile
+	if isYAMLFile(filename) {
+		err = yaml.Unmarshal(data, &profiles)
+	} else {
+		err = json.Unmarshal(data, &profiles)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode impersonation profiles from %s: %w", filename, err)
+	}
+	for _, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range profiles {
+		if err := RegisterImpersonationProfile(p); err != nil {
+			return nil, fmt.Errorf("failed to register impersonation profile %s: %w", p.ID(), err)
+		}
+	}
+	return profiles, nil
+}
+
+// SaveImpersonationProfiles writes the profiles to a JSON file, or a YAML
+// file if its extension is ".yaml" or ".yml". ClientHelloSpec and
+// MultipartBoundaryFunc are not saved.
+func SaveImpersonationProfiles(filename string, profiles ...*ImpersonationProfile) error {
+	var (
+		data []byte
+		err  error
+	)
+	if isYAMLFile(filename) {
+		data, err = yaml.Marshal(profiles)
+	} else {
+		data, err = json.MarshalIndent(profiles, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// Impersonate impersonates the client of the registered profile with the
+// given ID, e.g. "chrome-131" or "firefox" for the latest Firefox, see
+// GetImpersonationProfile.
+func (c *Client) Impersonate(id string) *Client {
+	p, err := GetImpersonationProfile(id)
+	if err != nil {
+		c.log.Errorf("%v", err)
+		return c
+	}
+	return c.ImpersonateProfile(p)
+}
+
+// ImpersonateProfile impersonates the client described by the profile.
+// The client is left unchanged if the profile is not valid.
+func (c *Client) ImpersonateProfile(p *ImpersonationProfile) *Client {
+	if err := p.Validate(); err != nil {
+		c.log.Errorf("%v", err)
+		return c
+	}
+	switch {
+	case p.ClientHelloSpec != nil:
+		c.SetTLSFingerprintSpec(p.ClientHelloSpec)
+	case p.TLSHelloID != "":
+		id, _ := lookupClientHelloID(p.TLSHelloID)
+		c.SetTLSFingerprint(id)
+	case p.TLSFingerprint != "":
+		fingerprint := p.TLSFingerprint
+		parse := tlsFingerprintParser(fingerprint)
+		c.SetTLSFingerprintSpec(func() utls.ClientHelloSpec {
+			spec, _ := parse(fingerprint)
+			return *spec
+		})
+	}
+	if len(p.HTTP2Settings) > 0 {
+		c.SetHTTP2SettingsFrame(p.HTTP2Settings...)
+	}
+	if p.HTTP2ConnectionFlow > 0 {
+		c.SetHTTP2ConnectionFlow(p.HTTP2ConnectionFlow)
+	}
+	if len(p.HTTP2PriorityFrames) > 0 {
+		c.SetHTTP2PriorityFrames(p.HTTP2PriorityFrames...)
+	}
+	if p.HTTP2HeaderPriority != nil {
+		c.SetHTTP2HeaderPriority(*p.HTTP2HeaderPriority)
+	}
+	// The HTTP/3 fingerprint of a previously impersonated profile is
+	// cleared if the profile has none.
+	c.SetHTTP3Settings(p.HTTP3Settings...)
+	c.SetHTTP3PseudoHeaderOrder(p.HTTP3PseudoHeaderOrder...)
+	c.SetQUICParameters(p.QUIC)
+	if len(p.PseudoHeaderOrder) > 0 {
+		c.SetCommonPseudoHeaderOder(p.PseudoHeaderOrder...)
+	}
+	if len(p.HeaderOrder) > 0 {
+		c.SetCommonHeaderOrder(p.HeaderOrder...)
+	}
+	if len(p.Headers) > 0 {
+		c.SetCommonHeaders(p.Headers)
+	}
+	switch {
+	case p.MultipartBoundaryFunc != nil:
+		c.SetMultipartBoundaryFunc(p.MultipartBoundaryFunc)
+	case p.MultipartBoundary != "":
+		c.SetMultipartBoundaryFunc(multipartBoundaryFuncs[p.MultipartBoundary])
+	}
+	return c
+}
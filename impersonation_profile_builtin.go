@@ -0,0 +1,194 @@
+package req
+
+import (
+	"time"
+
+	"github.com/imroc/req/v3/http2"
+)
+
+// The built-in profiles use "en-US" as locale, see
+// ImpersonationProfile.WithLocale to change it.
+func init() {
+	for _, p := range builtinImpersonationProfiles() {
+		if err := RegisterImpersonationProfile(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+const (
+	chromeAccept  = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+	safariAccept  = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	firefoxAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"
+)
+
+// chromiumHeaderOrder is the header order of navigations of Chromium-based
+// browsers since version 124.
+var chromiumHeaderOrder = []string{
+	"host",
+	"sec-ch-ua",
+	"sec-ch-ua-mobile",
+	"sec-ch-ua-platform",
+	"upgrade-insecure-requests",
+	"user-agent",
+	"accept",
+	"sec-fetch-site",
+	"sec-fetch-mode",
+	"sec-fetch-user",
+	"sec-fetch-dest",
+	"referer",
+	"accept-encoding",
+	"accept-language",
+	"cookie",
+	"priority",
+}
+
+// chromiumHTTP3Settings is the SETTINGS frame of Chromium-based browsers
+// without their QPACK_MAX_TABLE_CAPACITY and QPACK_BLOCKED_STREAMS, since
+// the QPACK decoder does not support the dynamic table: the QPACK part of
+// the HTTP/3 fingerprint is deliberately not matched.
+var chromiumHTTP3Settings = []HTTP3Setting{
+	{ID: HTTP3SettingMaxFieldSectionSize, Val: 262144},
+	{ID: HTTP3SettingH3Datagram, Val: 1},
+}
+
+// chromiumQUICParameters are the QUIC transport parameters of
+// Chromium-based browsers.
+var chromiumQUICParameters = QUICParameters{
+	InitialStreamReceiveWindow:     6291456,
+	InitialConnectionReceiveWindow: 15728640,
+	MaxIncomingUniStreams:          103,
+	MaxIdleTimeout:                 30 * time.Second,
+	InitialPacketSize:              1250,
+}
+
+// chromiumProfile returns the profile of a Chromium-based browser, ua is
+// the user-agent and brands the sec-ch-ua client hint.
+func chromiumProfile(name, version, platform, tlsHelloID, ua, brands string) *ImpersonationProfile {
+	mobile := "?0"
+	if platform == "Android" {
+		mobile = "?1"
+	}
+	priority := chromeHeaderPriority
+	quic := chromiumQUICParameters
+	return &ImpersonationProfile{
+		Name:                name,
+		Version:             version,
+		Platform:            platform,
+		TLSHelloID:          tlsHelloID,
+		HTTP2Settings:       cloneSlice(chromeHttp2Settings),
+		HTTP2ConnectionFlow: 15663105,
+		HTTP2HeaderPriority: &priority,
+		HTTP3Settings:       cloneSlice(chromiumHTTP3Settings),
+		QUIC:                &quic,
+		PseudoHeaderOrder:   cloneSlice(chromePseudoHeaderOrder),
+		HeaderOrder:         cloneSlice(chromiumHeaderOrder),
+		Headers: map[string]string{
+			"sec-ch-ua":                 brands,
+			"sec-ch-ua-mobile":          mobile,
+			"sec-ch-ua-platform":        `"` + platform + `"`,
+			"upgrade-insecure-requests": "1",
+			"user-agent":                ua,
+			"accept":                    chromeAccept,
+			"sec-fetch-site":            "none",
+			"sec-fetch-mode":            "navigate",
+			"sec-fetch-user":            "?1",
+			"sec-fetch-dest":            "document",
+			"accept-language":           "en-US,en;q=0.9",
+			"priority":                  "u=0, i",
+		},
+		MultipartBoundary: "webkit",
+	}
+}
+
+func builtinImpersonationProfiles() []*ImpersonationProfile {
+	chrome120 := chromiumProfile("chrome", "120", "macOS", "Chrome-120",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		`"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
+	// Chrome only sends the priority header since version 124, the pragma
+	// and cache-control headers are those ImpersonateChrome always sent.
+	chrome120.HeaderOrder = cloneSlice(chromeHeaderOrder)
+	delete(chrome120.Headers, "priority")
+	chrome120.Headers["pragma"] = "no-cache"
+	chrome120.Headers["cache-control"] = "no-cache"
+
+	firefoxPriority := firefoxHeaderPriority
+	safariPriority := safariHeaderPriority
+	return []*ImpersonationProfile{
+		chrome120,
+		chromiumProfile("chrome", "131", "macOS", "Chrome-131",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+			`"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`),
+		chromiumProfile("chrome", "133", "macOS", "Chrome-133",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36",
+			`"Not(A:Brand";v="99", "Google Chrome";v="133", "Chromium";v="133"`),
+		chromiumProfile("edge", "131", "Windows", "Chrome-131",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
+			`"Microsoft Edge";v="131", "Chromium";v="131", "Not_A Brand";v="24"`),
+		chromiumProfile("chrome-android", "131", "Android", "Chrome-131",
+			"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36",
+			`"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`),
+		{
+			Name:                "firefox",
+			Version:             "120",
+			Platform:            "macOS",
+			TLSHelloID:          "Firefox-120",
+			HTTP2Settings:       cloneSlice(firefoxHttp2Settings),
+			HTTP2ConnectionFlow: 12517377,
+			HTTP2PriorityFrames: cloneSlice(firefoxPriorityFrames),
+			HTTP2HeaderPriority: &firefoxPriority,
+			PseudoHeaderOrder:   cloneSlice(firefoxPseudoHeaderOrder),
+			// Firefox orders the pseudo headers differently over HTTP/3.
+			HTTP3PseudoHeaderOrder: []string{":method", ":scheme", ":authority", ":path"},
+			HeaderOrder:            cloneSlice(firefoxHeaderOrder),
+			Headers: map[string]string{
+				"user-agent":                "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:120.0) Gecko/20100101 Firefox/120.0",
+				"accept":                    firefoxAccept,
+				"accept-language":           "en-US,en;q=0.5",
+				"upgrade-insecure-requests": "1",
+				"sec-fetch-dest":            "document",
+				"sec-fetch-mode":            "navigate",
+				"sec-fetch-site":            "none",
+				"sec-fetch-user":            "?1",
+			},
+			MultipartBoundary: "firefox",
+		},
+		{
+			Name:                "safari",
+			Version:             "16.6",
+			Platform:            "macOS",
+			TLSHelloID:          "Safari-16.0",
+			HTTP2Settings:       cloneSlice(safariHttp2Settings),
+			HTTP2ConnectionFlow: 10485760,
+			HTTP2HeaderPriority: &safariPriority,
+			PseudoHeaderOrder:   cloneSlice(safariPseudoHeaderOrder),
+			HeaderOrder:         cloneSlice(safariHeaderOrder),
+			Headers: map[string]string{
+				"accept":          safariAccept,
+				"sec-fetch-site":  "none",
+				"sec-fetch-dest":  "document",
+				"accept-language": "en-US,en;q=0.9",
+				"sec-fetch-mode":  "navigate",
+				"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
+			},
+			MultipartBoundary: "webkit",
+		},
+		{
+			Name:                "safari-ios",
+			Version:             "14",
+			Platform:            "iOS",
+			TLSHelloID:          "iOS-14",
+			HTTP2Settings:       cloneSlice(safariHttp2Settings),
+			HTTP2ConnectionFlow: 10485760,
+			HTTP2HeaderPriority: &http2.PriorityParam{Weight: 254},
+			PseudoHeaderOrder:   cloneSlice(safariPseudoHeaderOrder),
+			HeaderOrder:         cloneSlice(safariHeaderOrder),
+			Headers: map[string]string{
+				"accept":          safariAccept,
+				"accept-language": "en-US,en;q=0.9",
+				"user-agent":      "Mozilla/5.0 (iPhone; CPU iPhone OS 14_8 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.2 Mobile/15E148 Safari/604.1",
+			},
+			MultipartBoundary: "webkit",
+		},
+	}
+}
@@ -0,0 +1,140 @@
+package req
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	http3internal "github.com/imroc/req/v3/internal/http3"
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+func TestGetImpersonationProfile(t *testing.T) {
+	p, err := GetImpersonationProfile("chrome")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "133", p.Version)
+	p, err = GetImpersonationProfile("Chrome-Latest")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "133", p.Version)
+	p, err = GetImpersonationProfile("chrome-120")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "Chrome-120", p.TLSHelloID)
+
+	// The registry hands out copies.
+	p.Headers["user-agent"] = "changed"
+	p, _ = GetImpersonationProfile("chrome-120")
+	tests.AssertContains(t, p.Headers["user-agent"], "chrome/120", true)
+
+	_, err = GetImpersonationProfile("netscape")
+	tests.AssertErrorContains(t, err, "unknown impersonation profile")
+
+	for _, id := range []string{"chrome-131", "edge-131", "chrome-android-131", "firefox-120", "safari-16.6", "safari-ios-14"} {
+		if _, err := GetImpersonationProfile(id); err != nil {
+			t.Errorf("profile %s is not registered: %v", id, err)
+		}
+	}
+	tests.AssertEqual(t, 1, compareVersions("16.10", "16.6"))
+	tests.AssertEqual(t, -1, compareVersions("16", "16.1"))
+}
+
+func TestImpersonationProfileOverrides(t *testing.T) {
+	chrome, _ := GetImpersonationProfile("chrome-131")
+	tests.AssertEqual(t, "fr-FR,fr;q=0.9,en-US;q=0.8,en;q=0.7", chrome.WithLocale("fr-FR", "en-US").Headers["accept-language"])
+	tests.AssertEqual(t, "en-US,en;q=0.9", chrome.Headers["accept-language"])
+
+	win, err := chrome.WithPlatform("windows")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "Windows", win.Platform)
+	tests.AssertEqual(t, `"Windows"`, win.Headers["sec-ch-ua-platform"])
+	tests.AssertEqual(t, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36", win.Headers["user-agent"])
+
+	firefox, _ := GetImpersonationProfile("firefox")
+	linux, err := firefox.WithPlatform("Linux")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", linux.Headers["user-agent"])
+
+	safari, _ := GetImpersonationProfile("safari")
+	_, err = safari.WithPlatform("Windows")
+	tests.AssertErrorContains(t, err, "safari does not run on")
+	android, _ := GetImpersonationProfile("chrome-android")
+	_, err = android.WithPlatform("Linux")
+	tests.AssertErrorContains(t, err, "mobile profile")
+	_, err = chrome.WithPlatform("BeOS")
+	tests.AssertErrorContains(t, err, "unsupported platform")
+}
+
+func TestSaveLoadImpersonationProfiles(t *testing.T) {
+	chrome, _ := GetImpersonationProfile("chrome-131")
+	custom := chrome.WithLocale("de-DE")
+	custom.Name = "mybrowser"
+	custom.Version = "1.2"
+	custom.TLSHelloID = ""
+	custom.TLSFingerprint = testChromeJA3
+	custom.HTTP3Settings = []HTTP3Setting{{ID: 0x1, Val: 65536}, {ID: 0x7, Val: 100}}
+
+	for _, name := range []string{"profiles.json", "profiles.yaml"} {
+		filename := filepath.Join(t.TempDir(), name)
+		tests.AssertNoError(t, SaveImpersonationProfiles(filename, custom))
+		loaded, err := LoadImpersonationProfiles(filename)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, 1, len(loaded))
+		custom.MultipartBoundaryFunc = nil
+		tests.AssertEqual(t, custom, loaded[0])
+
+		p, err := GetImpersonationProfile("mybrowser")
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "de-DE,de;q=0.9", p.Headers["accept-language"])
+	}
+
+	_, err := LoadImpersonationProfiles(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+	bad := &ImpersonationProfile{Name: "bad", Version: "1", TLSHelloID: "Netscape-4"}
+	tests.AssertErrorContains(t, RegisterImpersonationProfile(bad), "unknown tls hello id")
+}
+
+func TestImpersonate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		w.Write([]byte(r.Header.Get("User-Agent") + "|" + r.Header.Get("Sec-Ch-Ua-Platform")))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, id := range []string{"chrome", "edge", "firefox", "safari"} {
+		p, err := GetImpersonationProfile(id)
+		tests.AssertNoError(t, err)
+		resp, err := C().EnableInsecureSkipVerify().Impersonate(id).R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "HTTP/2.0", resp.GetHeader("X-Proto"))
+		tests.AssertEqual(t, p.Headers["user-agent"]+"|"+p.Headers["sec-ch-ua-platform"], resp.String())
+	}
+
+	// The browser methods are pinned to the versions they used to send.
+	for id, impersonate := range map[string]func(*Client) *Client{
+		"chrome-120":  (*Client).ImpersonateChrome,
+		"firefox-120": (*Client).ImpersonateFirefox,
+		"safari-16.6": (*Client).ImpersonateSafari,
+	} {
+		p, err := GetImpersonationProfile(id)
+		tests.AssertNoError(t, err)
+		resp, err := impersonate(C().EnableInsecureSkipVerify()).R().Get(srv.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, p.Headers["user-agent"]+"|"+p.Headers["sec-ch-ua-platform"], resp.String())
+	}
+}
+
+func TestImpersonateClearsHTTP3Fingerprint(t *testing.T) {
+	c := C().EnableHTTP3().Impersonate("chrome")
+	if len(c.http3Settings) == 0 || c.quicParams == nil {
+		t.Fatal("the HTTP/3 fingerprint of chrome is not set")
+	}
+	c.Impersonate("safari")
+	tests.AssertEqual(t, 0, len(c.http3Settings))
+	tests.AssertEqual(t, 0, len(c.http3PseudoHeaderOrder))
+	tests.AssertEqual(t, (*QUICParameters)(nil), c.quicParams)
+	tests.AssertEqual(t, http3internal.DefaultQUICConfig().InitialStreamReceiveWindow, c.t3.QUICConfig.InitialStreamReceiveWindow)
+}
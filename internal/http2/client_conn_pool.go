@@ -174,7 +174,7 @@ type addConnCall struct {
 }
 
 func (c *addConnCall) run(t *Transport, key string, tc net.Conn) {
-	cc, err := t.NewClientConn(tc)
+	cc, err := t.newClientConn(tc, key, t.DisableKeepAlives)
 
 	p := c.p
 	p.mu.Lock()
@@ -235,7 +235,7 @@ func (p *clientConnPool) CloseIdleConnections() {
 	// break some caller's RoundTrip.
 	for _, vv := range p.conns {
 		for _, cc := range vv {
-			cc.closeIfIdle()
+			cc.closeIfIdle(errCloseIdleConns)
 		}
 	}
 }
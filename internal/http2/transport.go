@@ -24,6 +24,7 @@ import (
 	"net/http/httptrace"
 	"net/textproto"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -229,6 +230,8 @@ type ClientConn struct {
 	br              *bufio.Reader
 	lastActive      time.Time
 	lastIdle        time.Time // time last idle
+	connState       transport.MuxConnState
+	evictErr        error // why the idle conn is closed by the pool, see closeIfIdle
 	// Settings from peer: (also guarded by wmu)
 	maxFrameSize          uint32
 	maxConcurrentStreams  uint32
@@ -520,6 +523,8 @@ var (
 	errClientConnClosed    = errors.New("http2: client conn is closed")
 	errClientConnUnusable  = errors.New("http2: client conn not usable")
 	errClientConnGotGoAway = errors.New("http2: Transport received Server's graceful shutdown GOAWAY")
+	errIdleConnTimeout     = errors.New("http2: idle connection timeout")
+	errCloseIdleConns      = errors.New("http2: CloseIdleConnections called")
 )
 
 // shouldRetryRequest is called by RoundTrip when a request fails to get
@@ -581,7 +586,7 @@ func (t *Transport) dialClientConn(ctx context.Context, addr string, singleUse b
 	if err != nil {
 		return nil, err
 	}
-	return t.newClientConn(tconn, singleUse)
+	return t.newClientConn(tconn, addr, singleUse)
 }
 
 func (t *Transport) newTLSConfig(host string) *tls.Config {
@@ -750,10 +755,12 @@ func (t *Transport) dialTLS(ctx context.Context) func(string, string, *tls.Confi
 }
 
 func (t *Transport) NewClientConn(c net.Conn) (*ClientConn, error) {
-	return t.newClientConn(c, t.DisableKeepAlives)
+	return t.newClientConn(c, "", t.DisableKeepAlives)
 }
 
-func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, error) {
+// newClientConn creates a client connection over c, whose state is reported
+// to the ConnStateHook if addr is not empty.
+func (t *Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*ClientConn, error) {
 	cc := &ClientConn{
 		t:                     t,
 		tconn:                 c,
@@ -768,6 +775,7 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		wantSettingsAck:       true,
 		pings:                 make(map[[8]byte]chan struct{}),
 		reqHeaderMu:           make(chan struct{}, 1),
+		connState:             transport.MuxConnState{Addr: addr, Proto: "HTTP/2.0"},
 	}
 	if VerboseLogs {
 		t.vlogf("http2: Transport creating client conn %p to %v", cc, c.RemoteAddr())
@@ -853,6 +861,9 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		cc.idleTimer = t.afterFunc(d, cc.onIdleTimeout)
 	}
 
+	cc.mu.Lock()
+	cc.updateConnStateLocked()
+	cc.mu.Unlock()
 	go cc.readLoop()
 	return cc, nil
 }
@@ -973,6 +984,47 @@ type ClientConnState struct {
 	LastIdle time.Time
 }
 
+// State returns a snapshot of cc's state.
+func (cc *ClientConn) State() ClientConnState {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	maxConcurrent := cc.maxConcurrentStreams
+	if !cc.seenSettings {
+		maxConcurrent = 0
+	}
+	return ClientConnState{
+		Closed:               cc.closed,
+		Closing:              cc.closing || cc.singleUse || cc.doNotReuse || cc.goAway != nil,
+		StreamsActive:        len(cc.streams),
+		StreamsReserved:      cc.streamsReserved,
+		StreamsPending:       cc.pendingRequests,
+		LastIdle:             cc.lastIdle,
+		MaxConcurrentStreams: maxConcurrent,
+	}
+}
+
+// ConnStates returns the states of the connections in the pool of t by
+// host:port, it returns nil if t uses a custom ClientConnPool.
+func (t *Transport) ConnStates() map[string][]ClientConnState {
+	p, ok := t.connPool().(*clientConnPool)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	conns := make(map[string][]*ClientConn, len(p.conns))
+	for addr, vv := range p.conns {
+		conns[addr] = slices.Clone(vv)
+	}
+	p.mu.Unlock()
+	states := make(map[string][]ClientConnState, len(conns))
+	for addr, vv := range conns {
+		for _, cc := range vv {
+			states[addr] = append(states[addr], cc.State())
+		}
+	}
+	return states
+}
+
 // clientConnIdleState describes the suitability of a client
 // connection to initiate a new RoundTrip request.
 type clientConnIdleState struct {
@@ -1029,7 +1081,7 @@ func (cc *ClientConn) tooIdleLocked() bool {
 // connection. The timer could just call closeIfIdle, but this is more
 // clear.
 func (cc *ClientConn) onIdleTimeout() {
-	cc.closeIfIdle()
+	cc.closeIfIdle(errIdleConnTimeout)
 }
 
 func (cc *ClientConn) closeConn() {
@@ -1050,13 +1102,20 @@ func (cc *ClientConn) forceCloseConn() {
 	}
 }
 
-func (cc *ClientConn) closeIfIdle() {
+// CloseIfIdle closes the connection if it has no active or reserved
+// streams.
+func (cc *ClientConn) CloseIfIdle() {
+	cc.closeIfIdle(errCloseIdleConns)
+}
+
+func (cc *ClientConn) closeIfIdle(err error) {
 	cc.mu.Lock()
 	if len(cc.streams) > 0 || cc.streamsReserved > 0 {
 		cc.mu.Unlock()
 		return
 	}
 	cc.closed = true
+	cc.evictErr = err
 	nextID := cc.nextStreamID
 	// TODO: do clients send GOAWAY too? maybe? Just Close:
 	cc.mu.Unlock()
@@ -2267,6 +2326,16 @@ func (cc *ClientConn) addStreamLocked(cs *clientStream) {
 	if cs.ID == 0 {
 		panic("assigned stream ID 0")
 	}
+	cc.updateConnStateLocked()
+}
+
+// updateConnStateLocked reports the state of cc to the ConnStateHook.
+// cc.mu must be held.
+func (cc *ClientConn) updateConnStateLocked() {
+	if cc.t.Options != nil {
+		// The connection is closed once its read loop is done.
+		cc.connState.Update(cc.t.ConnStateHook, len(cc.streams))
+	}
 }
 
 func (cc *ClientConn) forgetStreamID(id uint32) {
@@ -2276,6 +2345,7 @@ func (cc *ClientConn) forgetStreamID(id uint32) {
 	if len(cc.streams) != slen-1 {
 		panic("forgetting unknown stream id")
 	}
+	cc.updateConnStateLocked()
 	cc.lastActive = time.Now()
 	if len(cc.streams) == 0 && cc.idleTimer != nil {
 		cc.idleTimer.Reset(cc.idleTimeout)
@@ -2361,6 +2431,13 @@ func (rl *clientConnReadLoop) cleanup() {
 		err = io.ErrUnexpectedEOF
 	}
 	cc.closed = true
+	if cc.t.Options != nil {
+		if cc.evictErr != nil {
+			cc.connState.Close(cc.t.ConnStateHook, cc.evictErr, true)
+		} else {
+			cc.connState.Close(cc.t.ConnStateHook, err, false)
+		}
+	}
 
 	for _, cs := range cc.streams {
 		select {
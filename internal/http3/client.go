@@ -47,6 +47,12 @@ var defaultQuicConfig = &quic.Config{
 	KeepAlivePeriod:    10 * time.Second,
 }
 
+// DefaultQUICConfig returns a copy of the quic.Config used when
+// Transport.QUICConfig is nil.
+func DefaultQUICConfig() *quic.Config {
+	return defaultQuicConfig.Clone()
+}
+
 // ClientConn is an HTTP/3 client doing requests to a single remote server.
 type ClientConn struct {
 	*transport.Options
@@ -60,6 +66,9 @@ type ClientConn struct {
 	// It is invalid to specify any settings defined by RFC 9114 (HTTP/3) and RFC 9297 (HTTP Datagrams).
 	additionalSettings map[uint64]uint64
 
+	// settings, if not nil, is the exact content of the SETTINGS frame.
+	settings []Setting
+
 	// maxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
 	maxResponseHeaderBytes int
@@ -84,6 +93,8 @@ func newClientConn(
 	conn *quic.Conn,
 	enableDatagrams bool,
 	additionalSettings map[uint64]uint64,
+	settings []Setting,
+	pseudoHeaderOrder []string,
 	maxResponseHeaderBytes int,
 	disableCompression bool,
 	logger *slog.Logger,
@@ -92,6 +103,7 @@ func newClientConn(
 		Options:            opts,
 		enableDatagrams:    enableDatagrams,
 		additionalSettings: additionalSettings,
+		settings:           settings,
 		disableCompression: disableCompression,
 		logger:             logger,
 	}
@@ -101,7 +113,7 @@ func newClientConn(
 		c.maxResponseHeaderBytes = maxResponseHeaderBytes
 	}
 	c.decoder = qpack.NewDecoder()
-	c.requestWriter = newRequestWriter()
+	c.requestWriter = newRequestWriter(pseudoHeaderOrder)
 	c.conn = newConnection(
 		conn.Context(),
 		conn,
@@ -146,6 +158,7 @@ func (c *ClientConn) setupConn() error {
 		Datagram:            c.enableDatagrams,
 		Other:               c.additionalSettings,
 		MaxFieldSectionSize: int64(c.maxResponseHeaderBytes),
+		Ordered:             c.settings,
 	}).Append(b)
 	if c.conn.qlogger != nil {
 		sf := qlog.SettingsFrame{
@@ -155,6 +168,12 @@ func (c *ClientConn) setupConn() error {
 		if c.enableDatagrams {
 			sf.Datagram = pointer(true)
 		}
+		if c.settings != nil {
+			sf = qlog.SettingsFrame{MaxFieldSectionSize: -1, Other: make(map[uint64]uint64)}
+			for _, s := range c.settings {
+				sf.Other[s.ID] = s.Val
+			}
+		}
 		c.conn.qlogger.RecordEvent(qlog.FrameCreated{
 			StreamID: str.StreamID(),
 			Raw:      qlog.RawInfo{Length: len(b)},
@@ -24,7 +24,10 @@ import (
 
 const maxQuarterStreamID = 1<<60 - 1
 
-var errGoAway = errors.New("connection in graceful shutdown")
+var (
+	errGoAway          = errors.New("connection in graceful shutdown")
+	errIdleConnTimeout = errors.New("http3: idle connection timeout")
+)
 
 // invalidStreamID is a stream ID that is invalid. The first valid stream ID in QUIC is 0.
 const invalidStreamID = quic.StreamID(-1)
@@ -49,6 +52,8 @@ type Conn struct {
 	streams      map[quic.StreamID]*stateTrackingStream
 	lastStreamID quic.StreamID
 	maxStreamID  quic.StreamID
+	connState    transport.MuxConnState
+	evictErr     error // why the idle conn is closed by the pool, see evict
 
 	settings         *Settings
 	receivedSettings chan struct{}
@@ -131,14 +136,56 @@ func (c *Conn) ConnectionState() quic.ConnectionState {
 }
 
 func (c *Conn) onIdleTimer() {
+	c.evict(errIdleConnTimeout)
 	c.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "idle timeout")
 }
 
+// trackState reports the state of c, a connection to addr, to the
+// ConnStateHook until c is closed.
+func (c *Conn) trackState(addr string) {
+	hook := c.connStateHook()
+	if hook == nil {
+		return
+	}
+	c.streamMx.Lock()
+	c.connState = transport.MuxConnState{Addr: addr, Proto: "HTTP/3.0"}
+	c.connState.Update(hook, len(c.streams))
+	c.streamMx.Unlock()
+	go func() {
+		<-c.conn.Context().Done()
+		c.streamMx.Lock()
+		if c.evictErr != nil {
+			c.connState.Close(hook, c.evictErr, true)
+		} else {
+			err := context.Cause(c.conn.Context())
+			var idleErr *quic.IdleTimeoutError
+			c.connState.Close(hook, err, errors.As(err, &idleErr))
+		}
+		c.streamMx.Unlock()
+	}()
+}
+
+// evict records err as the reason c is closed by the pool, it must be
+// called before closing c.
+func (c *Conn) evict(err error) {
+	c.streamMx.Lock()
+	c.evictErr = err
+	c.streamMx.Unlock()
+}
+
+func (c *Conn) connStateHook() func(*transport.ConnStateChange) {
+	if c.Options == nil {
+		return nil
+	}
+	return c.ConnStateHook
+}
+
 func (c *Conn) clearStream(id quic.StreamID) {
 	c.streamMx.Lock()
 	defer c.streamMx.Unlock()
 
 	delete(c.streams, id)
+	c.connState.Update(c.connStateHook(), len(c.streams))
 	if c.idleTimeout > 0 && len(c.streams) == 0 {
 		c.idleTimer.Reset(c.idleTimeout)
 	}
@@ -181,6 +228,7 @@ func (c *Conn) openRequestStream(
 	c.streamMx.Lock()
 	c.streams[str.StreamID()] = hstr
 	c.lastStreamID = str.StreamID()
+	c.connState.Update(c.connStateHook(), len(c.streams))
 	c.streamMx.Unlock()
 	rsp := &http.Response{}
 	trace := httptrace.ContextClientTrace(ctx)
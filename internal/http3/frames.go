@@ -166,12 +166,22 @@ const (
 	settingDatagram = 0x33
 )
 
+// A Setting is an HTTP/3 setting parameter.
+type Setting struct {
+	ID  uint64
+	Val uint64
+}
+
 type settingsFrame struct {
 	MaxFieldSectionSize int64 // SETTINGS_MAX_FIELD_SECTION_SIZE, -1 if not set
 
 	Datagram        bool              // HTTP Datagrams, RFC 9297
 	ExtendedConnect bool              // Extended CONNECT, RFC 9220
 	Other           map[uint64]uint64 // all settings that we don't explicitly recognize
+
+	// Ordered, if not nil, are the settings sent instead of the ones
+	// above, in this order. It is only used for sending.
+	Ordered []Setting
 }
 
 func pointer[T any](v T) *T {
@@ -262,6 +272,18 @@ func parseSettingsFrame(r *countingByteReader, l uint64, streamID quic.StreamID,
 
 func (f *settingsFrame) Append(b []byte) []byte {
 	b = quicvarint.Append(b, 0x4)
+	if f.Ordered != nil {
+		var l int
+		for _, s := range f.Ordered {
+			l += quicvarint.Len(s.ID) + quicvarint.Len(s.Val)
+		}
+		b = quicvarint.Append(b, uint64(l))
+		for _, s := range f.Ordered {
+			b = quicvarint.Append(b, s.ID)
+			b = quicvarint.Append(b, s.Val)
+		}
+		return b
+	}
 	var l int
 	if f.MaxFieldSectionSize >= 0 {
 		l += quicvarint.Len(settingMaxFieldSectionSize) + quicvarint.Len(uint64(f.MaxFieldSectionSize))
@@ -128,6 +128,36 @@ func TestSettingsFrameAppendParse(t *testing.T) {
 	}
 }
 
+func TestSettingsFrameAppendOrdered(t *testing.T) {
+	sf := &settingsFrame{
+		MaxFieldSectionSize: 1024,
+		Datagram:            true,
+		Ordered: []Setting{
+			{ID: 0x1, Val: 65536},
+			{ID: settingMaxFieldSectionSize, Val: 262144},
+			{ID: 0x7, Val: 100},
+			{ID: settingDatagram, Val: 1},
+		},
+	}
+	b := sf.Append(nil)
+
+	r := bytes.NewReader(b)
+	if typ, _ := quicvarint.Read(r); typ != 0x4 {
+		t.Fatalf("expected a SETTINGS frame, got type %d", typ)
+	}
+	quicvarint.Read(r) // length
+	for _, want := range sf.Ordered {
+		id, _ := quicvarint.Read(r)
+		val, _ := quicvarint.Read(r)
+		if id != want.ID || val != want.Val {
+			t.Fatalf("got setting %#x=%d, want %#x=%d", id, val, want.ID, want.Val)
+		}
+	}
+	if r.Len() != 0 {
+		t.Fatalf("%d unexpected trailing bytes", r.Len())
+	}
+}
+
 func TestGoAwayFrameAppendParse(t *testing.T) {
 	f := &goAwayFrame{StreamID: 42}
 	b := f.Append(nil)
@@ -30,14 +30,19 @@ type requestWriter struct {
 	mutex     sync.Mutex
 	encoder   *qpack.Encoder
 	headerBuf *bytes.Buffer
+
+	// pseudoHeaderOrder, if not empty, overrides the pseudo header order
+	// of the requests.
+	pseudoHeaderOrder []string
 }
 
-func newRequestWriter() *requestWriter {
+func newRequestWriter(pseudoHeaderOrder []string) *requestWriter {
 	headerBuf := &bytes.Buffer{}
 	encoder := qpack.NewEncoder(headerBuf)
 	return &requestWriter{
-		encoder:   encoder,
-		headerBuf: headerBuf,
+		encoder:           encoder,
+		headerBuf:         headerBuf,
+		pseudoHeaderOrder: pseudoHeaderOrder,
 	}
 }
 
@@ -147,11 +152,16 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		}
 	}
 
+	pseudoHeaderOrder := w.pseudoHeaderOrder
+	if len(pseudoHeaderOrder) == 0 && req.Header != nil {
+		pseudoHeaderOrder = req.Header[reqheader.PseudoHeaderOderKey]
+	}
+
 	enumerateHeaders := func(f func(name, value string)) {
 		var writeHeader func(name string, value ...string)
 		var kvs []reqheader.KeyValues
 		sort := false
-		if req.Header != nil && len(req.Header[reqheader.PseudoHeaderOderKey]) > 0 {
+		if len(pseudoHeaderOrder) > 0 {
 			writeHeader = func(name string, value ...string) {
 				kvs = append(kvs, reqheader.KeyValues{
 					Key:    name,
@@ -182,7 +192,7 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		}
 
 		if sort {
-			reqheader.SortKeyValues(kvs, req.Header[reqheader.PseudoHeaderOderKey])
+			reqheader.SortKeyValues(kvs, pseudoHeaderOrder)
 			for _, kv := range kvs {
 				for _, v := range kv.Values {
 					f(kv.Key, v)
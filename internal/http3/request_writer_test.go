@@ -0,0 +1,60 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	reqheader "github.com/imroc/req/v3/internal/header"
+	"github.com/quic-go/qpack"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func decodePseudoHeaders(t *testing.T, b []byte) []string {
+	t.Helper()
+	r := bytes.NewReader(b)
+	quicvarint.Read(r) // frame type
+	quicvarint.Read(r) // length
+	block := b[len(b)-r.Len():]
+	decode := qpack.NewDecoder().Decode(block)
+	var names []string
+	for {
+		hf, err := decode()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(hf.Name, ":") {
+			names = append(names, hf.Name)
+		}
+	}
+}
+
+func TestRequestWriterPseudoHeaderOrder(t *testing.T) {
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/path", nil)
+		req.Header[reqheader.PseudoHeaderOderKey] = []string{":path", ":authority", ":method", ":scheme"}
+		return req
+	}
+
+	var buf bytes.Buffer
+	if err := newRequestWriter(nil).writeHeaders(&buf, newRequest(), false, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(decodePseudoHeaders(t, buf.Bytes()), " "); got != ":path :authority :method :scheme" {
+		t.Fatalf("got pseudo header order %q from the request", got)
+	}
+
+	buf.Reset()
+	w := newRequestWriter([]string{":method", ":scheme", ":authority", ":path"})
+	if err := w.writeHeaders(&buf, newRequest(), false, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(decodePseudoHeaders(t, buf.Bytes()), " "); got != ":method :scheme :authority :path" {
+		t.Fatalf("got pseudo header order %q; want the order of the writer", got)
+	}
+}
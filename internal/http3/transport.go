@@ -10,10 +10,12 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/netip"
 	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/http/httpguts"
 
@@ -55,9 +57,18 @@ type roundTripperWithCount struct {
 }
 
 func (r *roundTripperWithCount) Close() error {
+	return r.close(nil)
+}
+
+// close closes the connection, evictErr is the reason it is closed by the
+// pool, if any.
+func (r *roundTripperWithCount) close(evictErr error) error {
 	r.cancel()
 	<-r.dialing
 	if r.conn != nil {
+		if cc, ok := r.clientConn.(*ClientConn); ok && evictErr != nil {
+			cc.conn.evict(evictErr)
+		}
 		return r.conn.CloseWithError(0, "")
 	}
 	return nil
@@ -67,9 +78,28 @@ func (r *roundTripperWithCount) Close() error {
 type Transport struct {
 	*transport.Options
 	// TLSClientConfig specifies the TLS configuration to use with
-	// tls.Client. If nil, the default configuration is used.
+	// tls.Client. If nil, the TLSClientConfig of Options is used, which is
+	// shared with HTTP/1 and HTTP/2, so that settings such as the root CAs,
+	// the client certificates and InsecureSkipVerify apply to HTTP/3 as
+	// well, or the default configuration if there is none.
 	TLSClientConfig *tls.Config
 
+	// VerifyConnection, if not nil, is called with the context of the dial
+	// and the server name of the connection after the VerifyConnection
+	// function of the TLS configuration.
+	VerifyConnection func(ctx context.Context, serverName string, cs tls.ConnectionState) error
+
+	// LookupNetIP, if not nil, resolves the host names to dial, in order of
+	// preference, the addresses are dialed in order until a connection
+	// succeeds. The default resolver is used if it returns no address and
+	// no error.
+	LookupNetIP func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	// GetOptions, if not nil, returns the Options of the new connections
+	// instead of Options, so that changes of the options apply to the
+	// connections dialed afterwards.
+	GetOptions func() *transport.Options
+
 	// QUICConfig is the quic.Config used for dialing new connections.
 	// If nil, reasonable default values will be used.
 	QUICConfig *quic.Config
@@ -80,6 +110,13 @@ type Transport struct {
 	// and will be reused for subsequent connections to other servers.
 	Dial func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
 
+	// ProxyPacketConn optionally returns a PacketConn relaying datagrams
+	// through proxyURL, the proxy returned by Proxy for the request, e.g.
+	// over SOCKS5 UDP ASSOCIATE. If the PacketConn implements AddrResolver,
+	// the address of the server is resolved by the PacketConn instead of
+	// LookupNetIP. Connections are pooled per proxy.
+	ProxyPacketConn func(ctx context.Context, proxyURL *url.URL) (net.PacketConn, error)
+
 	// Enable support for HTTP/3 datagrams (RFC 9297).
 	// If a QUICConfig is set, datagram support also needs to be enabled on the QUIC layer by setting EnableDatagrams.
 	EnableDatagrams bool
@@ -88,6 +125,17 @@ type Transport struct {
 	// It is invalid to specify any settings defined by RFC 9114 (HTTP/3) and RFC 9297 (HTTP Datagrams).
 	AdditionalSettings map[uint64]uint64
 
+	// Settings, if not nil, is the exact content of the SETTINGS frame,
+	// sent in this order instead of the settings derived from
+	// EnableDatagrams, AdditionalSettings and MaxResponseHeaderBytes.
+	// It allows to mimic the SETTINGS frame of other clients.
+	Settings []Setting
+
+	// PseudoHeaderOrder, if not empty, is the order of the pseudo header
+	// fields of requests, it takes precedence over the order set in the
+	// request header.
+	PseudoHeaderOrder []string
+
 	// MaxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
 	// Zero means to use a default limit.
@@ -124,16 +172,28 @@ var (
 	ErrNoCachedConn = errors.New("http3: no cached connection was available")
 	// ErrTransportClosed is returned when attempting to use a closed Transport
 	ErrTransportClosed = errors.New("http3: transport is closed")
+
+	errCloseIdleConns = errors.New("http3: CloseIdleConnections called")
 )
 
+// options returns the Options of the new connections.
+func (t *Transport) options() *transport.Options {
+	if t.GetOptions != nil {
+		return t.GetOptions()
+	}
+	return t.Options
+}
+
 func (t *Transport) init() error {
 	if t.newClientConn == nil {
 		t.newClientConn = func(conn *quic.Conn) clientConn {
 			c := newClientConn(
-				t.Options,
+				t.options(),
 				conn,
 				t.EnableDatagrams,
 				t.AdditionalSettings,
+				t.Settings,
+				t.PseudoHeaderOrder,
 				t.MaxResponseHeaderBytes,
 				t.DisableCompression,
 				t.Logger,
@@ -217,12 +277,24 @@ func (t *Transport) roundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 
 func (t *Transport) doRoundTripOpt(req *http.Request, opt RoundTripOpt, isRetried bool) (*http.Response, error) {
 	hostname := authorityAddr(hostnameFromURL(req.URL))
+	key := hostname
+	var proxyURL *url.URL
+	if t.ProxyPacketConn != nil && t.Proxy != nil {
+		var err error
+		proxyURL, err = t.Proxy(req)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL != nil {
+			key = proxyURL.String() + "|" + hostname
+		}
+	}
 	trace := httptrace.ContextClientTrace(req.Context())
 	traceGetConn(trace, hostname)
-	cl, isReused, err := t.getClient(req.Context(), hostname, opt.OnlyCachedConn)
+	cl, isReused, err := t.getClient(req.Context(), key, hostname, proxyURL, opt.OnlyCachedConn)
 	if err != ErrNoCachedConn {
-		if debugf := t.Debugf; debugf != nil {
-			debugf("HTTP/3 %s %s", req.Method, req.URL.String())
+		if opts := t.options(); opts != nil && opts.Debugf != nil {
+			opts.Debugf("HTTP/3 %s %s", req.Method, req.URL.String())
 		}
 	}
 	if err != nil {
@@ -236,7 +308,7 @@ func (t *Transport) doRoundTripOpt(req *http.Request, opt RoundTripOpt, isRetrie
 	}
 
 	if cl.dialErr != nil {
-		t.removeClient(hostname)
+		t.removeClient(key)
 		return nil, cl.dialErr
 	}
 	defer cl.useCount.Add(-1)
@@ -253,7 +325,7 @@ func (t *Transport) doRoundTripOpt(req *http.Request, opt RoundTripOpt, isRetrie
 			return nil, err
 		}
 
-		t.removeClient(hostname)
+		t.removeClient(key)
 		req, err = canRetryRequest(err, req)
 		if err != nil {
 			return nil, err
@@ -304,17 +376,27 @@ func (t *Transport) RoundTripOnlyCachedConn(req *http.Request) (*http.Response,
 	return t.RoundTripOpt(req, RoundTripOpt{OnlyCachedConn: true})
 }
 
-// AddConn add a http3 connection, dial new conn if not exists.
-func (t *Transport) AddConn(ctx context.Context, addr string) error {
+// AddConn add a http3 connection, dial new conn if not exists, through
+// proxyURL if not nil, see ProxyPacketConn.
+func (t *Transport) AddConn(ctx context.Context, addr string, proxyURL *url.URL) error {
 	addr = authorityAddr(addr)
-	cl, _, err := t.getClient(ctx, addr, false)
+	key := addr
+	if t.ProxyPacketConn == nil {
+		proxyURL = nil
+	}
+	if proxyURL != nil {
+		key = proxyURL.String() + "|" + addr
+	}
+	cl, _, err := t.getClient(ctx, key, addr, proxyURL, false)
 	if err == nil {
 		cl.useCount.Add(-1)
 	}
 	return err
 }
 
-func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached bool) (rtc *roundTripperWithCount, isReused bool, err error) {
+// getClient returns the client cached under key, dialing hostname through
+// proxyURL if there is none.
+func (t *Transport) getClient(ctx context.Context, key, hostname string, proxyURL *url.URL, onlyCached bool) (rtc *roundTripperWithCount, isReused bool, err error) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 	if t.closed {
@@ -325,7 +407,7 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 		t.clients = make(map[string]*roundTripperWithCount)
 	}
 
-	cl, ok := t.clients[hostname]
+	cl, ok := t.clients[key]
 	if !ok {
 		if onlyCached {
 			return nil, false, ErrNoCachedConn
@@ -338,7 +420,7 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 		go func() {
 			defer close(cl.dialing)
 			defer cancel()
-			conn, rt, err := t.dial(ctx, hostname)
+			conn, rt, err := t.dial(ctx, hostname, proxyURL)
 			if err != nil {
 				cl.dialErr = err
 				return
@@ -346,12 +428,12 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 			cl.conn = conn
 			cl.clientConn = rt
 		}()
-		t.clients[hostname] = cl
+		t.clients[key] = cl
 	}
 	select {
 	case <-cl.dialing:
 		if cl.dialErr != nil {
-			delete(t.clients, hostname)
+			delete(t.clients, key)
 			return nil, false, cl.dialErr
 		}
 		select {
@@ -365,12 +447,17 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 	return cl, isReused, nil
 }
 
-func (t *Transport) dial(ctx context.Context, hostname string) (*quic.Conn, clientConn, error) {
+func (t *Transport) dial(ctx context.Context, hostname string, proxyURL *url.URL) (*quic.Conn, clientConn, error) {
 	var tlsConf *tls.Config
-	if t.TLSClientConfig == nil {
-		tlsConf = &tls.Config{}
-	} else {
+	opts := t.options()
+	switch {
+	case t.TLSClientConfig != nil:
 		tlsConf = t.TLSClientConfig.Clone()
+	case opts != nil && opts.TLSClientConfig != nil:
+		// Use the TLS configuration shared with HTTP/1 and HTTP/2.
+		tlsConf = opts.TLSClientConfig.Clone()
+	default:
+		tlsConf = &tls.Config{}
 	}
 	if tlsConf.ServerName == "" {
 		sni, _, err := net.SplitHostPort(hostname)
@@ -382,36 +469,151 @@ func (t *Transport) dial(ctx context.Context, hostname string) (*quic.Conn, clie
 	}
 	// Replace existing ALPNs by H3
 	tlsConf.NextProtos = []string{NextProtoH3}
+	if verify := t.VerifyConnection; verify != nil {
+		userVerify, serverName := tlsConf.VerifyConnection, tlsConf.ServerName
+		tlsConf.VerifyConnection = func(cs tls.ConnectionState) error {
+			if userVerify != nil {
+				if err := userVerify(cs); err != nil {
+					return err
+				}
+			}
+			return verify(ctx, serverName, cs)
+		}
+	}
 
 	dial := t.Dial
+	if proxyURL != nil {
+		pc, err := t.ProxyPacketConn(ctx, proxyURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			return t.dialPacketConn(ctx, pc, addr, tlsCfg, cfg)
+		}
+	}
 	if dial == nil {
 		dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
-			network := "udp"
-			udpAddr, err := t.resolveUDPAddr(ctx, network, addr)
+			udpAddrs, err := t.resolveUDPAddrs(ctx, "udp", addr)
 			if err != nil {
 				return nil, err
 			}
-			trace := httptrace.ContextClientTrace(ctx)
-			traceConnectStart(trace, network, udpAddr.String())
-			traceTLSHandshakeStart(trace)
-			conn, err := t.transport.DialEarly(ctx, udpAddr, tlsCfg, cfg)
-			var state tls.ConnectionState
-			if conn != nil {
-				state = conn.ConnectionState().TLS
-			}
-			traceTLSHandshakeDone(trace, state, err)
-			traceConnectDone(trace, network, udpAddr.String(), err)
-			return conn, err
+			return dialAddrs(ctx, udpAddrs, func(ctx context.Context, udpAddr net.Addr) (*quic.Conn, error) {
+				return dialEarlyTraced(ctx, t.transport, udpAddr, tlsCfg, cfg)
+			})
 		}
 	}
 	conn, err := dial(ctx, hostname, tlsConf, t.QUICConfig)
 	if err != nil {
 		return nil, nil, err
 	}
-	return conn, t.newClientConn(conn), nil
+	cc := t.newClientConn(conn)
+	if c, ok := cc.(*ClientConn); ok {
+		c.conn.trackState(hostname)
+	}
+	return conn, cc, nil
 }
 
-func (t *Transport) resolveUDPAddr(ctx context.Context, network, addr string) (*net.UDPAddr, error) {
+// AddrResolver is implemented by the PacketConns returned by
+// ProxyPacketConn whose proxy resolves the domain names, e.g. a SOCKS5
+// proxy.
+type AddrResolver interface {
+	// ResolveAddr returns the address the datagrams to addr, a host and
+	// port, are sent to.
+	ResolveAddr(addr string) (net.Addr, error)
+}
+
+// dialPacketConn dials addr over pc, which is closed along with the QUIC
+// connection.
+func (t *Transport) dialPacketConn(ctx context.Context, pc net.PacketConn, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	var udpAddrs []net.Addr
+	var err error
+	if r, ok := pc.(AddrResolver); ok {
+		var udpAddr net.Addr
+		udpAddr, err = r.ResolveAddr(addr)
+		udpAddrs = []net.Addr{udpAddr}
+	} else {
+		udpAddrs, err = t.resolveUDPAddrs(ctx, "udp", addr)
+	}
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	tr := &quic.Transport{Conn: pc}
+	conn, err := dialAddrs(ctx, udpAddrs, func(ctx context.Context, udpAddr net.Addr) (*quic.Conn, error) {
+		return dialEarlyTraced(ctx, tr, udpAddr, tlsCfg, cfg)
+	})
+	if err != nil {
+		tr.Close()
+		pc.Close()
+		return nil, err
+	}
+	go func() {
+		<-conn.Context().Done()
+		tr.Close()
+		pc.Close()
+	}()
+	return conn, nil
+}
+
+// dialEarlyTraced dials udpAddr with tr and reports the dial to the client
+// trace of ctx.
+func dialEarlyTraced(ctx context.Context, tr *quic.Transport, udpAddr net.Addr, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	network := "udp"
+	trace := httptrace.ContextClientTrace(ctx)
+	traceConnectStart(trace, network, udpAddr.String())
+	traceTLSHandshakeStart(trace)
+	conn, err := tr.DialEarly(ctx, udpAddr, tlsCfg, cfg)
+	var state tls.ConnectionState
+	if conn != nil {
+		state = conn.ConnectionState().TLS
+	}
+	traceTLSHandshakeDone(trace, state, err)
+	traceConnectDone(trace, network, udpAddr.String(), err)
+	return conn, err
+}
+
+// dialAddrs dials the addresses in order until a connection succeeds, the
+// deadline of ctx is shared by the dials like net.Dialer does.
+func dialAddrs(ctx context.Context, addrs []net.Addr, dial func(context.Context, net.Addr) (*quic.Conn, error)) (*quic.Conn, error) {
+	var firstErr error
+	for i, addr := range addrs {
+		dialCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok && i < len(addrs)-1 {
+			var cancel context.CancelFunc
+			dialCtx, cancel = context.WithDeadline(ctx, partialDeadline(deadline, len(addrs)-i))
+			defer cancel()
+		}
+		conn, err := dial(dialCtx, addr)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// partialDeadline returns the deadline of one of the remaining dials
+// before deadline, with a minimum of 2 seconds.
+func partialDeadline(deadline time.Time, remaining int) time.Time {
+	timeout := time.Until(deadline) / time.Duration(remaining)
+	if timeout < 2*time.Second {
+		timeout = 2 * time.Second
+	}
+	if d := time.Now().Add(timeout); d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// resolveUDPAddrs returns the addresses to dial for addr, all the addresses
+// returned by LookupNetIP, or the preferred address of the default
+// resolver.
+func (t *Transport) resolveUDPAddrs(ctx context.Context, network, addr string) ([]net.Addr, error) {
 	host, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -420,6 +622,19 @@ func (t *Transport) resolveUDPAddr(ctx context.Context, network, addr string) (*
 	if err != nil {
 		return nil, err
 	}
+	if t.LookupNetIP != nil {
+		ips, err := t.LookupNetIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) > 0 {
+			udpAddrs := make([]net.Addr, len(ips))
+			for i, ip := range ips {
+				udpAddrs[i] = net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port)))
+			}
+			return udpAddrs, nil
+		}
+	}
 	resolver := net.DefaultResolver
 	ipAddrs, err := resolver.LookupIPAddr(ctx, host)
 	if err != nil {
@@ -427,7 +642,7 @@ func (t *Transport) resolveUDPAddr(ctx context.Context, network, addr string) (*
 	}
 	addrs := addrList(ipAddrs)
 	ip := addrs.forResolve(network, addr)
-	return &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
+	return []net.Addr{&net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}}, nil
 }
 
 func (t *Transport) removeClient(hostname string) {
@@ -447,10 +662,12 @@ func (t *Transport) removeClient(hostname string) {
 // using Extended CONNECT for WebTransport or the various MASQUE protocols.
 func (t *Transport) NewClientConn(conn *quic.Conn) *ClientConn {
 	c := newClientConn(
-		t.Options,
+		t.options(),
 		conn,
 		t.EnableDatagrams,
 		t.AdditionalSettings,
+		t.Settings,
+		t.PseudoHeaderOrder,
 		t.MaxResponseHeaderBytes,
 		t.DisableCompression,
 		t.Logger,
@@ -466,10 +683,12 @@ func (t *Transport) NewClientConn(conn *quic.Conn) *ClientConn {
 func (t *Transport) NewRawClientConn(conn *quic.Conn) *RawClientConn {
 	return &RawClientConn{
 		ClientConn: newClientConn(
-			t.Options,
+			t.options(),
 			conn,
 			t.EnableDatagrams,
 			t.AdditionalSettings,
+			t.Settings,
+			t.PseudoHeaderOrder,
 			t.MaxResponseHeaderBytes,
 			t.DisableCompression,
 			t.Logger,
@@ -552,7 +771,7 @@ func (t *Transport) CloseIdleConnections() {
 	defer t.mutex.Unlock()
 	for hostname, cl := range t.clients {
 		if cl.useCount.Load() == 0 {
-			cl.Close()
+			cl.close(errCloseIdleConns)
 			delete(t.clients, hostname)
 		}
 	}
@@ -0,0 +1,87 @@
+package socks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// A BindListener is a listener for the single incoming connection the
+// proxy server accepts on behalf of the client after a BIND command,
+// e.g. the data connection of active mode FTP.
+type BindListener struct {
+	d    *Dialer
+	conn net.Conn
+	addr net.Addr
+
+	accepting atomic.Bool
+	mu        sync.Mutex
+	accepted  bool // a connection has been returned by Accept
+	closed    bool
+}
+
+// Bind asks the proxy server to listen for an incoming connection from
+// address, which is usually the address of the server the client is
+// already connected to through the proxy. The address the proxy server
+// listens on is returned by the Addr method of the listener, it must be
+// sent to the remote peer before calling Accept.
+func (d *Dialer) Bind(ctx context.Context, network, address string) (*BindListener, error) {
+	bd := *d
+	bd.cmd = CmdBind
+	c, err := bd.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.(*Conn)
+	return &BindListener{d: &bd, conn: conn.Conn, addr: conn.boundAddr}, nil
+}
+
+// Addr returns the address the proxy server listens on.
+func (l *BindListener) Addr() net.Addr {
+	return l.addr
+}
+
+// Accept waits for the remote peer to connect to the proxy server and
+// returns the connection, whose BoundAddr is the address of the peer.
+// Only one connection can be accepted.
+func (l *BindListener) Accept() (net.Conn, error) {
+	if !l.accepting.CompareAndSwap(false, true) {
+		return nil, errors.New("socks bind: only one connection can be accepted")
+	}
+	var (
+		a   *Addr
+		err error
+	)
+	if l.d.version() == Version4 {
+		a, err = readReply4(l.conn)
+	} else {
+		a, err = readReply5(l.conn)
+	}
+	if err != nil {
+		l.conn.Close()
+		proxy, _, _ := l.d.pathAddrs(l.addr.String())
+		return nil, &net.OpError{Op: CmdBind.String(), Net: "tcp", Source: proxy, Addr: l.addr, Err: err}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		// Close raced with the reply, the connection is closed.
+		return nil, net.ErrClosed
+	}
+	l.accepted = true
+	return &Conn{Conn: l.conn, boundAddr: a}, nil
+}
+
+// Close closes the listener, unblocking a pending Accept. It does not
+// close the connection returned by Accept.
+func (l *BindListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.accepted || l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.conn.Close()
+}
@@ -18,11 +18,17 @@ var (
 	aLongTimeAgo = time.Unix(1, 0)
 )
 
-func (d *Dialer) connect(ctx context.Context, c net.Conn, address string) (_ net.Addr, ctxErr error) {
+func (d *Dialer) connect(ctx context.Context, c net.Conn, address string) (net.Addr, error) {
 	host, port, err := splitHostPort(address)
 	if err != nil {
 		return nil, err
 	}
+	return d.request(ctx, c, host, port)
+}
+
+// request runs the handshake of d.cmd for host and port on c, honoring
+// the deadline and cancellation of ctx.
+func (d *Dialer) request(ctx context.Context, c net.Conn, host string, port int) (_ net.Addr, ctxErr error) {
 	if deadline, ok := ctx.Deadline(); ok && !deadline.IsZero() {
 		c.SetDeadline(deadline)
 		defer c.SetDeadline(noDeadline)
@@ -60,7 +66,7 @@ func (d *Dialer) connect(ctx context.Context, c net.Conn, address string) (_ net
 // Matches the practical FQDN limit used by SOCKS5 in this package.
 const maxSocks4aDomainLen = 255
 
-// connect4 implements the SOCKS4 and SOCKS4a CONNECT handshake.
+// connect4 implements the SOCKS4 and SOCKS4a handshake of d.cmd.
 func (d *Dialer) connect4(ctx context.Context, c net.Conn, host string, port int) (net.Addr, error) {
 	if err := validateSocks4CString(d.UserID, "user ID"); err != nil {
 		return nil, err
@@ -117,8 +123,12 @@ func (d *Dialer) connect4(ctx context.Context, c net.Conn, host string, port int
 	if _, err := c.Write(b); err != nil {
 		return nil, err
 	}
+	return readReply4(c)
+}
 
-	// Reply is always 8 bytes: VN | CD | DSTPORT | DSTIP
+// readReply4 reads a SOCKS4 reply, which is always 8 bytes:
+// VN | CD | DSTPORT | DSTIP
+func readReply4(c io.Reader) (*Addr, error) {
 	var resp [8]byte
 	if _, err := io.ReadFull(c, resp[:]); err != nil {
 		return nil, err
@@ -128,7 +138,7 @@ func (d *Dialer) connect4(ctx context.Context, c net.Conn, host string, port int
 		return nil, errors.New("unexpected protocol version " + strconv.Itoa(int(resp[0])))
 	}
 	if code := Reply(resp[1]); code != Status4Granted {
-		return nil, errors.New(code.String())
+		return nil, &ReplyError{Version: Version4, Code: code}
 	}
 
 	a := &Addr{
@@ -148,7 +158,7 @@ func validateSocks4CString(s, field string) error {
 	return nil
 }
 
-// connect5 implements the SOCKS5 CONNECT handshake.
+// connect5 implements the SOCKS5 handshake of d.cmd.
 func (d *Dialer) connect5(ctx context.Context, c net.Conn, host string, port int) (net.Addr, error) {
 	b := make([]byte, 0, 6+len(host)) // the size here is just an estimate
 	b = append(b, Version5)
@@ -184,8 +194,19 @@ func (d *Dialer) connect5(ctx context.Context, c net.Conn, host string, port int
 		}
 	}
 
-	b = b[:0]
-	b = append(b, Version5, byte(d.cmd), 0)
+	b = append(b[:0], Version5, byte(d.cmd), 0)
+	b, err := appendAddr(b, host, port)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Write(b); err != nil {
+		return nil, err
+	}
+	return readReply5(c)
+}
+
+// appendAddr appends ATYP | ADDR | PORT in SOCKS5 wire format to b.
+func appendAddr(b []byte, host string, port int) ([]byte, error) {
 	if ip := net.ParseIP(host); ip != nil {
 		if ip4 := ip.To4(); ip4 != nil {
 			b = append(b, AddrTypeIPv4)
@@ -204,26 +225,32 @@ func (d *Dialer) connect5(ctx context.Context, c net.Conn, host string, port int
 		b = append(b, byte(len(host)))
 		b = append(b, host...)
 	}
-	b = append(b, byte(port>>8), byte(port))
-	if _, err := c.Write(b); err != nil {
-		return nil, err
-	}
+	return append(b, byte(port>>8), byte(port)), nil
+}
 
+// readReply5 reads a SOCKS5 reply: VER | REP | RSV | ATYP | ADDR | PORT
+func readReply5(c io.Reader) (*Addr, error) {
+	b := make([]byte, 4, 6+255)
 	if _, err := io.ReadFull(c, b[:4]); err != nil {
 		return nil, err
 	}
 	if b[0] != Version5 {
 		return nil, errors.New("unexpected protocol version " + strconv.Itoa(int(b[0])))
 	}
-	if cmdErr := Reply(b[1]); cmdErr != StatusSucceeded {
-		return nil, errors.New("unknown error " + cmdErr.String())
+	if code := Reply(b[1]); code != StatusSucceeded {
+		return nil, &ReplyError{Version: Version5, Code: code}
 	}
 	if b[2] != 0 {
 		return nil, errors.New("non-zero reserved field")
 	}
+	return readAddr(c, b[3], b)
+}
+
+// readAddr reads an ADDR | PORT of type atyp from c, b is a scratch buffer.
+func readAddr(c io.Reader, atyp byte, b []byte) (*Addr, error) {
 	l := 2
 	var a Addr
-	switch b[3] {
+	switch atyp {
 	case AddrTypeIPv4:
 		l += net.IPv4len
 		a.IP = make(net.IP, net.IPv4len)
@@ -231,12 +258,13 @@ func (d *Dialer) connect5(ctx context.Context, c net.Conn, host string, port int
 		l += net.IPv6len
 		a.IP = make(net.IP, net.IPv6len)
 	case AddrTypeFQDN:
-		if _, err := io.ReadFull(c, b[:1]); err != nil {
+		b = b[:1]
+		if _, err := io.ReadFull(c, b); err != nil {
 			return nil, err
 		}
 		l += int(b[0])
 	default:
-		return nil, errors.New("unknown address type " + strconv.Itoa(int(b[3])))
+		return nil, errors.New("unknown address type " + strconv.Itoa(int(atyp)))
 	}
 	if cap(b) < l {
 		b = make([]byte, l)
@@ -32,8 +32,10 @@ func (cmd Command) String() string {
 	switch cmd {
 	case CmdConnect:
 		return "socks connect"
-	case cmdBind:
+	case CmdBind:
 		return "socks bind"
+	case CmdUDPAssociate:
+		return "socks udp associate"
 	default:
 		return "socks " + strconv.Itoa(int(cmd))
 	}
@@ -50,21 +52,21 @@ func (code Reply) String() string {
 	// SOCKS5 reply codes
 	case StatusSucceeded:
 		return "succeeded"
-	case 0x01:
+	case StatusGeneralFailure:
 		return "general SOCKS server failure"
-	case 0x02:
+	case StatusNotAllowed:
 		return "connection not allowed by ruleset"
-	case 0x03:
+	case StatusNetworkUnreachable:
 		return "network unreachable"
-	case 0x04:
+	case StatusHostUnreachable:
 		return "host unreachable"
-	case 0x05:
+	case StatusConnectionRefused:
 		return "connection refused"
-	case 0x06:
+	case StatusTTLExpired:
 		return "TTL expired"
-	case 0x07:
+	case StatusCommandNotSupported:
 		return "command not supported"
-	case 0x08:
+	case StatusAddrTypeNotSupported:
 		return "address type not supported"
 	// SOCKS4 reply codes
 	case Status4Granted:
@@ -89,15 +91,24 @@ const (
 	AddrTypeFQDN = 0x03
 	AddrTypeIPv6 = 0x04
 
-	CmdConnect Command = 0x01 // establishes an active-open forward proxy connection
-	cmdBind    Command = 0x02 // establishes a passive-open forward proxy connection
+	CmdConnect      Command = 0x01 // establishes an active-open forward proxy connection
+	CmdBind         Command = 0x02 // establishes a passive-open forward proxy connection
+	CmdUDPAssociate Command = 0x03 // establishes a UDP relay, SOCKS5 only
 
 	AuthMethodNotRequired         AuthMethod = 0x00 // no authentication required
 	AuthMethodUsernamePassword    AuthMethod = 0x02 // use username/password
 	AuthMethodNoAcceptableMethods AuthMethod = 0xff // no acceptable authentication methods
 
 	// SOCKS5 reply codes
-	StatusSucceeded Reply = 0x00
+	StatusSucceeded            Reply = 0x00
+	StatusGeneralFailure       Reply = 0x01
+	StatusNotAllowed           Reply = 0x02
+	StatusNetworkUnreachable   Reply = 0x03
+	StatusHostUnreachable      Reply = 0x04
+	StatusConnectionRefused    Reply = 0x05
+	StatusTTLExpired           Reply = 0x06
+	StatusCommandNotSupported  Reply = 0x07
+	StatusAddrTypeNotSupported Reply = 0x08
 
 	// SOCKS4 reply codes
 	Status4Granted        Reply = 90
@@ -106,6 +117,54 @@ const (
 	Status4IdentdMismatch Reply = 93
 )
 
+// A ReplyError is returned when the proxy server replies to a command
+// with a failure code.
+type ReplyError struct {
+	Version int   // Version4 or Version5
+	Code    Reply // the reply code
+}
+
+func (e *ReplyError) Error() string {
+	return "socks" + strconv.Itoa(e.Version) + ": " + e.Code.String()
+}
+
+// Is reports whether target is a *ReplyError with the same version and
+// code, so that errors.Is can be used with ErrGeneralFailure and friends.
+func (e *ReplyError) Is(target error) bool {
+	t, ok := target.(*ReplyError)
+	return ok && t.Version == e.Version && t.Code == e.Code
+}
+
+// Temporary reports whether the failure may not happen again, e.g. the
+// target was unreachable, as opposed to the command being refused by the
+// proxy server's ruleset.
+func (e *ReplyError) Temporary() bool {
+	if e.Version == Version4 {
+		return e.Code == Status4Rejected
+	}
+	switch e.Code {
+	case StatusGeneralFailure, StatusNetworkUnreachable, StatusHostUnreachable,
+		StatusConnectionRefused, StatusTTLExpired:
+		return true
+	}
+	return false
+}
+
+// Reply errors that can be matched with errors.Is.
+var (
+	ErrGeneralFailure       = &ReplyError{Version5, StatusGeneralFailure}
+	ErrNotAllowed           = &ReplyError{Version5, StatusNotAllowed}
+	ErrNetworkUnreachable   = &ReplyError{Version5, StatusNetworkUnreachable}
+	ErrHostUnreachable      = &ReplyError{Version5, StatusHostUnreachable}
+	ErrConnectionRefused    = &ReplyError{Version5, StatusConnectionRefused}
+	ErrTTLExpired           = &ReplyError{Version5, StatusTTLExpired}
+	ErrCommandNotSupported  = &ReplyError{Version5, StatusCommandNotSupported}
+	ErrAddrTypeNotSupported = &ReplyError{Version5, StatusAddrTypeNotSupported}
+	Err4Rejected            = &ReplyError{Version4, Status4Rejected}
+	Err4IdentdFailed        = &ReplyError{Version4, Status4IdentdFailed}
+	Err4IdentdMismatch      = &ReplyError{Version4, Status4IdentdMismatch}
+)
+
 // An Addr represents a SOCKS-specific address.
 // Either Name or IP is used exclusively.
 type Addr struct {
@@ -146,7 +205,7 @@ func (c *Conn) BoundAddr() net.Addr {
 
 // A Dialer holds SOCKS-specific options.
 type Dialer struct {
-	cmd          Command // either CmdConnect or cmdBind
+	cmd          Command // either CmdConnect or CmdBind
 	proxyNetwork string  // network between a proxy server and a client
 	proxyAddress string  // proxy server address
 
@@ -257,7 +316,7 @@ func (d *Dialer) validateTarget(network, address string) error {
 		return errors.New("network not implemented")
 	}
 	switch d.cmd {
-	case CmdConnect, cmdBind:
+	case CmdConnect, CmdBind:
 	default:
 		return errors.New("command not implemented")
 	}
@@ -0,0 +1,308 @@
+package socks
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/quic-go/quic-go"
+)
+
+// startSocks5Server starts a minimal SOCKS5 test server without
+// authentication, handle is called with the connection once the command
+// request has been read and must write the replies.
+func startSocks5Server(t *testing.T, handle func(c net.Conn, cmd Command, dst *Addr)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				b := make([]byte, 262)
+				if _, err := io.ReadFull(c, b[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(c, b[:b[1]]); err != nil {
+					return
+				}
+				if _, err := c.Write([]byte{Version5, byte(AuthMethodNotRequired)}); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(c, b[:4]); err != nil {
+					return
+				}
+				cmd := Command(b[1])
+				dst, err := readAddr(c, b[3], b)
+				if err != nil {
+					return
+				}
+				handle(c, cmd, dst)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func writeReply5(c net.Conn, code Reply, a net.Addr) {
+	addr := &Addr{IP: net.IPv4zero}
+	if a != nil {
+		host, port, _ := splitHostPort(a.String())
+		addr = &Addr{IP: net.ParseIP(host), Port: port}
+	}
+	b, _ := MarshalCmdReply(Version5, code, addr)
+	c.Write(b)
+}
+
+func TestReplyError(t *testing.T) {
+	addr := startSocks5Server(t, func(c net.Conn, cmd Command, dst *Addr) {
+		writeReply5(c, StatusConnectionRefused, nil)
+	})
+	d := NewDialer("tcp", addr)
+	_, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:80")
+	if !errors.Is(err, ErrConnectionRefused) {
+		t.Fatalf("got %v; want ErrConnectionRefused", err)
+	}
+	var re *ReplyError
+	if !errors.As(err, &re) || re.Code != StatusConnectionRefused || !re.Temporary() {
+		t.Fatalf("got %#v; want a temporary ReplyError", re)
+	}
+	if errors.Is(err, ErrNotAllowed) || ErrNotAllowed.Temporary() {
+		t.Fatal("ErrNotAllowed must not match nor be temporary")
+	}
+}
+
+// serveUDPAssociate relays datagrams between the client and their
+// destinations until the control connection is closed.
+func serveUDPAssociate(c net.Conn) {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		writeReply5(c, StatusGeneralFailure, nil)
+		return
+	}
+	defer relay.Close()
+	writeReply5(c, StatusSucceeded, relay.LocalAddr())
+	go func() {
+		io.Copy(io.Discard, c)
+		relay.Close()
+	}()
+	var client *net.UDPAddr
+	b := make([]byte, 65535)
+	for {
+		n, from, err := relay.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		if client == nil || (from.IP.Equal(client.IP) && from.Port == client.Port) {
+			client = from
+			r := bytes.NewReader(b[4:n])
+			dst, err := readAddr(r, b[3], make([]byte, 0, 257))
+			if err != nil {
+				continue
+			}
+			if dst.Name != "" {
+				ip, err := net.ResolveIPAddr("ip4", dst.Name)
+				if err != nil {
+					continue
+				}
+				dst.IP = ip.IP
+			}
+			relay.WriteToUDP(b[n-r.Len():n], &net.UDPAddr{IP: dst.IP, Port: dst.Port})
+			continue
+		}
+		hdr, _ := appendAddr([]byte{0, 0, 0}, from.IP.String(), from.Port)
+		relay.WriteToUDP(append(hdr, b[:n]...), client)
+	}
+}
+
+func TestListenPacket(t *testing.T) {
+	addr := startSocks5Server(t, func(c net.Conn, cmd Command, dst *Addr) {
+		if cmd != CmdUDPAssociate {
+			writeReply5(c, StatusCommandNotSupported, nil)
+			return
+		}
+		serveUDPAssociate(c)
+	})
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(b[:n], from)
+		}
+	}()
+
+	pc, err := NewDialer("tcp", addr).ListenPacket(context.Background(), "udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	pc.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := pc.WriteTo([]byte("hello"), echo.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1500)
+	n, from, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "hello" || from.String() != echo.LocalAddr().String() {
+		t.Fatalf("got %q from %v; want %q from %v", b[:n], from, "hello", echo.LocalAddr())
+	}
+
+	// Domain names are resolved by the proxy server.
+	_, port, _ := net.SplitHostPort(echo.LocalAddr().String())
+	dst, err := pc.ResolveAddr(net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := dst.(*Addr); !ok || a.Name != "localhost" {
+		t.Fatalf("ResolveAddr() = %#v; want the domain name", dst)
+	}
+	if _, err := pc.WriteTo([]byte("by name"), dst); err != nil {
+		t.Fatal(err)
+	}
+	if n, _, err = pc.ReadFrom(b); err != nil || string(b[:n]) != "by name" {
+		t.Fatalf("got %q, %v; want %q", b[:n], err, "by name")
+	}
+
+	// QUIC runs on top of the relayed PacketConn.
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		str, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		io.Copy(str, str)
+		str.Close()
+	}()
+	pc.SetDeadline(time.Time{})
+	tr := &quic.Transport{Conn: pc}
+	defer tr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tr.Dial(ctx, ln.Addr(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+	str, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str.Write([]byte("over quic"))
+	str.Close()
+	got, err := io.ReadAll(str)
+	if err != nil || string(got) != "over quic" {
+		t.Fatalf("got %q, %v; want %q", got, err, "over quic")
+	}
+}
+
+func TestListenPacketRequiresSocks5(t *testing.T) {
+	d := NewDialer("tcp", "127.0.0.1:1080")
+	d.Version = Version4
+	if _, err := d.ListenPacket(context.Background(), "udp"); err == nil {
+		t.Fatal("expected an error for SOCKS4")
+	}
+}
+
+func TestBind(t *testing.T) {
+	addr := startSocks5Server(t, func(c net.Conn, cmd Command, dst *Addr) {
+		if cmd != CmdBind {
+			writeReply5(c, StatusCommandNotSupported, nil)
+			return
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			writeReply5(c, StatusGeneralFailure, nil)
+			return
+		}
+		defer ln.Close()
+		writeReply5(c, StatusSucceeded, ln.Addr())
+		peer, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer peer.Close()
+		writeReply5(c, StatusSucceeded, peer.RemoteAddr())
+		go io.Copy(peer, c)
+		io.Copy(c, peer)
+	})
+
+	l, err := NewDialer("tcp", addr).Bind(context.Background(), "tcp", "127.0.0.1:21")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	peer, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.(*Conn).BoundAddr().String(); got != peer.LocalAddr().String() {
+		t.Errorf("BoundAddr() = %s; want %s", got, peer.LocalAddr())
+	}
+	if _, err := l.Accept(); err == nil {
+		t.Error("second Accept should fail")
+	}
+
+	peer.Write([]byte("ping"))
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "ping" {
+		t.Fatalf("got %q, %v; want ping", b, err)
+	}
+
+	// Close unblocks a pending Accept.
+	l, err = NewDialer("tcp", addr).Bind(context.Background(), "tcp", "127.0.0.1:21")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		accepted <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.Close()
+	if err := <-accepted; err == nil {
+		t.Error("Accept should fail after Close")
+	}
+}
@@ -0,0 +1,223 @@
+package socks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// maxUDPHeaderLen is the maximum length of the header prepended to
+// datagrams relayed by the proxy server: RSV | FRAG | ATYP | ADDR | PORT
+const maxUDPHeaderLen = 4 + 1 + 255 + 2
+
+// A PacketConn is a net.PacketConn relaying datagrams through the UDP
+// relay of a SOCKS5 proxy server. The association lasts as long as the
+// control connection to the proxy server, closing the PacketConn closes
+// both.
+//
+// It deliberately does not expose the underlying *net.UDPConn, whose raw
+// reads and writes would bypass the relay header.
+type PacketConn struct {
+	uc    *net.UDPConn
+	ctrl  net.Conn
+	relay *net.UDPAddr
+}
+
+// ListenPacket sends a UDP ASSOCIATE command to the proxy server and
+// returns a PacketConn whose datagrams are relayed by the proxy server.
+// network is "udp", "udp4" or "udp6". Only SOCKS5 supports UDP.
+func (d *Dialer) ListenPacket(ctx context.Context, network string) (*PacketConn, error) {
+	proxy, _, _ := d.pathAddrs(d.proxyAddress)
+	opErr := func(err error) error {
+		return &net.OpError{Op: CmdUDPAssociate.String(), Net: network, Source: proxy, Err: err}
+	}
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, opErr(errors.New("network not implemented"))
+	}
+	if d.version() != Version5 {
+		return nil, opErr(errors.New("UDP ASSOCIATE requires SOCKS5"))
+	}
+	var (
+		c   net.Conn
+		err error
+	)
+	if d.ProxyDial != nil {
+		c, err = d.ProxyDial(ctx, d.proxyNetwork, d.proxyAddress)
+	} else {
+		var dd net.Dialer
+		c, err = dd.DialContext(ctx, d.proxyNetwork, d.proxyAddress)
+	}
+	if err != nil {
+		return nil, opErr(err)
+	}
+	pc, err := d.associate(ctx, c, network)
+	if err != nil {
+		c.Close()
+		return nil, opErr(err)
+	}
+	return pc, nil
+}
+
+func (d *Dialer) associate(ctx context.Context, c net.Conn, network string) (*PacketConn, error) {
+	ud := *d
+	ud.cmd = CmdUDPAssociate
+	// The client does not know the address it will send datagrams from
+	// before the relay is chosen, so it sends all zeros.
+	a, err := ud.request(ctx, c, "0.0.0.0", 0)
+	if err != nil {
+		return nil, err
+	}
+	bound := a.(*Addr)
+	relay := &net.UDPAddr{IP: bound.IP, Port: bound.Port}
+	if bound.IP == nil || bound.IP.IsUnspecified() {
+		// The relay is on the proxy server itself.
+		if tcp, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+			relay.IP = tcp.IP
+		} else {
+			host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+			if err != nil {
+				return nil, err
+			}
+			relay.IP = net.ParseIP(host)
+		}
+	}
+	if bound.Name != "" {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", bound.Name)
+		if err != nil {
+			return nil, err
+		}
+		relay.IP = ips[0]
+	}
+	uc, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, err
+	}
+	pc := &PacketConn{uc: uc, ctrl: c, relay: relay}
+	go pc.watchControl()
+	return pc, nil
+}
+
+// watchControl closes the PacketConn once the proxy server closes the
+// control connection, which terminates the association.
+func (c *PacketConn) watchControl() {
+	io.Copy(io.Discard, c.ctrl)
+	c.uc.Close()
+}
+
+// ResolveAddr returns the address of the remote peer address, a host and
+// port, for WriteTo, which lets the proxy server resolve the host if it is
+// a domain name.
+func (c *PacketConn) ResolveAddr(address string) (net.Addr, error) {
+	host, port, err := splitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+	return &Addr{Name: host, Port: port}, nil
+}
+
+// RelayAddr returns the address of the UDP relay of the proxy server.
+func (c *PacketConn) RelayAddr() net.Addr {
+	return c.relay
+}
+
+// WriteTo sends a datagram to addr through the relay. addr must be a
+// *net.UDPAddr or an *Addr, the latter allows the proxy server to
+// resolve domain names.
+func (c *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	var (
+		host string
+		port int
+	)
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		host, port = a.IP.String(), a.Port
+	case *Addr:
+		host, port = a.Name, a.Port
+		if a.IP != nil {
+			host = a.IP.String()
+		}
+	default:
+		var err error
+		if host, port, err = splitHostPort(addr.String()); err != nil {
+			return 0, err
+		}
+	}
+	b := make([]byte, 0, maxUDPHeaderLen+len(p))
+	b = append(b, 0, 0, 0) // RSV | FRAG
+	b, err := appendAddr(b, host, port)
+	if err != nil {
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: err}
+	}
+	b = append(b, p...)
+	if _, err := c.uc.WriteTo(b, c.relay); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrom reads a datagram relayed by the proxy server, the returned
+// address is the address of the remote peer, a *net.UDPAddr unless the
+// proxy server replied with a domain name.
+func (c *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	b := make([]byte, maxUDPHeaderLen+len(p))
+	for {
+		n, from, err := c.uc.ReadFromUDP(b)
+		if err != nil {
+			return 0, nil, err
+		}
+		// Drop datagrams which were not sent by the relay, and fragments,
+		// which are not supported.
+		if !from.IP.Equal(c.relay.IP) || from.Port != c.relay.Port {
+			continue
+		}
+		if n < 4 || b[0] != 0 || b[1] != 0 || b[2] != 0 {
+			continue
+		}
+		r := bytes.NewReader(b[4:n])
+		a, err := readAddr(r, b[3], make([]byte, 0, 255+2))
+		if err != nil {
+			continue
+		}
+		var addr net.Addr = a
+		if a.IP != nil {
+			addr = &net.UDPAddr{IP: a.IP, Port: a.Port}
+		}
+		return copy(p, b[n-r.Len():n]), addr, nil
+	}
+}
+
+// Close closes the PacketConn and the control connection, which ends the
+// association.
+func (c *PacketConn) Close() error {
+	err := c.uc.Close()
+	c.ctrl.Close()
+	return err
+}
+
+// LocalAddr returns the local address of the datagram socket.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return c.uc.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the datagram socket.
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	return c.uc.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the datagram socket.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	return c.uc.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the datagram socket.
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	return c.uc.SetWriteDeadline(t)
+}
@@ -0,0 +1,108 @@
+package transport
+
+// ConnState is the state of a connection reported to Options.ConnStateHook.
+type ConnState uint8
+
+const (
+	// ConnNew is the state of a connection before it is opened.
+	ConnNew ConnState = iota
+	// ConnActive is the state of a connection serving requests.
+	ConnActive
+	// ConnIdle is the state of a connection waiting for requests.
+	ConnIdle
+	// ConnClosed is the state of a closed connection.
+	ConnClosed
+)
+
+// String returns the name of the state.
+func (s ConnState) String() string {
+	switch s {
+	case ConnNew:
+		return "new"
+	case ConnActive:
+		return "active"
+	case ConnIdle:
+		return "idle"
+	case ConnClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnStateChange is a change of the state of a connection, or of the
+// number of streams in use of an HTTP/2 or HTTP/3 connection.
+type ConnStateChange struct {
+	// Addr is the host:port the connection is for.
+	Addr string
+
+	// Proto is the protocol of the connection, "HTTP/1.1", "HTTP/2.0" or
+	// "HTTP/3.0".
+	Proto string
+
+	// From and To are the states before and after the change, they are
+	// equal if only the number of streams changed.
+	From, To ConnState
+
+	// Streams is the change of the number of streams in use, always 0 for
+	// HTTP/1 connections.
+	Streams int
+
+	// Reused is whether a connection which served requests before starts
+	// serving another one, an HTTP/1 connection may stay active meanwhile.
+	Reused bool
+
+	// Err is the reason the connection is closed, if known.
+	Err error
+
+	// Evicted is whether the connection is closed by the pool, e.g.
+	// because it was idle for too long or there were too many idle ones.
+	Evicted bool
+}
+
+// MuxConnState tracks the state of an HTTP/2 or HTTP/3 connection, which is
+// active while it has streams in use. It is guarded by the lock of the
+// connection.
+type MuxConnState struct {
+	Addr  string
+	Proto string
+
+	state   ConnState
+	streams int
+	used    bool
+}
+
+// Update reports the change of the state of the connection, which has
+// streams in use, to hook. Nothing is reported once the connection is
+// closed, or if Addr is empty.
+func (s *MuxConnState) Update(hook func(*ConnStateChange), streams int) {
+	state := ConnIdle
+	if streams > 0 {
+		state = ConnActive
+	}
+	s.update(hook, &ConnStateChange{To: state, Streams: streams})
+}
+
+// Close reports the close of the connection to hook, err is the reason
+// and evicted is whether it is closed by the pool.
+func (s *MuxConnState) Close(hook func(*ConnStateChange), err error, evicted bool) {
+	s.update(hook, &ConnStateChange{To: ConnClosed, Err: err, Evicted: evicted})
+}
+
+// update reports change, whose Streams is the number of streams in use
+// until it is turned into a delta.
+func (s *MuxConnState) update(hook func(*ConnStateChange), change *ConnStateChange) {
+	if hook == nil || s.Addr == "" || s.state == ConnClosed {
+		return
+	}
+	if change.To == s.state && change.Streams == s.streams {
+		return
+	}
+	streams := change.Streams
+	change.Addr, change.Proto, change.From = s.Addr, s.Proto, s.state
+	change.Streams -= s.streams
+	change.Reused = change.Streams > 0 && s.used
+	s.state, s.streams = change.To, streams
+	s.used = s.used || streams > 0
+	hook(change)
+}
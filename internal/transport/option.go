@@ -37,6 +37,12 @@ type Options struct {
 	// If it returns an error, the request fails with that error.
 	OnProxyConnectResponse func(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error
 
+	// OnProxyConnectDone is called when the Transport has finished connecting
+	// through a proxy, before the TLS handshake with the target if any. err is
+	// nil if the proxy connection (and CONNECT tunnel if needed) succeeded,
+	// see ProxyConnectFailed.
+	OnProxyConnectDone func(ctx context.Context, proxyURL *url.URL, err error)
+
 	// DialContext specifies the dial function for creating unencrypted TCP connections.
 	// If DialContext is nil, then the transport dials using package net.
 	//
@@ -168,6 +174,12 @@ type Options struct {
 	// Debugf is the optional debug function.
 	Debugf func(format string, v ...any)
 
+	// ConnStateHook, if not nil, is called when a connection is opened,
+	// closed, becomes active or idle, and when the number of streams in
+	// use of an HTTP/2 or HTTP/3 connection changes. It may be called with
+	// the lock of the connection held, and must not block.
+	ConnStateHook func(change *ConnStateChange)
+
 	Dump *dump.Dumper
 }
 
@@ -182,3 +194,10 @@ func (o Options) Clone() Options {
 	}
 	return oo
 }
+
+// ProxyConnectFailed reports whether the err passed to OnProxyConnectDone
+// with ctx is a failure of the proxy.
+func ProxyConnectFailed(ctx context.Context, err error) bool {
+	// A canceled request says nothing about the proxy.
+	return err != nil && ctx.Err() == nil
+}
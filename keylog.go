@@ -0,0 +1,53 @@
+package req
+
+import (
+	"os"
+	"sync"
+)
+
+// keyLogFile is a key log writer shared by the handshakes of crypto/tls,
+// utls and quic-go, which do not synchronize with each other. The clones
+// of a client share it, it is closed when no client uses it anymore.
+type keyLogFile struct {
+	mu   sync.Mutex
+	f    *os.File
+	refs int
+}
+
+func openKeyLogFile(path string) (*keyLogFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &keyLogFile{f: f, refs: 1}, nil
+}
+
+// retain records that one more client uses the file.
+func (w *keyLogFile) retain() {
+	w.mu.Lock()
+	w.refs++
+	w.mu.Unlock()
+}
+
+// release records that a client does not use the file anymore, and closes
+// it if it was the last one.
+func (w *keyLogFile) release() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.refs--
+	if w.refs == 0 {
+		return w.f.Close()
+	}
+	return nil
+}
+
+func (w *keyLogFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.refs <= 0 {
+		// The secrets of the handshakes started before the file was
+		// closed are dropped, failing them would abort the handshakes.
+		return len(p), nil
+	}
+	return w.f.Write(p)
+}
@@ -0,0 +1,79 @@
+package req
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestSetTLSKeyLogFile(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	h3 := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}
+	go h3.Serve(pc)
+	defer h3.Close()
+
+	for name, c := range map[string]*Client{
+		"std":  C().SetTLSKeyLogFile(filepath.Join(t.TempDir(), "keys.log")),
+		"utls": C().ImpersonateChrome().SetTLSKeyLogFile(filepath.Join(t.TempDir(), "keys.log")),
+		"h3":   C().EnableForceHTTP3().SetTLSKeyLogFile(filepath.Join(t.TempDir(), "keys.log")),
+	} {
+		url := srv.URL
+		if name == "h3" {
+			url = "https://" + pc.LocalAddr().String()
+		}
+		_, err := c.EnableInsecureSkipVerify().R().Get(url)
+		tests.AssertNoError(t, err)
+		f := c.GetTLSClientConfig().KeyLogWriter.(*keyLogFile)
+		data, err := os.ReadFile(f.f.Name())
+		tests.AssertNoError(t, err)
+		for _, label := range []string{"CLIENT_HANDSHAKE_TRAFFIC_SECRET", "CLIENT_TRAFFIC_SECRET_0"} {
+			if !strings.Contains(string(data), label) {
+				t.Errorf("%s: %s not logged in %q", name, label, data)
+			}
+		}
+	}
+
+	c := C().SetTLSKeyLogFile(filepath.Join(t.TempDir(), "keys.log")).SetTLSKeyLogFile("")
+	tests.AssertIsNil(t, c.GetTLSClientConfig().KeyLogWriter)
+}
+
+func TestSetTLSKeyLogFileClose(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "keys.log")
+	c := C().EnableInsecureSkipVerify().SetTLSKeyLogFile(path)
+	f := c.GetTLSClientConfig().KeyLogWriter.(*keyLogFile)
+	clone := c.Clone()
+
+	// The file is kept open while the clone uses it.
+	c.SetTLSKeyLogFile("")
+	_, err := clone.R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+	data, err := os.ReadFile(path)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, strings.Contains(string(data), "CLIENT_TRAFFIC_SECRET_0"))
+
+	clone.SetTLSKeyLogFile("")
+	tests.AssertErrorContains(t, f.f.Close(), "already closed")
+}
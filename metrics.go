@@ -0,0 +1,134 @@
+package req
+
+import (
+	"time"
+
+	"github.com/imroc/req/v3/internal/transport"
+)
+
+// Metrics receives the measurements of the requests and of the connections
+// of a Client or a Transport, see Client.SetMetrics and NewMetricsCollector.
+// The methods are called concurrently, some with the lock of a connection
+// held, so they must be fast and must not call the Client or the Transport.
+type Metrics interface {
+	// ObserveRequest is called when an attempt of a request completes,
+	// each retry is observed separately.
+	ObserveRequest(m *RequestMetrics)
+
+	// ObserveConnState is called when a connection is opened, closed,
+	// becomes active or idle, is reused, and when the number of streams in
+	// use of an HTTP/2 or HTTP/3 connection changes.
+	ObserveConnState(change *ConnStateChange)
+}
+
+// ConnState is the state of a connection, see Metrics.ObserveConnState.
+type ConnState = transport.ConnState
+
+// The states of the connections.
+const (
+	// ConnNew is the state of a connection before it is opened, the From
+	// state of the connections which are opened.
+	ConnNew = transport.ConnNew
+	// ConnActive is the state of a connection serving requests.
+	ConnActive = transport.ConnActive
+	// ConnIdle is the state of a connection waiting for requests.
+	ConnIdle = transport.ConnIdle
+	// ConnClosed is the state of a closed connection.
+	ConnClosed = transport.ConnClosed
+)
+
+// ConnStateChange is a change of the state of a connection, or of the
+// number of streams in use of an HTTP/2 or HTTP/3 connection, see
+// Metrics.ObserveConnState.
+type ConnStateChange = transport.ConnStateChange
+
+// RequestMetrics represents the measurements of an attempt of a request.
+type RequestMetrics struct {
+	// Method is the method of the request.
+	Method string
+
+	// Host is the host of the URL of the request.
+	Host string
+
+	// Protocol is the protocol of the response, e.g. "HTTP/2.0", empty if
+	// there is no response.
+	Protocol string
+
+	// StatusCode is the status code of the response, 0 if there is no
+	// response.
+	StatusCode int
+
+	// Err is the error of the attempt, if any.
+	Err error
+
+	// RetryAttempt is the number of the retry, 0 for the first attempt.
+	RetryAttempt int
+
+	// RequestBodySize is the size of the request body, -1 if unknown.
+	RequestBodySize int64
+
+	// ResponseBodySize is the size of the response body, which is the
+	// number of bytes read if the response was read automatically, and
+	// its Content-Length otherwise, -1 if unknown.
+	ResponseBodySize int64
+
+	// Duration is the duration of the attempt, including the automatic
+	// read of the response body.
+	Duration time.Duration
+
+	// TraceInfo holds the durations of the phases of the attempt, it does
+	// not require to enable the trace.
+	TraceInfo TraceInfo
+}
+
+// SetMetrics set the Metrics which receives the state changes of the
+// connections of the transport, use Client.SetMetrics to measure the
+// requests as well.
+func (t *Transport) SetMetrics(m Metrics) *Transport {
+	t.metrics = m
+	return t
+}
+
+// observeMetrics reports the attempt of r, which started at start, to the
+// Metrics of the client.
+func (r *Request) observeMetrics(start time.Time, resp *Response, err error) {
+	m := r.client.metrics
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	rm := &RequestMetrics{
+		Method:           r.Method,
+		Err:              err,
+		RetryAttempt:     r.RetryAttempt,
+		RequestBodySize:  -1,
+		ResponseBodySize: -1,
+		Duration:         now.Sub(start),
+	}
+	if rm.Method == "" {
+		rm.Method = "GET"
+	}
+	if r.URL != nil {
+		rm.Host = r.URL.Host
+	}
+	if r.RawRequest != nil && (r.RawRequest.ContentLength > 0 || r.RawRequest.Body == nil) {
+		rm.RequestBodySize = r.RawRequest.ContentLength
+	}
+	if resp != nil && resp.Response != nil {
+		rm.Protocol = resp.Proto
+		rm.StatusCode = resp.StatusCode
+		if resp.body != nil {
+			rm.ResponseBodySize = int64(len(resp.body))
+		} else if resp.ContentLength >= 0 {
+			rm.ResponseBodySize = resp.ContentLength
+		}
+	}
+	ct := r.trace
+	if ct == nil {
+		ct = r.metricsTrace
+	}
+	if ct != nil {
+		rm.TraceInfo = ct.info(r.StartTime, now)
+	}
+	m.ObserveRequest(rm)
+}
@@ -0,0 +1,321 @@
+package req
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMetricsDurationBuckets are the default upper bounds, in seconds, of
+// the buckets of the duration histograms of MetricsCollector.
+var DefaultMetricsDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultMetricsSizeBuckets are the default upper bounds, in bytes, of the
+// buckets of the body size histograms of MetricsCollector.
+var DefaultMetricsSizeBuckets = []float64{100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8}
+
+// MetricsCollectorOptions controls the metrics of MetricsCollector.
+type MetricsCollectorOptions struct {
+	// Namespace is the prefix of the names of the metrics, "req" by
+	// default.
+	Namespace string
+
+	// DurationBuckets are the upper bounds of the buckets of the duration
+	// histograms, DefaultMetricsDurationBuckets by default.
+	DurationBuckets []float64
+
+	// SizeBuckets are the upper bounds of the buckets of the body size
+	// histograms, DefaultMetricsSizeBuckets by default.
+	SizeBuckets []float64
+}
+
+// MetricsCollector is an in-process Metrics which aggregates the
+// measurements in counters, gauges and histograms, and exposes them in the
+// Prometheus text format with WriteTo or as an http.Handler. The metrics,
+// prefixed with the namespace, are:
+//
+//	requests_total                   counter    method, host, code, protocol
+//	request_retries_total            counter    method, host
+//	request_duration_seconds         histogram  method, host
+//	request_phase_duration_seconds   histogram  host, phase (dns, connect, tls, ttfb)
+//	request_body_bytes               histogram  host
+//	response_body_bytes              histogram  host
+//	connections                      gauge      host, protocol, state (active, idle)
+//	connections_total                counter    host, protocol
+//	streams                          gauge      host, protocol
+//	streams_total                    counter    host, protocol
+//
+// The code label is "error" if there is no response, and the host label of
+// the connection metrics includes the port. The phases are only observed
+// when they occur, e.g. there is no DNS lookup for reused connections.
+type MetricsCollector struct {
+	mu       sync.Mutex
+	families []*metricFamily
+
+	requests     *metricFamily
+	retries      *metricFamily
+	duration     *metricFamily
+	phases       *metricFamily
+	requestSize  *metricFamily
+	responseSize *metricFamily
+	conns        *metricFamily
+	connsTotal   *metricFamily
+	streams      *metricFamily
+	streamsTotal *metricFamily
+}
+
+// NewMetricsCollector returns a MetricsCollector with specified options, nil
+// for the defaults, see Client.SetMetrics.
+func NewMetricsCollector(opts *MetricsCollectorOptions) *MetricsCollector {
+	var o MetricsCollectorOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Namespace == "" {
+		o.Namespace = "req"
+	}
+	durationBuckets := sortedBuckets(o.DurationBuckets, DefaultMetricsDurationBuckets)
+	sizeBuckets := sortedBuckets(o.SizeBuckets, DefaultMetricsSizeBuckets)
+	c := &MetricsCollector{}
+	family := func(name, typ, help string, buckets []float64, labels ...string) *metricFamily {
+		f := &metricFamily{
+			name:    o.Namespace + "_" + name,
+			typ:     typ,
+			help:    help,
+			labels:  labels,
+			buckets: buckets,
+			series:  make(map[string]*metricSeries),
+		}
+		c.families = append(c.families, f)
+		return f
+	}
+	c.requests = family("requests_total", "counter", "Number of attempts of requests.", nil, "method", "host", "code", "protocol")
+	c.retries = family("request_retries_total", "counter", "Number of retries of requests.", nil, "method", "host")
+	c.duration = family("request_duration_seconds", "histogram", "Duration of the attempts of requests.", durationBuckets, "method", "host")
+	c.phases = family("request_phase_duration_seconds", "histogram", "Duration of the phases of the attempts of requests.", durationBuckets, "host", "phase")
+	c.requestSize = family("request_body_bytes", "histogram", "Size of the request bodies.", sizeBuckets, "host")
+	c.responseSize = family("response_body_bytes", "histogram", "Size of the response bodies.", sizeBuckets, "host")
+	c.conns = family("connections", "gauge", "Number of open connections.", nil, "host", "protocol", "state")
+	c.connsTotal = family("connections_total", "counter", "Number of opened connections.", nil, "host", "protocol")
+	c.streams = family("streams", "gauge", "Number of HTTP/2 and HTTP/3 streams in use.", nil, "host", "protocol")
+	c.streamsTotal = family("streams_total", "counter", "Number of opened HTTP/2 and HTTP/3 streams.", nil, "host", "protocol")
+	return c
+}
+
+func sortedBuckets(buckets, defaults []float64) []float64 {
+	if len(buckets) == 0 {
+		return defaults
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return slices.Compact(buckets)
+}
+
+// ObserveRequest implements Metrics.
+func (c *MetricsCollector) ObserveRequest(m *RequestMetrics) {
+	code := "error"
+	if m.StatusCode != 0 {
+		code = strconv.Itoa(m.StatusCode)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests.get(m.Method, m.Host, code, m.Protocol).value++
+	if m.RetryAttempt > 0 {
+		c.retries.get(m.Method, m.Host).value++
+	}
+	c.duration.get(m.Method, m.Host).observe(c.duration.buckets, m.Duration.Seconds())
+	ti := &m.TraceInfo
+	for _, phase := range [...]struct {
+		name     string
+		duration float64
+	}{
+		{"dns", ti.DNSLookupTime.Seconds()},
+		{"connect", ti.TCPConnectTime.Seconds()},
+		{"tls", ti.TLSHandshakeTime.Seconds()},
+		{"ttfb", ti.FirstResponseTime.Seconds()},
+	} {
+		if phase.duration > 0 {
+			c.phases.get(m.Host, phase.name).observe(c.phases.buckets, phase.duration)
+		}
+	}
+	if m.RequestBodySize >= 0 {
+		c.requestSize.get(m.Host).observe(c.requestSize.buckets, float64(m.RequestBodySize))
+	}
+	if m.ResponseBodySize >= 0 {
+		c.responseSize.get(m.Host).observe(c.responseSize.buckets, float64(m.ResponseBodySize))
+	}
+}
+
+// ObserveConnState implements Metrics.
+func (c *MetricsCollector) ObserveConnState(change *ConnStateChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if change.From != change.To {
+		if change.From == ConnActive || change.From == ConnIdle {
+			c.conns.get(change.Addr, change.Proto, change.From.String()).value--
+		}
+		if change.To == ConnActive || change.To == ConnIdle {
+			c.conns.get(change.Addr, change.Proto, change.To.String()).value++
+		}
+		if change.From == ConnNew {
+			c.connsTotal.get(change.Addr, change.Proto).value++
+		}
+	}
+	if change.Streams != 0 {
+		c.streams.get(change.Addr, change.Proto).value += float64(change.Streams)
+		if change.Streams > 0 {
+			c.streamsTotal.get(change.Addr, change.Proto).value += float64(change.Streams)
+		}
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w.
+func (c *MetricsCollector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	c.mu.Lock()
+	for _, f := range c.families {
+		f.writeTo(bw)
+	}
+	c.mu.Unlock()
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP implements http.Handler, it serves the metrics in the
+// Prometheus text format.
+func (c *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type metricFamily struct {
+	name    string
+	typ     string
+	help    string
+	labels  []string
+	buckets []float64 // histograms only
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64 // counters and gauges
+
+	// histograms
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (f *metricFamily) get(labels ...string) *metricSeries {
+	key := strings.Join(labels, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: labels}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (s *metricSeries) observe(buckets []float64, v float64) {
+	if i, _ := slices.BinarySearch(buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (f *metricFamily) writeTo(w *bufio.Writer) {
+	if len(f.series) == 0 {
+		return
+	}
+	w.WriteString("# HELP " + f.name + " " + escapeMetricHelp(f.help) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != "histogram" {
+			writeMetricSample(w, f.name, f.labels, s.labels, "", "", s.value)
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			writeMetricSample(w, f.name+"_bucket", f.labels, s.labels, "le", formatMetricValue(bound), float64(cumulative))
+		}
+		writeMetricSample(w, f.name+"_bucket", f.labels, s.labels, "le", "+Inf", float64(s.count))
+		writeMetricSample(w, f.name+"_sum", f.labels, s.labels, "", "", s.sum)
+		writeMetricSample(w, f.name+"_count", f.labels, s.labels, "", "", float64(s.count))
+	}
+}
+
+func writeMetricSample(w *bufio.Writer, name string, names, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(names) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, n := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(n + `="` + escapeMetricLabel(values[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatMetricValue(v) + "\n")
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	metricHelpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	metricLabelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeMetricHelp(s string) string {
+	return metricHelpEscaper.Replace(s)
+}
+
+func escapeMetricLabel(s string) string {
+	return metricLabelEscaper.Replace(s)
+}
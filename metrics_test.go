@@ -0,0 +1,150 @@
+package req
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// metricSample returns the value of the sample of the metrics exposed by c,
+// e.g. `req_requests_total{method="GET"}`, "" if there is none.
+func metricSample(t *testing.T, c *MetricsCollector, sample string) string {
+	t.Helper()
+	var b strings.Builder
+	_, err := c.WriteTo(&b)
+	tests.AssertNoError(t, err)
+	s := bufio.NewScanner(strings.NewReader(b.String()))
+	for s.Scan() {
+		if v, ok := strings.CutPrefix(s.Text(), sample+" "); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// waitMetricSample waits for the sample of the metrics exposed by c to be
+// want, for the asynchronous state changes of the connections.
+func waitMetricSample(t *testing.T, c *MetricsCollector, sample, want string) {
+	t.Helper()
+	var v string
+	for range 100 {
+		if v = metricSample(t, c, sample); v == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("%s = %q, want %q", sample, v, want)
+}
+
+func TestMetricsHTTP1(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	m := NewMetricsCollector(nil)
+	c := C().SetMetrics(m).SetCommonRetryCount(1)
+	resp, err := c.R().SetRetryCondition(func(resp *Response, err error) bool {
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}).Get(srv.URL)
+	assertSuccess(t, resp, err)
+	resp, err = c.R().SetBody("ping").Post(srv.URL)
+	assertSuccess(t, resp, err)
+
+	tests.AssertEqual(t, "1", metricSample(t, m, `req_requests_total{method="GET",host="`+host+`",code="503",protocol="HTTP/1.1"}`))
+	tests.AssertEqual(t, "1", metricSample(t, m, `req_requests_total{method="GET",host="`+host+`",code="200",protocol="HTTP/1.1"}`))
+	tests.AssertEqual(t, "1", metricSample(t, m, `req_request_retries_total{method="GET",host="`+host+`"}`))
+	tests.AssertEqual(t, "2", metricSample(t, m, `req_request_duration_seconds_count{method="GET",host="`+host+`"}`))
+	tests.AssertEqual(t, "3", metricSample(t, m, `req_request_phase_duration_seconds_count{host="`+host+`",phase="ttfb"}`))
+	tests.AssertEqual(t, "1", metricSample(t, m, `req_request_phase_duration_seconds_count{host="`+host+`",phase="connect"}`))
+	tests.AssertEqual(t, "", metricSample(t, m, `req_request_phase_duration_seconds_count{host="`+host+`",phase="tls"}`))
+	tests.AssertEqual(t, "4", metricSample(t, m, `req_request_body_bytes_sum{host="`+host+`"}`))
+	tests.AssertEqual(t, "10", metricSample(t, m, `req_response_body_bytes_sum{host="`+host+`"}`))
+	tests.AssertEqual(t, "3", metricSample(t, m, `req_response_body_bytes_bucket{host="`+host+`",le="100"}`))
+
+	tests.AssertEqual(t, "1", metricSample(t, m, `req_connections_total{host="`+host+`",protocol="HTTP/1.1"}`))
+	waitMetricSample(t, m, `req_connections{host="`+host+`",protocol="HTTP/1.1",state="idle"}`, "1")
+	tests.AssertEqual(t, "0", metricSample(t, m, `req_connections{host="`+host+`",protocol="HTTP/1.1",state="active"}`))
+	c.CloseIdleConnections()
+	waitMetricSample(t, m, `req_connections{host="`+host+`",protocol="HTTP/1.1",state="idle"}`, "0")
+
+	// The trace of the request is not affected by the metrics.
+	tests.AssertEqual(t, TraceInfo{}, resp.TraceInfo())
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	tests.AssertEqual(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	tests.AssertContains(t, rec.Body.String(), "# type req_requests_total counter\n", true)
+	tests.AssertContains(t, rec.Body.String(), "# type req_request_duration_seconds histogram\n", true)
+}
+
+func TestMetricsHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	m := NewMetricsCollector(&MetricsCollectorOptions{Namespace: "test"})
+	c := C().EnableInsecureSkipVerify().SetMetrics(m)
+	for range 3 {
+		resp, err := c.R().Get(srv.URL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "HTTP/2.0", resp.String())
+	}
+	tests.AssertEqual(t, "3", metricSample(t, m, `test_requests_total{method="GET",host="`+host+`",code="200",protocol="HTTP/2.0"}`))
+	tests.AssertEqual(t, "1", metricSample(t, m, `test_request_phase_duration_seconds_count{host="`+host+`",phase="tls"}`))
+	tests.AssertEqual(t, "1", metricSample(t, m, `test_connections_total{host="`+host+`",protocol="HTTP/2.0"}`))
+	tests.AssertEqual(t, "3", metricSample(t, m, `test_streams_total{host="`+host+`",protocol="HTTP/2.0"}`))
+	waitMetricSample(t, m, `test_streams{host="`+host+`",protocol="HTTP/2.0"}`, "0")
+	waitMetricSample(t, m, `test_connections{host="`+host+`",protocol="HTTP/2.0",state="idle"}`, "1")
+
+	c.CloseIdleConnections()
+	waitMetricSample(t, m, `test_connections{host="`+host+`",protocol="HTTP/2.0",state="idle"}`, "0")
+}
+
+func TestMetricsHTTP3(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+	host := pc.LocalAddr().String()
+
+	m := NewMetricsCollector(nil)
+	c := C().EnableInsecureSkipVerify().EnableForceHTTP3().SetMetrics(m)
+	for range 2 {
+		resp, err := c.R().Get("https://" + host)
+		assertSuccess(t, resp, err)
+	}
+	tests.AssertEqual(t, "2", metricSample(t, m, `req_requests_total{method="GET",host="`+host+`",code="200",protocol="HTTP/3.0"}`))
+	tests.AssertEqual(t, "1", metricSample(t, m, `req_connections_total{host="`+host+`",protocol="HTTP/3.0"}`))
+	tests.AssertEqual(t, "2", metricSample(t, m, `req_streams_total{host="`+host+`",protocol="HTTP/3.0"}`))
+	waitMetricSample(t, m, `req_streams{host="`+host+`",protocol="HTTP/3.0"}`, "0")
+	waitMetricSample(t, m, `req_connections{host="`+host+`",protocol="HTTP/3.0",state="idle"}`, "1")
+}
@@ -0,0 +1,282 @@
+package req
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Pager prepares the request for the next page of a paginated API, from
+// the response of the current page and its number of items, and reports
+// whether there is a next page, see Paginate.
+type Pager func(r *Request, resp *Response, items int) (more bool, err error)
+
+// LinkPager returns a Pager which follows the URL of the RFC 8288 Link
+// header with the "next" relation, as GitHub does, until there is none.
+func LinkPager() Pager {
+	return func(r *Request, resp *Response, items int) (bool, error) {
+		next := nextLink(resp.Header)
+		if next == "" {
+			return false, nil
+		}
+		u, err := resp.Response.Request.URL.Parse(next) // the URL after the redirects
+		if err != nil {
+			return false, fmt.Errorf("invalid next link %q: %w", next, err)
+		}
+		// The query of the next page is in the link.
+		r.RawURL, r.QueryParams, r.PathParams = u.String(), nil, nil
+		return true, nil
+	}
+}
+
+// nextLink returns the target of the Link header with the "next" relation.
+func nextLink(h http.Header) string {
+	for _, v := range h.Values("Link") {
+		for {
+			start := strings.IndexByte(v, '<')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(v[start:], '>')
+			if end < 0 {
+				break
+			}
+			target := v[start+1 : start+end]
+			params := v[start+end+1:]
+			v = ""
+			if i := strings.IndexByte(params, '<'); i >= 0 {
+				params, v = params[:i], params[i:]
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, value, ok := strings.Cut(param, "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				value = strings.Trim(strings.TrimSpace(value), `",`)
+				for _, rel := range strings.Fields(value) {
+					if strings.EqualFold(rel, "next") {
+						return target
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// CursorPager returns a Pager which sets the query parameter param to the
+// cursor of the next page, in the field of the JSON body, a dot separated
+// path such as "meta.next_cursor", until it is missing, null or empty.
+func CursorPager(field, param string) Pager {
+	return func(r *Request, resp *Response, items int) (bool, error) {
+		body, err := resp.ToBytes()
+		if err != nil {
+			return false, err
+		}
+		raw, err := jsonField(r.client, body, field)
+		if err != nil || raw == nil {
+			return false, err
+		}
+		var cursor string
+		if raw[0] == '"' {
+			if err := json.Unmarshal(raw, &cursor); err != nil {
+				return false, err
+			}
+		} else if s := string(raw); s != "null" {
+			cursor = s // a number
+		}
+		if cursor == "" {
+			return false, nil
+		}
+		queryParam(r, param)
+		r.SetQueryParam(param, cursor)
+		return true, nil
+	}
+}
+
+// PagePager returns a Pager which increments the page number in the query
+// parameter param, 1 if it is not set, until a page has no items, or less
+// than pageSize items if pageSize is positive.
+func PagePager(param string, pageSize int) Pager {
+	return func(r *Request, resp *Response, items int) (bool, error) {
+		if items == 0 || items < pageSize {
+			return false, nil
+		}
+		page := 1
+		if v := queryParam(r, param); v != "" {
+			var err error
+			if page, err = strconv.Atoi(v); err != nil {
+				return false, fmt.Errorf("invalid page number %q: %w", v, err)
+			}
+		}
+		r.SetQueryParam(param, strconv.Itoa(page+1))
+		return true, nil
+	}
+}
+
+// OffsetPager returns a Pager which increments the offset in the query
+// parameter param by the number of items of the pages, 0 if it is not set,
+// until a page has no items, or less than pageSize items if pageSize is
+// positive.
+func OffsetPager(param string, pageSize int) Pager {
+	return func(r *Request, resp *Response, items int) (bool, error) {
+		if items == 0 || items < pageSize {
+			return false, nil
+		}
+		offset := 0
+		if v := queryParam(r, param); v != "" {
+			var err error
+			if offset, err = strconv.Atoi(v); err != nil {
+				return false, fmt.Errorf("invalid offset %q: %w", v, err)
+			}
+		}
+		r.SetQueryParam(param, strconv.Itoa(offset+items))
+		return true, nil
+	}
+}
+
+// queryParam returns the query parameter param of r, which is moved from
+// the query of the raw URL to the query parameters of r, if any, so that
+// the pagers do not send it twice when they set it.
+func queryParam(r *Request, param string) string {
+	base, rawQuery, ok := strings.Cut(r.RawURL, "?")
+	if !ok {
+		return r.QueryParams.Get(param)
+	}
+	rawQuery, fragment, hasFragment := strings.Cut(rawQuery, "#")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil || !query.Has(param) {
+		return r.QueryParams.Get(param)
+	}
+	if !r.QueryParams.Has(param) {
+		r.SetQueryParam(param, query.Get(param))
+	}
+	query.Del(param)
+	r.RawURL = base
+	if len(query) > 0 {
+		r.RawURL += "?" + query.Encode()
+	}
+	if hasFragment {
+		r.RawURL += "#" + fragment
+	}
+	return r.QueryParams.Get(param)
+}
+
+// PaginateOptions is the options of Paginate.
+type PaginateOptions struct {
+	// Pager prepares the request for the next pages, LinkPager by default.
+	Pager Pager
+
+	// ItemsField is the dot separated path of the items in the JSON body,
+	// such as "data.items", the body is the items by default.
+	ItemsField string
+
+	// MaxPages, if positive, is the maximum number of pages fetched.
+	MaxPages int
+}
+
+// Paginate returns an iterator over the items of the pages of a paginated
+// API, starting with the page of r, with specified options, nil for the
+// defaults. The pages are fetched lazily by r, with its headers, its retry
+// and the result decoding of the client, and the iteration stops after
+// the first error, which is a *ResultError[any] if the ResultState of a
+// page is not SuccessState:
+//
+//	r := client.Get("https://api.github.com/users/imroc/repos").SetQueryParam("per_page", "100")
+//	for repo, err := range req.Paginate[*Repo](r, nil) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(repo.Name)
+//	}
+//
+// The request is modified by the Pager for the next pages, so it must
+// not be used concurrently.
+func Paginate[T any](r *Request, opts *PaginateOptions) iter.Seq2[T, error] {
+	if opts == nil {
+		opts = &PaginateOptions{}
+	}
+	pager := opts.Pager
+	if pager == nil {
+		pager = LinkPager()
+	}
+	return func(yield func(T, error) bool) {
+		var zero T
+		// The common cookies of the client are appended to the cookies of
+		// the request when it is sent.
+		cookies := slices.Clone(r.Cookies)
+		for page := 0; opts.MaxPages <= 0 || page < opts.MaxPages; page++ {
+			r.RetryAttempt = 0
+			r.Cookies = slices.Clone(cookies)
+			resp := r.Do()
+			if resp.Err != nil {
+				yield(zero, resp.Err)
+				return
+			}
+			if !resp.IsSuccessState() {
+				yield(zero, newResultError(resp, resp.ErrorResult))
+				return
+			}
+			items, err := pageItems[T](resp, opts.ItemsField)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			more, err := pager(r, resp, len(items))
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+func pageItems[T any](resp *Response, field string) ([]T, error) {
+	var items []T
+	if field == "" {
+		if resp.StatusCode == http.StatusNoContent {
+			return nil, nil
+		}
+		err := resp.Unmarshal(&items)
+		return items, err
+	}
+	body, err := resp.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := jsonField(resp.Request.client, body, field)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	err = resp.Request.client.jsonUnmarshal(raw, &items)
+	return items, err
+}
+
+// jsonField returns the field of the JSON body at the dot separated path,
+// nil if it is missing.
+func jsonField(c *Client, body []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(body)
+	for name := range strings.SplitSeq(path, ".") {
+		var obj map[string]json.RawMessage
+		if err := c.jsonUnmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("failed to get %q from JSON body: %w", path, err)
+		}
+		if raw = obj[name]; raw == nil {
+			return nil, nil
+		}
+	}
+	return raw, nil
+}
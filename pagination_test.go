@@ -0,0 +1,96 @@
+package req
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+func collect[T any](t *testing.T, seq func(yield func(T, error) bool)) []T {
+	t.Helper()
+	var items []T
+	for item, err := range seq {
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestPaginate(t *testing.T) {
+	c := tc().SetCommonHeader("X-Token", "abc")
+	all := []int{1, 2, 3, 4, 5}
+
+	tests.AssertEqual(t, all, collect[int](t, Paginate[int](c.Get("/pagination/link"), nil)))
+	tests.AssertEqual(t, all, collect[int](t, Paginate[int](c.Get("/pagination/cursor"), &PaginateOptions{
+		Pager:      CursorPager("meta.next", "cursor"),
+		ItemsField: "data.items",
+	})))
+
+	paginationRequests.Store(0)
+	r := c.Get("/pagination/page").SetQueryParam("page", "1").
+		SetRetryCount(1).
+		SetRetryCondition(func(resp *Response, err error) bool {
+			return err != nil || resp.StatusCode >= 500
+		})
+	tests.AssertEqual(t, all, collect[int](t, Paginate[int](r, &PaginateOptions{Pager: PagePager("page", 2)})))
+	tests.AssertEqual(t, int32(4), paginationRequests.Load()) // 3 pages and a retry
+
+	tests.AssertEqual(t, all, collect[int](t, Paginate[int](c.Get("/pagination/offset"), &PaginateOptions{Pager: OffsetPager("offset", 0)})))
+
+	// The parameters in the query of the URL are not sent twice.
+	tests.AssertEqual(t, all[2:], collect[int](t, Paginate[int](c.Get("/pagination/page?page=2&x=1"), &PaginateOptions{Pager: PagePager("page", 2)})))
+	tests.AssertEqual(t, all[2:], collect[int](t, Paginate[int](c.Get("/pagination/offset?offset=2"), &PaginateOptions{Pager: OffsetPager("offset", 0)})))
+	tests.AssertEqual(t, all[2:], collect[int](t, Paginate[int](c.Get("/pagination/cursor?cursor=2"), &PaginateOptions{
+		Pager:      CursorPager("meta.next", "cursor"),
+		ItemsField: "data.items",
+	})))
+
+	// Limited pages, and the pages are fetched lazily.
+	tests.AssertEqual(t, []int{1, 2, 3, 4}, collect[int](t, Paginate[int](c.Get("/pagination/link"), &PaginateOptions{MaxPages: 2})))
+	paginationRequests.Store(0)
+	for item := range Paginate[int](c.Get("/pagination/link"), nil) {
+		if item == 3 {
+			break
+		}
+	}
+	tests.AssertEqual(t, int32(2), paginationRequests.Load())
+
+	// The error result of the client is decoded.
+	c = tc().SetCommonErrorResult(&ErrorMessage{})
+	var n int
+	for _, err := range Paginate[int](c.Get("/pagination/link"), nil) {
+		n++
+		var resultErr *ResultError[any]
+		if !errors.As(err, &resultErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tests.AssertEqual(t, http.StatusUnauthorized, resultErr.Response.StatusCode)
+		tests.AssertEqual(t, "unauthorized", resultErr.Result.(*ErrorMessage).ErrorMessage)
+	}
+	tests.AssertEqual(t, 1, n)
+
+	// The common cookies are sent once with each page.
+	c = tc().SetCommonHeader("X-Token", "abc").SetCommonCookies(&http.Cookie{Name: "sid", Value: "1"})
+	paginationRequests.Store(0)
+	tests.AssertEqual(t, all, collect[int](t, Paginate[int](c.Get("/pagination/link").SetCookies(&http.Cookie{Name: "theme", Value: "dark"}), nil)))
+	tests.AssertEqual(t, int32(3), paginationRequests.Load())
+}
+
+func TestNextLink(t *testing.T) {
+	for _, c := range []struct {
+		header []string
+		want   string
+	}{
+		{[]string{`<https://api.github.com/user/repos?page=3&per_page=100>; rel="next", <https://api.github.com/user/repos?page=50&per_page=100>; rel="last"`}, "https://api.github.com/user/repos?page=3&per_page=100"},
+		{[]string{`<https://example.com/1>; rel="prev"`, `<https://example.com/3>; title="a;b"; rel="start next"`}, "https://example.com/3"},
+		{[]string{`</items?cursor=x>;rel=next`}, "/items?cursor=x"},
+		{[]string{`<https://example.com/last>; rel="last"`}, ""},
+		{nil, ""},
+	} {
+		tests.AssertEqual(t, c.want, nextLink(http.Header{"Link": c.header}))
+	}
+}
@@ -0,0 +1,219 @@
+// Package fingerprint provides a local echo server which reports the TLS
+// and HTTP fingerprints of the requests it receives, it allows tests to
+// assert that an impersonated client sends exactly the intended
+// fingerprint.
+package fingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Fingerprint is the fingerprint of a request received by the Server, it
+// is also the JSON body of the responses of the Server.
+type Fingerprint struct {
+	// Proto is the protocol of the request, e.g. "HTTP/2.0".
+	Proto string `json:"proto"`
+	// JA3 is the JA3 string of the ClientHello, GREASE values excluded.
+	JA3 string `json:"ja3"`
+	// JA3Hash is the MD5 hash of JA3.
+	JA3Hash string `json:"ja3_hash"`
+	// JA4 is the JA4 fingerprint of the ClientHello.
+	JA4 string `json:"ja4"`
+	// JA4R is the raw form of JA4 with sorted cipher suites and
+	// extensions, which can be passed to Client.ImpersonateFromFingerprint.
+	JA4R string `json:"ja4_r"`
+	// Akamai is the Akamai fingerprint of the http2 connection, it is
+	// empty for other protocols.
+	Akamai string `json:"akamai,omitempty"`
+	// PseudoHeaderOrder is the order of the pseudo headers of http2
+	// requests.
+	PseudoHeaderOrder []string `json:"pseudo_header_order,omitempty"`
+	// HeaderOrder is the order of the headers as sent by the client, it is
+	// not captured for http3 requests.
+	HeaderOrder []string `json:"header_order,omitempty"`
+}
+
+// clientHello is the part of the ClientHello used by the fingerprints.
+type clientHello struct {
+	quic              bool
+	version           uint16
+	supportedVersions []uint16
+	cipherSuites      []uint16
+	extensions        []uint16
+	curves            []uint16
+	points            []uint8
+	signatureSchemes  []uint16
+	alpn              []string
+}
+
+func newClientHello(info *tls.ClientHelloInfo, quic bool) *clientHello {
+	ch := &clientHello{
+		quic:              quic,
+		supportedVersions: info.SupportedVersions,
+		cipherSuites:      info.CipherSuites,
+		extensions:        info.Extensions,
+		points:            info.SupportedPoints,
+		alpn:              info.SupportedProtos,
+	}
+	for _, c := range info.SupportedCurves {
+		ch.curves = append(ch.curves, uint16(c))
+	}
+	for _, s := range info.SignatureSchemes {
+		ch.signatureSchemes = append(ch.signatureSchemes, uint16(s))
+	}
+	// ClientHelloInfo does not expose the legacy version, it is TLS 1.2
+	// when the supported_versions extension is present, otherwise the
+	// highest version.
+	if slices.Contains(ch.extensions, 43) {
+		ch.version = tls.VersionTLS12
+	} else {
+		ch.version = maxVersion(ch.supportedVersions)
+	}
+	return ch
+}
+
+// fill sets the TLS fingerprints of the ClientHello into fp.
+func (ch *clientHello) fill(fp *Fingerprint) {
+	fp.JA3 = ch.ja3()
+	sum := md5.Sum([]byte(fp.JA3))
+	fp.JA3Hash = hex.EncodeToString(sum[:])
+	fp.JA4, fp.JA4R = ch.ja4()
+}
+
+func (ch *clientHello) ja3() string {
+	points := make([]uint16, len(ch.points))
+	for i, p := range ch.points {
+		points[i] = uint16(p)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(ch.version)),
+		joinUint16(ch.cipherSuites, "-", false),
+		joinUint16(ch.extensions, "-", false),
+		joinUint16(ch.curves, "-", false),
+		joinUint16(points, "-", false),
+	}, ",")
+}
+
+// ja4 returns the JA4 fingerprint and its raw form, see
+// https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md.
+func (ch *clientHello) ja4() (hashed, raw string) {
+	var b strings.Builder
+	if ch.quic {
+		b.WriteByte('q')
+	} else {
+		b.WriteByte('t')
+	}
+	version := ch.version
+	if len(ch.supportedVersions) > 0 {
+		version = maxVersion(ch.supportedVersions)
+	}
+	switch version {
+	case tls.VersionTLS13:
+		b.WriteString("13")
+	case tls.VersionTLS12:
+		b.WriteString("12")
+	case tls.VersionTLS11:
+		b.WriteString("11")
+	case tls.VersionTLS10:
+		b.WriteString("10")
+	default:
+		b.WriteString("00")
+	}
+	if slices.Contains(ch.extensions, 0) {
+		b.WriteByte('d')
+	} else {
+		b.WriteByte('i')
+	}
+	ciphers := withoutGREASE(ch.cipherSuites)
+	extensions := withoutGREASE(ch.extensions)
+	fmt.Fprintf(&b, "%02d%02d", min(len(ciphers), 99), min(len(extensions), 99))
+	b.WriteString(ja4ALPN(ch.alpn))
+	prefix := b.String()
+
+	slices.Sort(ciphers)
+	extensions = slices.DeleteFunc(extensions, func(e uint16) bool {
+		return e == 0 || e == 16
+	})
+	slices.Sort(extensions)
+	rawCiphers := joinUint16(ciphers, ",", true)
+	rawExtensions := joinUint16(extensions, ",", true)
+	if len(ch.signatureSchemes) > 0 {
+		rawExtensions += "_" + joinUint16(ch.signatureSchemes, ",", true)
+	}
+	hashed = prefix + "_" + ja4Hash(rawCiphers) + "_" + ja4Hash(rawExtensions)
+	raw = prefix + "_" + rawCiphers + "_" + rawExtensions
+	return
+}
+
+func ja4ALPN(protos []string) string {
+	if len(protos) == 0 || protos[0] == "" {
+		return "00"
+	}
+	p := protos[0]
+	first, last := p[0], p[len(p)-1]
+	if isAlphanumeric(first) && isAlphanumeric(last) {
+		return string([]byte{first, last})
+	}
+	h := hex.EncodeToString([]byte(p))
+	return string([]byte{h[0], h[len(h)-1]})
+}
+
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isGREASE reports whether v is a GREASE value of RFC 8701.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	result := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func maxVersion(versions []uint16) uint16 {
+	var v uint16
+	for _, version := range versions {
+		if !isGREASE(version) && version > v {
+			v = version
+		}
+	}
+	return v
+}
+
+// joinUint16 joins the non-GREASE values in decimal, or in 4-digit hex.
+func joinUint16(values []uint16, sep string, hexFormat bool) string {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		if isGREASE(v) {
+			continue
+		}
+		if hexFormat {
+			s = append(s, fmt.Sprintf("%04x", v))
+		} else {
+			s = append(s, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(s, sep)
+}
@@ -0,0 +1,95 @@
+package fingerprint
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// chromeHello is the ClientHello of the example of the JA4 specification,
+// with GREASE values.
+var chromeHello = &tls.ClientHelloInfo{
+	CipherSuites:      []uint16{0x2a2a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035},
+	Extensions:        []uint16{0x3a3a, 0x0000, 0x0017, 0xff01, 0x000a, 0x000b, 0x0023, 0x0010, 0x0005, 0x000d, 0x0012, 0x0033, 0x002d, 0x002b, 0x001b, 0x4469, 0x0015},
+	SupportedCurves:   []tls.CurveID{0x4a4a, tls.X25519, tls.CurveP256, tls.CurveP384},
+	SupportedPoints:   []uint8{0},
+	SignatureSchemes:  []tls.SignatureScheme{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+	SupportedProtos:   []string{"h2", "http/1.1"},
+	SupportedVersions: []uint16{0x6a6a, tls.VersionTLS13, tls.VersionTLS12},
+}
+
+func TestClientHelloFingerprint(t *testing.T) {
+	fp := &Fingerprint{}
+	newClientHello(chromeHello, false).fill(fp)
+	if want := "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21,29-23-24,0"; fp.JA3 != want {
+		t.Errorf("JA3 = %q, want %q", fp.JA3, want)
+	}
+	if want := "t13d1516h2_8daaf6152771_e5627efa2ab1"; fp.JA4 != want {
+		t.Errorf("JA4 = %q, want %q", fp.JA4, want)
+	}
+	if want := "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0015,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0804,0401,0503,0805,0501,0806,0601"; fp.JA4R != want {
+		t.Errorf("JA4R = %q, want %q", fp.JA4R, want)
+	}
+
+	fp = &Fingerprint{}
+	newClientHello(&tls.ClientHelloInfo{SupportedVersions: []uint16{tls.VersionTLS12}}, true).fill(fp)
+	if want := "q12i000000_000000000000_000000000000"; fp.JA4 != want {
+		t.Errorf("JA4 = %q, want %q", fp.JA4, want)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Last() != nil {
+		t.Fatal("Last should be nil before any request")
+	}
+
+	for _, proto := range []string{"HTTP/2.0", "HTTP/1.1"} {
+		tr := &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: proto == "HTTP/2.0",
+		}
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		req.Header.Set("X-First", "1")
+		resp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fp Fingerprint
+		err = json.NewDecoder(resp.Body).Decode(&fp)
+		resp.Body.Close()
+		tr.CloseIdleConnections()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fp.Proto != proto {
+			t.Errorf("Proto = %q, want %q", fp.Proto, proto)
+		}
+		if fp.JA4 == "" || fp.JA3Hash == "" {
+			t.Errorf("TLS fingerprints are missing: %+v", fp)
+		}
+		if last := s.Last(); last.JA4R != fp.JA4R {
+			t.Errorf("Last().JA4R = %q, want %q", last.JA4R, fp.JA4R)
+		}
+		if proto == "HTTP/2.0" {
+			// net/http does not send PRIORITY frames.
+			if !strings.HasSuffix(fp.Akamai, "|0|a,m,p,s") {
+				t.Errorf("Akamai = %q", fp.Akamai)
+			}
+			if len(fp.HeaderOrder) == 0 || fp.HeaderOrder[0] != "x-first" {
+				t.Errorf("HeaderOrder = %v", fp.HeaderOrder)
+			}
+		} else if len(fp.HeaderOrder) < 2 || fp.HeaderOrder[0] != "Host" || fp.HeaderOrder[1] != "User-Agent" {
+			t.Errorf("HeaderOrder = %v", fp.HeaderOrder)
+		}
+	}
+	if n := len(s.Fingerprints()); n != 2 {
+		t.Errorf("got %d fingerprints, want 2", n)
+	}
+}
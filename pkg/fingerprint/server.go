@@ -0,0 +1,323 @@
+package fingerprint
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	reqhttp2 "github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/internal/http2"
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Server is a local TLS server which answers every request with the JSON
+// encoded Fingerprint of the request, it supports HTTP/1.1 and HTTP/2, and
+// optionally HTTP/3 on the same port. The certificate is the self-signed
+// certificate of 127.0.0.1, so clients must skip the verification.
+type Server struct {
+	// URL is the base URL of the server, e.g. https://127.0.0.1:8443.
+	URL string
+
+	ln        net.Listener
+	h3        *http3.Server
+	tlsConfig *tls.Config
+
+	mu           sync.Mutex
+	conns        map[net.Conn]struct{}
+	h3Hellos     map[string]*clientHello
+	fingerprints []*Fingerprint
+	wg           sync.WaitGroup
+}
+
+// NewServer starts a Server on a random port of 127.0.0.1.
+func NewServer() (*Server, error) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		URL:       "https://" + ln.Addr().String(),
+		ln:        ln,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		conns:     make(map[net.Conn]struct{}),
+		h3Hellos:  make(map[string]*clientHello),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// EnableHTTP3 serves HTTP/3 on the UDP port of the server. Only the TLS
+// fingerprints of HTTP/3 requests are captured.
+func (s *Server) EnableHTTP3() error {
+	pc, err := net.ListenPacket("udp", s.ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	config := s.tlsConfig.Clone()
+	config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		s.mu.Lock()
+		s.h3Hellos[info.Conn.RemoteAddr().String()] = newClientHello(info, true)
+		s.mu.Unlock()
+		return nil, nil
+	}
+	s.h3 = &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(config),
+		Handler:   http.HandlerFunc(s.serveHTTP3),
+	}
+	go s.h3.Serve(pc)
+	return nil
+}
+
+// Fingerprints returns the fingerprints of all requests received so far.
+func (s *Server) Fingerprints() []*Fingerprint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Fingerprint(nil), s.fingerprints...)
+}
+
+// Last returns the fingerprint of the last request received, or nil.
+func (s *Server) Last() *Fingerprint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.fingerprints) == 0 {
+		return nil
+	}
+	return s.fingerprints[len(s.fingerprints)-1]
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	if s.h3 != nil {
+		s.h3.Close()
+	}
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	var hello *clientHello
+	config := s.tlsConfig.Clone()
+	config.NextProtos = []string{"h2", "http/1.1"}
+	config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		hello = newClientHello(info, false)
+		return nil, nil
+	}
+	tlsConn := tls.Server(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+		s.serveHTTP2(tlsConn, hello)
+	} else {
+		s.serveHTTP1(tlsConn, hello)
+	}
+}
+
+func (s *Server) record(fp *Fingerprint) []byte {
+	s.mu.Lock()
+	s.fingerprints = append(s.fingerprints, fp)
+	s.mu.Unlock()
+	body, _ := json.Marshal(fp)
+	return body
+}
+
+// serveHTTP1 reads the headers without net/http to keep their order and
+// case.
+func (s *Server) serveHTTP1(conn net.Conn, hello *clientHello) {
+	br := bufio.NewReader(conn)
+	tr := textproto.NewReader(br)
+	for {
+		if _, err := tr.ReadLine(); err != nil {
+			return
+		}
+		fp := &Fingerprint{Proto: "HTTP/1.1"}
+		hello.fill(fp)
+		var contentLength int64
+		for {
+			line, err := tr.ReadLine()
+			if err != nil {
+				return
+			}
+			if line == "" {
+				break
+			}
+			name, value, _ := strings.Cut(line, ":")
+			fp.HeaderOrder = append(fp.HeaderOrder, name)
+			if strings.EqualFold(name, "Content-Length") {
+				contentLength, _ = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			}
+		}
+		if _, err := io.CopyN(io.Discard, br, contentLength); err != nil {
+			return
+		}
+		body := s.record(fp)
+		_, err := fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) serveHTTP2(conn net.Conn, hello *clientHello) {
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != http2.ClientPreface {
+		return
+	}
+	fr := http2.NewFramer(conn, conn)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := fr.WriteSettings(); err != nil {
+		return
+	}
+
+	// The Akamai fingerprint covers the frames sent before the first
+	// HEADERS frame.
+	var (
+		akamai       string
+		settings     []string
+		windowUpdate uint32
+		priorities   []string
+	)
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if akamai == "" && settings == nil {
+				f.ForeachSetting(func(setting reqhttp2.Setting) error {
+					settings = append(settings, fmt.Sprintf("%d:%d", setting.ID, setting.Val))
+					return nil
+				})
+			}
+			err = fr.WriteSettingsAck()
+		case *http2.WindowUpdateFrame:
+			if akamai == "" && f.StreamID == 0 && windowUpdate == 0 {
+				windowUpdate = f.Increment
+			}
+		case *http2.PriorityFrame:
+			if akamai == "" {
+				exclusive := 0
+				if f.Exclusive {
+					exclusive = 1
+				}
+				priorities = append(priorities, fmt.Sprintf("%d:%d:%d:%d", f.StreamID, exclusive, f.StreamDep, int(f.Weight)+1))
+			}
+		case *http2.MetaHeadersFrame:
+			fp := &Fingerprint{Proto: "HTTP/2.0"}
+			hello.fill(fp)
+			var pseudo []string
+			for _, field := range f.Fields {
+				if field.IsPseudo() {
+					fp.PseudoHeaderOrder = append(fp.PseudoHeaderOrder, field.Name)
+					pseudo = append(pseudo, field.Name[1:2])
+				} else {
+					fp.HeaderOrder = append(fp.HeaderOrder, field.Name)
+				}
+			}
+			if akamai == "" {
+				window, priority := "00", "0"
+				if windowUpdate != 0 {
+					window = strconv.FormatUint(uint64(windowUpdate), 10)
+				}
+				if len(priorities) > 0 {
+					priority = strings.Join(priorities, ",")
+				}
+				akamai = strings.Join(settings, ";") + "|" + window + "|" + priority
+			}
+			fp.Akamai = akamai + "|" + strings.Join(pseudo, ",")
+			err = writeHTTP2Response(fr, f.StreamID, s.record(fp))
+		case *http2.DataFrame:
+			if n := uint32(len(f.Data())); n > 0 {
+				err = fr.WriteWindowUpdate(0, n)
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				err = fr.WritePing(true, f.Data)
+			}
+		case *http2.GoAwayFrame:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeHTTP2Response(fr *http2.Framer, streamID uint32, body []byte) error {
+	var buf bytes.Buffer
+	enc := hpack.NewEncoder(&buf)
+	enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+	enc.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/json"})
+	enc.WriteField(hpack.HeaderField{Name: "content-length", Value: strconv.Itoa(len(body))})
+	err := fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: buf.Bytes(),
+		EndHeaders:    true,
+	})
+	if err != nil {
+		return err
+	}
+	return fr.WriteData(streamID, true, body)
+}
+
+func (s *Server) serveHTTP3(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	hello := s.h3Hellos[r.RemoteAddr]
+	s.mu.Unlock()
+	if hello == nil {
+		http.Error(w, "no ClientHello captured", http.StatusInternalServerError)
+		return
+	}
+	fp := &Fingerprint{Proto: r.Proto}
+	hello.fill(fp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.record(fp))
+}
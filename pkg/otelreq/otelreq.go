@@ -0,0 +1,328 @@
+// Package otelreq instruments req clients with OpenTelemetry, it creates a
+// client span for each attempt of the requests, propagates the trace context
+// to the servers, records the DNS, connect and TLS events of the attempts and
+// emits the http.client.* metrics of the semantic conventions.
+//
+// It is a separate module, so that the OpenTelemetry dependencies are not
+// required by the users of req who do not import it:
+//
+//	go get github.com/imroc/req/v3/pkg/otelreq
+package otelreq
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imroc/req/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/semconv/v1.43.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope name of the tracer and the meter.
+const ScopeName = "github.com/imroc/req/v3/pkg/otelreq"
+
+// Options controls the instrumentation, see Instrument.
+type Options struct {
+	// TracerProvider creates the tracer, the global one by default.
+	TracerProvider trace.TracerProvider
+	// MeterProvider creates the meter, the global one by default.
+	MeterProvider metric.MeterProvider
+	// Propagators injects the trace context into the requests, the global
+	// one by default, or W3C Trace Context and Baggage if it is not set.
+	Propagators propagation.TextMapPropagator
+	// SpanNameFormatter returns the name of the span of an attempt, the
+	// method of the request by default.
+	SpanNameFormatter func(r *req.Request) string
+	// DisableClientTrace disables the DNS, connect and TLS events.
+	DisableClientTrace bool
+}
+
+var defaultPropagators = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+type instrumentation struct {
+	opts   Options
+	tracer trace.Tracer
+
+	duration     httpconv.ClientRequestDuration
+	active       httpconv.ClientActiveRequests
+	requestSize  httpconv.ClientRequestBodySize
+	responseSize httpconv.ClientResponseBodySize
+}
+
+// Instrument instruments c with specified options, nil for the defaults, and
+// returns c. Each attempt of a request, retries included, gets its own client
+// span, child of the span of the context of the request, with the
+// "http.request.resend_count" attribute for retries.
+//
+// For example:
+//
+//	client := otelreq.Instrument(req.C(), nil)
+//	resp, err := client.R().SetContext(ctx).Get(url)
+func Instrument(c *req.Client, opts *Options) *req.Client {
+	in := &instrumentation{}
+	if opts != nil {
+		in.opts = *opts
+	}
+	tp := in.opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	in.tracer = tp.Tracer(ScopeName, trace.WithSchemaURL(semconv.SchemaURL))
+
+	mp := in.opts.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(ScopeName, metric.WithSchemaURL(semconv.SchemaURL))
+	var err error
+	if in.duration, err = httpconv.NewClientRequestDuration(meter); err != nil {
+		otel.Handle(err)
+	}
+	if in.active, err = httpconv.NewClientActiveRequests(meter); err != nil {
+		otel.Handle(err)
+	}
+	if in.requestSize, err = httpconv.NewClientRequestBodySize(meter); err != nil {
+		otel.Handle(err)
+	}
+	if in.responseSize, err = httpconv.NewClientResponseBodySize(meter); err != nil {
+		otel.Handle(err)
+	}
+	return c.WrapRoundTripFunc(in.wrap)
+}
+
+func (in *instrumentation) propagators() propagation.TextMapPropagator {
+	if in.opts.Propagators != nil {
+		return in.opts.Propagators
+	}
+	if p := otel.GetTextMapPropagator(); len(p.Fields()) > 0 {
+		return p
+	}
+	return defaultPropagators
+}
+
+func (in *instrumentation) spanName(r *req.Request) string {
+	if in.opts.SpanNameFormatter != nil {
+		return in.opts.SpanNameFormatter(r)
+	}
+	if method, _ := requestMethod(r.Method); method != "_OTHER" {
+		return method
+	}
+	return "HTTP"
+}
+
+func (in *instrumentation) wrap(rt req.RoundTripper) req.RoundTripFunc {
+	return func(r *req.Request) (*req.Response, error) {
+		start := time.Now()
+		parent := r.Context()
+		method, original := requestMethod(r.Method)
+		host, port := serverAddress(r.URL)
+		attrs := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLFull(redactedURL(r.URL)),
+			semconv.ServerAddress(host),
+			semconv.ServerPort(port),
+		}
+		if original != "" {
+			attrs = append(attrs, semconv.HTTPRequestMethodOriginal(original))
+		}
+		if r.RetryAttempt > 0 {
+			attrs = append(attrs, semconv.HTTPRequestResendCount(r.RetryAttempt))
+		}
+		if ua := r.Headers.Get("User-Agent"); ua != "" {
+			attrs = append(attrs, semconv.UserAgentOriginal(ua))
+		}
+		ctx, span := in.tracer.Start(parent, in.spanName(r),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+
+		metricAttrs := []attribute.KeyValue{semconv.URLScheme(r.URL.Scheme)}
+		in.active.Add(ctx, 1, host, port, metricAttrs...)
+		defer in.active.Add(ctx, -1, host, port, metricAttrs...)
+
+		in.propagators().Inject(ctx, propagation.HeaderCarrier(r.Headers))
+		ct := &clientTrace{span: span}
+		if !in.opts.DisableClientTrace {
+			ctx = httptrace.WithClientTrace(ctx, ct.httptrace())
+		}
+		r.SetContext(ctx)
+		// The next attempts start from the context of the request.
+		defer r.SetContext(parent)
+
+		resp, err := rt.RoundTrip(r)
+
+		if peer := ct.peerAddr(); peer != "" {
+			span.SetAttributes(semconv.NetworkPeerAddress(peer))
+		}
+		if resp != nil && resp.Response != nil {
+			if v := protocolVersion(resp.Response); v != "" {
+				span.SetAttributes(semconv.NetworkProtocolVersion(v))
+				metricAttrs = append(metricAttrs, semconv.NetworkProtocolVersion(v))
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			metricAttrs = append(metricAttrs, semconv.HTTPResponseStatusCode(resp.StatusCode))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.SetAttributes(semconv.ErrorType(err))
+			metricAttrs = append(metricAttrs, semconv.ErrorType(err))
+		} else if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, "")
+			errorType := semconv.ErrorTypeKey.String(strconv.Itoa(resp.StatusCode))
+			span.SetAttributes(errorType)
+			metricAttrs = append(metricAttrs, errorType)
+		}
+
+		reqMethod := httpconv.RequestMethodAttr(method)
+		in.duration.Record(ctx, time.Since(start).Seconds(), reqMethod, host, port, metricAttrs...)
+		if n := len(r.Body); n > 0 {
+			in.requestSize.Record(ctx, int64(n), reqMethod, host, port, metricAttrs...)
+		}
+		if resp != nil && resp.Response != nil {
+			n := int64(len(resp.Bytes()))
+			if n == 0 && resp.ContentLength > 0 {
+				n = resp.ContentLength
+			}
+			in.responseSize.Record(ctx, n, reqMethod, host, port, metricAttrs...)
+		}
+		return resp, err
+	}
+}
+
+// requestMethod returns the method for the "http.request.method" attribute,
+// and the original method if it is not a known one.
+func requestMethod(method string) (string, string) {
+	if method == "" {
+		return http.MethodGet, ""
+	}
+	switch upper := strings.ToUpper(method); upper {
+	case http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace:
+		if upper != method {
+			return upper, method
+		}
+		return method, ""
+	default:
+		return "_OTHER", method
+	}
+}
+
+// serverAddress returns the host and the port of u.
+func serverAddress(u *url.URL) (string, int) {
+	host := u.Hostname()
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		return host, port
+	}
+	if u.Scheme == "https" {
+		return host, 443
+	}
+	return host, 80
+}
+
+// redactedURL returns u without its credentials.
+func redactedURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	uu := *u
+	uu.User = url.UserPassword("REDACTED", "REDACTED")
+	return uu.String()
+}
+
+// protocolVersion returns the version of the HTTP protocol of resp, e.g.
+// "1.1" or "2".
+func protocolVersion(resp *http.Response) string {
+	switch {
+	case resp.ProtoMajor == 0:
+		return ""
+	case resp.ProtoMajor >= 2:
+		return strconv.Itoa(resp.ProtoMajor)
+	default:
+		return strconv.Itoa(resp.ProtoMajor) + "." + strconv.Itoa(resp.ProtoMinor)
+	}
+}
+
+// clientTrace adds the events of the connection of an attempt to its span.
+type clientTrace struct {
+	span trace.Span
+	peer net.Addr
+}
+
+func (t *clientTrace) peerAddr() string {
+	if t.peer == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(t.peer.String())
+	if err != nil {
+		return t.peer.String()
+	}
+	return host
+}
+
+func (t *clientTrace) addEvent(name string, err error, attrs ...attribute.KeyValue) {
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorType(err), attribute.String("exception.message", err.Error()))
+	}
+	t.span.AddEvent(name, trace.WithAttributes(attrs...))
+}
+
+func (t *clientTrace) httptrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			t.addEvent("http.dns.start", nil, attribute.String("dns.question.name", info.Host))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			addrs := make([]string, len(info.Addrs))
+			for i, addr := range info.Addrs {
+				addrs[i] = addr.String()
+			}
+			t.addEvent("http.dns.done", info.Err, attribute.StringSlice("dns.answers", addrs))
+		},
+		ConnectStart: func(network, addr string) {
+			t.addEvent("http.connect.start", nil, attribute.String("network.transport", network), attribute.String("network.peer.address", addr))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.addEvent("http.connect.done", err, attribute.String("network.transport", network), attribute.String("network.peer.address", addr))
+		},
+		TLSHandshakeStart: func() {
+			t.addEvent("http.tls.start", nil)
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			var attrs []attribute.KeyValue
+			if err == nil {
+				attrs = append(attrs,
+					attribute.String("tls.protocol.version", strings.TrimPrefix(tls.VersionName(cs.Version), "TLS ")),
+					attribute.String("tls.cipher", tls.CipherSuiteName(cs.CipherSuite)),
+					attribute.Bool("tls.resumed", cs.DidResume),
+				)
+				if cs.NegotiatedProtocol != "" {
+					attrs = append(attrs, attribute.String("tls.next_protocol", cs.NegotiatedProtocol))
+				}
+			}
+			t.addEvent("http.tls.done", err, attrs...)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn != nil {
+				t.peer = info.Conn.RemoteAddr()
+			}
+			t.addEvent("http.conn.acquired", nil, attribute.Bool("http.conn.reused", info.Reused))
+		},
+		GotFirstResponseByte: func() {
+			t.addEvent("http.first_response_byte", nil)
+		},
+	}
+}
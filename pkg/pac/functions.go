@@ -0,0 +1,397 @@
+package pac
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const dnsTimeout = 5 * time.Second
+
+var weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+var months = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+// registerFunctions defines the standard PAC helper functions, including
+// the Microsoft IPv6 extensions, in the runtime vm.
+func (p *PAC) registerFunctions(vm *goja.Runtime) {
+	fns := map[string]any{
+		"isPlainHostName":     isPlainHostName,
+		"dnsDomainIs":         dnsDomainIs,
+		"localHostOrDomainIs": localHostOrDomainIs,
+		"isResolvable":        p.isResolvable,
+		"isResolvableEx":      p.isResolvable,
+		"isInNet":             p.isInNet,
+		"isInNetEx":           p.isInNetEx,
+		"dnsResolve":          p.dnsResolve,
+		"dnsResolveEx":        p.dnsResolveEx,
+		"myIpAddress":         myIPAddress,
+		"myIpAddressEx":       myIPAddressEx,
+		"dnsDomainLevels":     dnsDomainLevels,
+		"shExpMatch":          shExpMatch,
+		"convert_addr":        convertAddr,
+		"sortIpAddressList":   sortIPAddressList,
+		"alert":               func(string) {},
+	}
+	for name, fn := range fns {
+		vm.Set(name, fn)
+	}
+	timeFns := map[string]func(args []string, t time.Time) bool{
+		"weekdayRange": weekdayRange,
+		"dateRange":    dateRange,
+		"timeRange":    timeRange,
+	}
+	for name, fn := range timeFns {
+		vm.Set(name, func(call goja.FunctionCall) goja.Value {
+			args, t := timeArgs(call)
+			return vm.ToValue(fn(args, t))
+		})
+	}
+}
+
+func (p *PAC) resolver() *net.Resolver {
+	if p.Resolver != nil {
+		return p.Resolver
+	}
+	return net.DefaultResolver
+}
+
+func (p *PAC) lookup(host string) []netip.Addr {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	addrs, err := p.resolver().LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+	return addrs
+}
+
+func (p *PAC) lookupIPv4(host string) (netip.Addr, bool) {
+	for _, addr := range p.lookup(host) {
+		if addr.Is4() {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+func isPlainHostName(host string) bool {
+	return !strings.Contains(host, ".")
+}
+
+func dnsDomainIs(host, domain string) bool {
+	return strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain))
+}
+
+func localHostOrDomainIs(host, hostdom string) bool {
+	host, hostdom = strings.ToLower(host), strings.ToLower(hostdom)
+	if host == hostdom {
+		return true
+	}
+	return !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+".")
+}
+
+func (p *PAC) isResolvable(host string) bool {
+	return len(p.lookup(host)) > 0
+}
+
+func (p *PAC) isInNet(host, pattern, mask string) bool {
+	addr, ok := p.lookupIPv4(host)
+	if !ok {
+		return false
+	}
+	pat, err := netip.ParseAddr(pattern)
+	if err != nil || !pat.Is4() {
+		return false
+	}
+	m, err := netip.ParseAddr(mask)
+	if err != nil || !m.Is4() {
+		return false
+	}
+	a, b, mm := addr.As4(), pat.As4(), m.As4()
+	for i := range a {
+		if a[i]&mm[i] != b[i]&mm[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *PAC) isInNetEx(host, prefix string) bool {
+	pfx, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return false
+	}
+	for _, addr := range p.lookup(host) {
+		if pfx.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsResolve returns null if host cannot be resolved.
+func (p *PAC) dnsResolve(host string) any {
+	addr, ok := p.lookupIPv4(host)
+	if !ok {
+		return nil
+	}
+	return addr.String()
+}
+
+func (p *PAC) dnsResolveEx(host string) string {
+	var ss []string
+	for _, addr := range p.lookup(host) {
+		ss = append(ss, addr.String())
+	}
+	return strings.Join(ss, ";")
+}
+
+// localAddr returns the local address used to reach the given remote
+// address, no packet is actually sent.
+func localAddr(network, remote string) (netip.Addr, bool) {
+	conn, err := net.Dial(network, remote)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	defer conn.Close()
+	ap, err := netip.ParseAddrPort(conn.LocalAddr().String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap(), true
+}
+
+func myIPAddress() string {
+	if addr, ok := localAddr("udp4", "198.51.100.1:53"); ok {
+		return addr.String()
+	}
+	return "127.0.0.1"
+}
+
+func myIPAddressEx() string {
+	var ss []string
+	if addr, ok := localAddr("udp4", "198.51.100.1:53"); ok {
+		ss = append(ss, addr.String())
+	}
+	if addr, ok := localAddr("udp6", "[2001:db8::1]:53"); ok {
+		ss = append(ss, addr.String())
+	}
+	return strings.Join(ss, ";")
+}
+
+func dnsDomainLevels(host string) int {
+	return strings.Count(host, ".")
+}
+
+func shExpMatch(str, shexp string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range shexp {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(str)
+}
+
+func convertAddr(ip string) uint32 {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is4() {
+		return 0
+	}
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// sortIPAddressList sorts a semicolon separated list of addresses, IPv6
+// addresses first.
+func sortIPAddressList(list string) string {
+	var addrs []netip.Addr
+	for _, s := range strings.Split(list, ";") {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			return ""
+		}
+		addrs = append(addrs, addr)
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		if addrs[i].Is6() != addrs[j].Is6() {
+			return addrs[i].Is6()
+		}
+		return addrs[i].Less(addrs[j])
+	})
+	ss := make([]string, len(addrs))
+	for i, addr := range addrs {
+		ss[i] = addr.String()
+	}
+	return strings.Join(ss, ";")
+}
+
+// timeArgs returns the arguments of a time based function as strings,
+// and the current time, in UTC if the trailing "GMT" argument was given.
+func timeArgs(call goja.FunctionCall) ([]string, time.Time) {
+	args := make([]string, len(call.Arguments))
+	for i, a := range call.Arguments {
+		args[i] = strings.ToUpper(a.String())
+	}
+	if n := len(args); n > 0 && args[n-1] == "GMT" {
+		return args[:n-1], time.Now().UTC()
+	}
+	return args, time.Now()
+}
+
+func atoi(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n, true
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// inRange reports whether v is within [lo, hi], wrapping around if lo > hi.
+func inRange(v, lo, hi int) bool {
+	if lo <= hi {
+		return lo <= v && v <= hi
+	}
+	return v >= lo || v <= hi
+}
+
+// weekdayRange(wd1 [, wd2] [, "GMT"])
+func weekdayRange(args []string, t time.Time) bool {
+	if len(args) == 0 || len(args) > 2 {
+		return false
+	}
+	lo := indexOf(weekdays, args[0])
+	hi := lo
+	if len(args) == 2 {
+		hi = indexOf(weekdays, args[1])
+	}
+	if lo < 0 || hi < 0 {
+		return false
+	}
+	return inRange(int(t.Weekday()), lo, hi)
+}
+
+// dateRange accepts a day (1-31), a month ("JAN".."DEC"), a year (four
+// digits), or a range of two of the same shape, e.g.
+// dateRange(1, "JAN", 15, "MAR") or dateRange(1995, 1997), with an
+// optional trailing "GMT".
+func dateRange(args []string, t time.Time) bool {
+	type field struct {
+		kind  int // 0: year, 1: month, 2: day
+		value int
+	}
+	parse := func(s string) (field, bool) {
+		if m := indexOf(months, s); m >= 0 {
+			return field{1, m}, true
+		}
+		n, ok := atoi(s)
+		if !ok {
+			return field{}, false
+		}
+		if n > 31 {
+			return field{0, n}, true
+		}
+		return field{2, n}, true
+	}
+	current := [3]int{t.Year(), int(t.Month()) - 1, t.Day()}
+	fields := make([]field, len(args))
+	for i, a := range args {
+		f, ok := parse(a)
+		if !ok {
+			return false
+		}
+		fields[i] = f
+	}
+	switch len(fields) {
+	case 1:
+		return current[fields[0].kind] == fields[0].value
+	case 2, 4, 6:
+	default:
+		return false
+	}
+	// Bounds are given least significant field first (day, month, year)
+	// and both must have the same shape.
+	half := len(fields) / 2
+	lo, hi := fields[:half], fields[half:]
+	var loValue, hiValue, curValue int
+	for i := half - 1; i >= 0; i-- {
+		if lo[i].kind != hi[i].kind || (i > 0 && lo[i].kind >= lo[i-1].kind) {
+			return false
+		}
+		loValue = loValue*10000 + lo[i].value
+		hiValue = hiValue*10000 + hi[i].value
+		curValue = curValue*10000 + current[lo[i].kind]
+	}
+	return inRange(curValue, loValue, hiValue)
+}
+
+// timeRange accepts (hour), (hour1, hour2), (hour1, min1, hour2, min2) or
+// (hour1, min1, sec1, hour2, min2, sec2), with an optional trailing "GMT".
+// Ranges include the start and exclude the end.
+func timeRange(args []string, t time.Time) bool {
+	nums := make([]int, len(args))
+	for i, a := range args {
+		n, ok := atoi(a)
+		if !ok {
+			return false
+		}
+		nums[i] = n
+	}
+	cur := t.Hour()*3600 + t.Minute()*60 + t.Second()
+	var lo, hi int
+	switch len(nums) {
+	case 1:
+		return t.Hour() == nums[0]
+	case 2:
+		lo, hi = nums[0]*3600, nums[1]*3600
+	case 4:
+		lo, hi = nums[0]*3600+nums[1]*60, nums[2]*3600+nums[3]*60
+	case 6:
+		lo, hi = nums[0]*3600+nums[1]*60+nums[2], nums[3]*3600+nums[4]*60+nums[5]
+	default:
+		return false
+	}
+	if lo <= hi {
+		return lo <= cur && cur < hi
+	}
+	return cur >= lo || cur < hi
+}
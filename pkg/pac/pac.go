@@ -0,0 +1,384 @@
+// Package pac implements Proxy Auto-Config (PAC) support, it evaluates
+// the FindProxyForURL function of a PAC script and turns its result into
+// a proxy function that can be used with Client.SetProxy.
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/imroc/req/v3"
+	"github.com/imroc/req/v3/internal/transport"
+)
+
+const (
+	defaultCacheTTL    = 5 * time.Minute
+	defaultRetryAfter  = 1 * time.Minute
+	defaultDialTimeout = 3 * time.Second
+)
+
+// Entry is one of the semicolon separated results returned by
+// FindProxyForURL, e.g. "PROXY proxy.example.com:8080" or "DIRECT".
+type Entry struct {
+	// Direct is true for a DIRECT entry.
+	Direct bool
+	// URL is the proxy URL, nil if Direct is true. "PROXY" and "HTTP"
+	// entries are mapped to the http scheme, "HTTPS" to https, "SOCKS" and
+	// "SOCKS4" to socks4, "SOCKS5" to socks5 and "QUIC" to quic.
+	URL *url.URL
+}
+
+// String returns the entry in PAC result format.
+func (e Entry) String() string {
+	if e.Direct {
+		return "DIRECT"
+	}
+	return e.URL.String()
+}
+
+type cacheEntry struct {
+	entries []Entry
+	expire  time.Time
+}
+
+type proxyHealth struct {
+	up       bool
+	checkAt  time.Time
+	checking bool // whether a check is in progress
+}
+
+// runtime is a goja runtime with the script evaluated, goja runtimes are
+// not goroutine safe.
+type runtime struct {
+	vm   *goja.Runtime
+	find goja.Callable
+}
+
+// PAC is a compiled Proxy Auto-Config script. It is safe for concurrent use.
+type PAC struct {
+	// Resolver is the resolver used by the DNS helpers of the script
+	// (dnsResolve, isInNet, isResolvable...). If nil, net.DefaultResolver
+	// is used.
+	Resolver *net.Resolver
+
+	// CacheTTL is how long the result of FindProxyForURL is cached per
+	// URL passed to it, that is per host for https URLs. Zero means 5
+	// minutes, a negative value disables the cache.
+	CacheTTL time.Duration
+
+	// RetryAfter is how long an unreachable proxy is skipped before it
+	// is tried again. Zero means 1 minute.
+	RetryAfter time.Duration
+
+	// DialTimeout is the timeout of the checks of whether a proxy is
+	// reachable, which run in the background when a proxy is first
+	// returned and then every RetryAfter. Zero means 3 seconds, a negative
+	// value disables the checks, only the proxies marked as failed are
+	// skipped.
+	DialTimeout time.Duration
+
+	prog     *goja.Program
+	runtimes sync.Pool // *runtime
+
+	mu     sync.Mutex
+	cache  map[string]*cacheEntry  // keyed by the URL passed to the script
+	health map[string]*proxyHealth // keyed by proxy URL
+}
+
+// New compiles the PAC script, which must define FindProxyForURL (or
+// the Microsoft IPv6 extension FindProxyForURLEx).
+func New(script string) (*PAC, error) {
+	prog, err := goja.Compile("", script, false)
+	if err != nil {
+		return nil, fmt.Errorf("pac: failed to compile script: %w", err)
+	}
+	p := &PAC{
+		prog:   prog,
+		cache:  make(map[string]*cacheEntry),
+		health: make(map[string]*proxyHealth),
+	}
+	rt, err := p.newRuntime()
+	if err != nil {
+		return nil, err
+	}
+	p.runtimes.Put(rt)
+	return p, nil
+}
+
+// newRuntime returns a new runtime with the script evaluated, so that the
+// script is evaluated concurrently, the DNS helpers may block for seconds.
+func (p *PAC) newRuntime() (*runtime, error) {
+	vm := goja.New()
+	p.registerFunctions(vm)
+	if _, err := vm.RunProgram(p.prog); err != nil {
+		return nil, fmt.Errorf("pac: failed to evaluate script: %w", err)
+	}
+	// Prefer the IPv6 aware FindProxyForURLEx.
+	if fn, ok := goja.AssertFunction(vm.Get("FindProxyForURLEx")); ok {
+		return &runtime{vm: vm, find: fn}, nil
+	}
+	if fn, ok := goja.AssertFunction(vm.Get("FindProxyForURL")); ok {
+		return &runtime{vm: vm, find: fn}, nil
+	}
+	return nil, errors.New("pac: FindProxyForURL is not defined")
+}
+
+// Load loads and compiles the PAC script at source, which is either an
+// http(s) or file URL, or the path of a local file. Use New to compile a
+// script held in memory.
+func Load(source string) (*PAC, error) {
+	return LoadWithClient(nil, source)
+}
+
+// LoadWithClient is like Load, but downloads the script with the client
+// c, a new client if nil.
+func LoadWithClient(c *req.Client, source string) (*PAC, error) {
+	script, err := readScript(c, source)
+	if err != nil {
+		return nil, err
+	}
+	return New(script)
+}
+
+// ProxyFromPAC returns a proxy function for Client.SetProxy or
+// Transport.SetProxy which routes requests according to the PAC script
+// loaded from source (see Load). Results are cached (see CacheTTL) and proxies
+// that cannot be reached are skipped in favor of the next entry, use
+// PAC.Install to also skip the proxies which requests failed to connect
+// through.
+func ProxyFromPAC(source string) (func(*http.Request) (*url.URL, error), error) {
+	p, err := Load(source)
+	if err != nil {
+		return nil, err
+	}
+	return p.Proxy, nil
+}
+
+func readScript(c *req.Client, source string) (string, error) {
+	s := strings.TrimSpace(source)
+	u, err := url.Parse(s)
+	if err == nil {
+		switch u.Scheme {
+		case "http", "https":
+			if c == nil {
+				c = req.C()
+			}
+			resp, err := c.R().Get(s)
+			if err != nil {
+				return "", fmt.Errorf("pac: failed to download script: %w", err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return "", fmt.Errorf("pac: failed to download script: %s", resp.Status)
+			}
+			return resp.String(), nil
+		case "file":
+			s = u.Path
+		}
+	}
+	b, err := os.ReadFile(s)
+	if err != nil {
+		return "", fmt.Errorf("pac: failed to read script: %w", err)
+	}
+	return string(b), nil
+}
+
+// FindProxy evaluates the script for u and returns the parsed entries.
+func (p *PAC) FindProxy(u *url.URL) ([]Entry, error) {
+	host := u.Hostname()
+	// Like browsers, hide the path and query of https URLs from the script.
+	target := u.String()
+	if u.Scheme == "https" {
+		target = u.Scheme + "://" + u.Host + "/"
+	}
+	ttl := p.CacheTTL
+	if ttl == 0 {
+		ttl = defaultCacheTTL
+	}
+	if ttl > 0 {
+		p.mu.Lock()
+		ce, ok := p.cache[target]
+		p.mu.Unlock()
+		if ok && time.Now().Before(ce.expire) {
+			return ce.entries, nil
+		}
+	}
+
+	rt, _ := p.runtimes.Get().(*runtime)
+	if rt == nil {
+		var err error
+		if rt, err = p.newRuntime(); err != nil {
+			return nil, err
+		}
+	}
+	v, err := rt.find(goja.Undefined(), rt.vm.ToValue(target), rt.vm.ToValue(host))
+	p.runtimes.Put(rt)
+	if err != nil {
+		return nil, fmt.Errorf("pac: FindProxyForURL failed: %w", err)
+	}
+	entries, err := ParseResult(v.String())
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		now := time.Now()
+		p.mu.Lock()
+		for k, ce := range p.cache {
+			if now.After(ce.expire) {
+				delete(p.cache, k)
+			}
+		}
+		p.cache[target] = &cacheEntry{entries: entries, expire: now.Add(ttl)}
+		p.mu.Unlock()
+	}
+	return entries, nil
+}
+
+// Proxy implements the proxy function of Client.SetProxy. It returns the
+// first entry for r.URL whose proxy is not known to be unreachable, nil for
+// DIRECT. If no proxy is reachable the first proxy entry is returned, so
+// the request fails with the proxy error.
+func (p *PAC) Proxy(r *http.Request) (*url.URL, error) {
+	entries, err := p.FindProxy(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	var first *url.URL
+	for _, e := range entries {
+		if e.Direct {
+			return nil, nil
+		}
+		if first == nil {
+			first = e.URL
+		}
+		if p.reachable(e.URL) {
+			return e.URL, nil
+		}
+	}
+	return first, nil
+}
+
+// Install makes the client c route its requests according to the script,
+// and mark the proxies which requests fail to connect through as failed,
+// and returns c.
+func (p *PAC) Install(c *req.Client) *req.Client {
+	c.SetProxy(p.Proxy)
+	c.GetTransport().OnProxyConnectDone = p.onProxyConnectDone
+	return c
+}
+
+func (p *PAC) onProxyConnectDone(ctx context.Context, proxyURL *url.URL, err error) {
+	if transport.ProxyConnectFailed(ctx, err) {
+		p.MarkFailed(proxyURL)
+	}
+}
+
+// MarkFailed marks the proxy as unreachable, so it is skipped for
+// RetryAfter, e.g. after a request through it failed to connect.
+func (p *PAC) MarkFailed(proxyURL *url.URL) {
+	p.mu.Lock()
+	p.health[proxyURL.String()] = &proxyHealth{up: false, checkAt: time.Now().Add(p.retryAfter())}
+	p.mu.Unlock()
+}
+
+func (p *PAC) retryAfter() time.Duration {
+	if p.RetryAfter > 0 {
+		return p.RetryAfter
+	}
+	return defaultRetryAfter
+}
+
+// reachable reports whether the proxy is not known to be unreachable, and
+// checks it in the background if it is unknown or RetryAfter has elapsed
+// since the last check.
+func (p *PAC) reachable(proxyURL *url.URL) bool {
+	key := proxyURL.String()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if h, ok := p.health[key]; ok && (h.checking || time.Now().Before(h.checkAt)) {
+		return h.up
+	}
+	if p.DialTimeout >= 0 && proxyURL.Scheme != "quic" {
+		p.health[key] = &proxyHealth{up: true, checking: true}
+		go p.check(key, proxyURL.Host)
+	}
+	return true
+}
+
+// check dials addr, the address of the proxy which health is keyed by key.
+func (p *PAC) check(key, addr string) {
+	timeout := p.DialTimeout
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	up := err == nil
+	if up {
+		conn.Close()
+	}
+	p.mu.Lock()
+	p.health[key] = &proxyHealth{up: up, checkAt: time.Now().Add(p.retryAfter())}
+	p.mu.Unlock()
+}
+
+var schemeOfType = map[string]string{
+	"PROXY":  "http",
+	"HTTP":   "http",
+	"HTTPS":  "https",
+	"SOCKS":  "socks4",
+	"SOCKS4": "socks4",
+	"SOCKS5": "socks5",
+	"QUIC":   "quic",
+}
+
+// ParseResult parses the return value of FindProxyForURL, e.g.
+// "PROXY a.example.com:8080; SOCKS5 b.example.com:1080; DIRECT".
+// An empty result is treated as DIRECT.
+func ParseResult(result string) ([]Entry, error) {
+	var entries []Entry
+	for _, s := range strings.Split(result, ";") {
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		typ := strings.ToUpper(fields[0])
+		if typ == "DIRECT" {
+			entries = append(entries, Entry{Direct: true})
+			continue
+		}
+		scheme, ok := schemeOfType[typ]
+		if !ok || len(fields) != 2 {
+			return nil, fmt.Errorf("pac: invalid proxy entry %q", strings.TrimSpace(s))
+		}
+		host := fields[1]
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), defaultPort(scheme))
+		}
+		entries = append(entries, Entry{URL: &url.URL{Scheme: scheme, Host: host}})
+	}
+	if len(entries) == 0 {
+		entries = append(entries, Entry{Direct: true})
+	}
+	return entries, nil
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "https", "quic":
+		return "443"
+	case "socks4", "socks5":
+		return "1080"
+	}
+	return "80"
+}
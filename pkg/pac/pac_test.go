@@ -0,0 +1,342 @@
+package pac
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+const testScript = `
+function FindProxyForURL(url, host) {
+	if (isPlainHostName(host) || dnsDomainIs(host, ".intranet.test")) {
+		return "DIRECT";
+	}
+	if (isInNet(host, "10.0.0.0", "255.0.0.0")) {
+		return "SOCKS5 socks.example.com";
+	}
+	if (shExpMatch(host, "*.example.com")) {
+		return "PROXY a.example.com:8080; HTTPS b.example.com; DIRECT";
+	}
+	return "PROXY fallback.example.com:3128";
+}
+`
+
+func mustNew(t *testing.T, script string) *PAC {
+	t.Helper()
+	p, err := New(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestFindProxy(t *testing.T) {
+	p := mustNew(t, testScript)
+	cases := []struct {
+		url  string
+		want []string
+	}{
+		{"http://localhost/", []string{"DIRECT"}},
+		{"https://www.intranet.test/a", []string{"DIRECT"}},
+		{"http://10.1.2.3/", []string{"socks5://socks.example.com:1080"}},
+		{"https://api.example.com/x", []string{"http://a.example.com:8080", "https://b.example.com:443", "DIRECT"}},
+		{"http://other.test/", []string{"http://fallback.example.com:3128"}},
+	}
+	for _, c := range cases {
+		entries, err := p.FindProxy(mustParseURL(t, c.url))
+		if err != nil {
+			t.Fatalf("%s: %v", c.url, err)
+		}
+		if len(entries) != len(c.want) {
+			t.Fatalf("%s: got %v, want %v", c.url, entries, c.want)
+		}
+		for i, e := range entries {
+			if e.String() != c.want[i] {
+				t.Errorf("%s: entry %d = %s, want %s", c.url, i, e, c.want[i])
+			}
+		}
+	}
+}
+
+func TestFindProxyCache(t *testing.T) {
+	p := mustNew(t, `
+var calls = 0;
+function FindProxyForURL(url, host) {
+	calls++;
+	return "PROXY p" + calls + ".test:80";
+}`)
+	find := func(u string) string {
+		entries, err := p.FindProxy(mustParseURL(t, u))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries[0].String()
+	}
+	// The script sees the full http URLs, but only the host of https URLs.
+	if e1, e2 := find("http://a.test/one"), find("http://a.test/two"); e1 == e2 {
+		t.Errorf("result of http://a.test/one reused for http://a.test/two: %s", e1)
+	}
+	if e1, e2 := find("https://a.test/one"), find("https://a.test/two"); e1 != e2 {
+		t.Errorf("result not cached per https host: %s != %s", e1, e2)
+	}
+	e1 := find("http://a.test/one")
+	if e2 := find("http://a.test/one"); e1 != e2 {
+		t.Errorf("result not cached: %s != %s", e1, e2)
+	}
+
+	p.CacheTTL = -1
+	if e2 := find("http://a.test/one"); e1 == e2 {
+		t.Errorf("result cached although the cache is disabled")
+	}
+}
+
+func TestHTTPSURLIsStripped(t *testing.T) {
+	// The script reports the URL it sees as the proxy host.
+	p := mustNew(t, `
+function FindProxyForURL(url, host) {
+	return "PROXY " + encodeURIComponent(url) + ":1";
+}`)
+	for u, want := range map[string]string{
+		"https://a.test/secret?token=1": "https://a.test/",
+		"http://b.test/path?q=1":        "http://b.test/path?q=1",
+	} {
+		entries, err := p.FindProxy(mustParseURL(t, u))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := url.QueryUnescape(entries[0].URL.Hostname()); got != want {
+			t.Errorf("script saw %q, want %q", got, want)
+		}
+	}
+}
+
+func TestProxyFailover(t *testing.T) {
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.Addr().String()
+	dead.Close()
+
+	alive, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alive.Close()
+	go func() {
+		for {
+			c, err := alive.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	p := mustNew(t, `function FindProxyForURL(url, host) {
+		if (host == "direct.test") return "PROXY `+deadAddr+`; DIRECT";
+		return "PROXY `+deadAddr+`; SOCKS5 `+alive.Addr().String()+`";
+	}`)
+
+	// The proxies are checked in the background, the dead one is skipped
+	// once its check failed.
+	req, _ := http.NewRequest("GET", "http://a.test/", nil)
+	var u *url.URL
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if u, err = p.Proxy(req); err != nil {
+			t.Fatal(err)
+		}
+		if u.Host != deadAddr {
+			break
+		}
+	}
+	if u == nil || u.Host != alive.Addr().String() || u.Scheme != "socks5" {
+		t.Fatalf("Proxy() = %v, want socks5://%s", u, alive.Addr())
+	}
+
+	req, _ = http.NewRequest("GET", "http://direct.test/", nil)
+	u, err = p.Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != nil {
+		t.Fatalf("Proxy() = %v, want DIRECT", u)
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	p := mustNew(t, `function FindProxyForURL(url, host) { return "PROXY a.test:1; PROXY b.test:2"; }`)
+	p.DialTimeout = -1
+	req, _ := http.NewRequest("GET", "http://x.test/", nil)
+	u, _ := p.Proxy(req)
+	if u.Host != "a.test:1" {
+		t.Fatalf("Proxy() = %v, want a.test:1", u)
+	}
+	p.DialTimeout = time.Second
+	p.MarkFailed(u)
+	p.health["http://b.test:2"] = &proxyHealth{up: true, checkAt: time.Now().Add(time.Minute)}
+	u, _ = p.Proxy(req)
+	if u.Host != "b.test:2" {
+		t.Fatalf("Proxy() = %v, want b.test:2 after a.test:1 failed", u)
+	}
+	// The health is tracked per proxy URL, not per address.
+	p.DialTimeout = -1
+	if !p.reachable(&url.URL{Scheme: "socks5", Host: "a.test:1"}) {
+		t.Error("socks5://a.test:1 is unreachable after http://a.test:1 failed")
+	}
+}
+
+func TestInstall(t *testing.T) {
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.Addr().String()
+	dead.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer server.Close()
+
+	p := mustNew(t, `function FindProxyForURL(url, host) { return "PROXY `+deadAddr+`; DIRECT"; }`)
+	p.DialTimeout = -1
+	c := p.Install(req.C())
+	if _, err := c.R().Get(server.URL); err == nil {
+		t.Fatal("expected error through the dead proxy")
+	}
+	resp, err := c.R().Get(server.URL)
+	if err != nil {
+		t.Fatalf("request after the proxy failed: %v", err)
+	}
+	if resp.String() != "direct" {
+		t.Errorf("body = %q, want direct", resp.String())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		w.Write([]byte(testScript))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "proxy.pac")
+	if err := os.WriteFile(file, []byte(testScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{server.URL + "/proxy.pac", file, "file://" + file} {
+		fn, err := ProxyFromPAC(source)
+		if err != nil {
+			t.Fatalf("ProxyFromPAC(%q): %v", source, err)
+		}
+		req, _ := http.NewRequest("GET", "http://localhost/", nil)
+		if u, err := fn(req); err != nil || u != nil {
+			t.Errorf("ProxyFromPAC(%q) returned (%v, %v), want DIRECT", source, u, err)
+		}
+	}
+
+	// A script is not a location, New compiles it.
+	if _, err := Load(testScript); err == nil {
+		t.Error("expected error for Load of a script")
+	}
+	if _, err := New("function foo() {}"); err == nil {
+		t.Error("expected error for script without FindProxyForURL")
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	entries, err := ParseResult("PROXY [::1]:8080;socks 1.2.3.4 ; QUIC q.test; ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://[::1]:8080", "socks4://1.2.3.4:1080", "quic://q.test:443"}
+	for i, e := range entries {
+		if e.String() != want[i] {
+			t.Errorf("entry %d = %s, want %s", i, e, want[i])
+		}
+	}
+	if entries, _ := ParseResult(""); len(entries) != 1 || !entries[0].Direct {
+		t.Errorf("empty result = %v, want DIRECT", entries)
+	}
+	if _, err := ParseResult("FTP a.test:21"); err == nil {
+		t.Error("expected error for unknown proxy type")
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	if !shExpMatch("www.example.com", "*.example.*") || shExpMatch("example.com", "*.example.com") {
+		t.Error("shExpMatch mismatch")
+	}
+	if !shExpMatch("a.b", "?.b") || shExpMatch("ab.b", "?.b") {
+		t.Error("shExpMatch ? mismatch")
+	}
+	if !localHostOrDomainIs("www", "www.example.com") || localHostOrDomainIs("www.other.com", "www.example.com") {
+		t.Error("localHostOrDomainIs mismatch")
+	}
+	if dnsDomainLevels("www.example.com") != 2 {
+		t.Error("dnsDomainLevels mismatch")
+	}
+	if convertAddr("104.16.41.2") != 1745889538 {
+		t.Error("convert_addr mismatch")
+	}
+	if got := sortIPAddressList("10.2.3.9;2001:4898:28:3:201:2ff:feea:fc14;::1;127.0.0.1"); got != "::1;2001:4898:28:3:201:2ff:feea:fc14;10.2.3.9;127.0.0.1" {
+		t.Errorf("sortIpAddressList = %q", got)
+	}
+	p := mustNew(t, testScript)
+	if !p.isInNetEx("10.1.2.3", "10.0.0.0/8") || p.isInNetEx("::1", "10.0.0.0/8") {
+		t.Error("isInNetEx mismatch")
+	}
+}
+
+func TestTimeFunctions(t *testing.T) {
+	// Wednesday, 2024-03-13 14:30:00
+	now := time.Date(2024, time.March, 13, 14, 30, 0, 0, time.UTC)
+	cases := []struct {
+		fn   func([]string, time.Time) bool
+		args []string
+		want bool
+	}{
+		{weekdayRange, []string{"MON", "FRI"}, true},
+		{weekdayRange, []string{"SAT", "TUE"}, false},
+		{weekdayRange, []string{"FRI", "WED"}, true},
+		{weekdayRange, []string{"WED"}, true},
+		{dateRange, []string{"13"}, true},
+		{dateRange, []string{"MAR"}, true},
+		{dateRange, []string{"2023"}, false},
+		{dateRange, []string{"1", "15"}, true},
+		{dateRange, []string{"JAN", "FEB"}, false},
+		{dateRange, []string{"NOV", "MAR"}, true},
+		{dateRange, []string{"1", "JAN", "12", "MAR"}, false},
+		{dateRange, []string{"1", "JAN", "13", "MAR"}, true},
+		{dateRange, []string{"OCT", "2023", "MAR", "2024"}, true},
+		{dateRange, []string{"1", "JAN", "2024", "31", "DEC", "2024"}, true},
+		{dateRange, []string{"JAN", "1"}, false},
+		{timeRange, []string{"14"}, true},
+		{timeRange, []string{"9", "17"}, true},
+		{timeRange, []string{"22", "6"}, false},
+		{timeRange, []string{"14", "30", "14", "31"}, true},
+		{timeRange, []string{"14", "30", "1", "14", "31", "0"}, false},
+	}
+	for _, c := range cases {
+		if got := c.fn(c.args, now); got != c.want {
+			t.Errorf("%v = %v, want %v", c.args, got, c.want)
+		}
+	}
+}
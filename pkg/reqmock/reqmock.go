@@ -0,0 +1,547 @@
+// Package reqmock mocks the servers of req clients in tests, without
+// listening on the network. A Transport is registered responders, each
+// matching the requests by method, URL pattern, query, headers and body,
+// and replying with bodies, JSON, XML, files, errors or delays, including
+// chunked bodies, trailers and connections dropped in the middle of the
+// body to test the retry and download logic.
+//
+// For example:
+//
+//	mock := reqmock.New()
+//	client := mock.Install(req.C())
+//	mock.On("GET", "https://api.example.com/users/*").
+//		ReplyError(errors.New("connection reset")).
+//		ReplyJSON(200, user)
+//	...
+//	mock.AssertExpectations(t)
+package reqmock
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+// ErrNoResponder is returned when no responder matches a request.
+var ErrNoResponder = errors.New("reqmock: no responder matches the request")
+
+// Transport is a mock http.RoundTripper, which replies to the requests with
+// the first registered responder matching them. It is safe for concurrent
+// use.
+type Transport struct {
+	mu         sync.Mutex
+	responders []*Responder
+	calls      int
+}
+
+// New returns a Transport without responders.
+func New() *Transport {
+	return &Transport{}
+}
+
+// Install makes c send its requests to t instead of the network, and
+// returns c. The middlewares and the response handling of c, e.g. the
+// retries, the redirects and the decoding, still apply, as well as its HAR
+// recorder, its fault injector and the round trip middlewares added after
+// Install. t replaces the transport from the round trip middlewares added
+// before Install down, so the requests are neither dumped, which happens
+// on the connections, nor recorded or replayed by a cassette.
+func (t *Transport) Install(c *req.Client) *req.Client {
+	c.Transport.WrapRoundTrip(func(http.RoundTripper) http.RoundTripper {
+		return t
+	})
+	return c
+}
+
+// On registers a responder of the requests with the method, "" or "*" for
+// any method, and the URL pattern, and returns it.
+//
+// The pattern is a URL, or a path matching the requests to any host, where
+// "*" matches any part of a path segment as in path.Match. The query
+// parameters of the pattern must be in the requests, which may have more.
+func (t *Transport) On(method, pattern string) *Responder {
+	u, err := url.Parse(pattern)
+	r := newResponder(method)
+	if err != nil {
+		r.err = fmt.Errorf("reqmock: invalid pattern %q: %w", pattern, err)
+	} else {
+		r.pattern = u
+		for key, values := range u.Query() {
+			for _, value := range values {
+				r.WithQuery(key, value)
+			}
+		}
+	}
+	return t.add(r)
+}
+
+// OnRegexp registers a responder of the requests with the method, "" or
+// "*" for any method, and the URL, query included, matching re, and
+// returns it.
+func (t *Transport) OnRegexp(method string, re *regexp.Regexp) *Responder {
+	r := newResponder(method)
+	r.re = re
+	return t.add(r)
+}
+
+func (t *Transport) add(r *Responder) *Responder {
+	r.t = t
+	t.mu.Lock()
+	t.responders = append(t.responders, r)
+	t.mu.Unlock()
+	return r
+}
+
+// Reset removes the responders and the calls.
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	t.responders = nil
+	t.calls = 0
+	t.mu.Unlock()
+}
+
+// CallCount returns the number of requests sent to t, matched or not.
+func (t *Transport) CallCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.calls
+}
+
+// AssertExpectations reports an error to tb for each responder which is not
+// called as expected, at least once, or the number of times set by Times,
+// unless it is Maybe.
+func (t *Transport) AssertExpectations(tb testing.TB) {
+	tb.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range t.responders {
+		switch {
+		case r.times > 0 && r.calls != r.times:
+			tb.Errorf("reqmock: %s is called %d times, expected %d", r, r.calls, r.times)
+		case r.times == 0 && !r.maybe && r.calls == 0:
+			tb.Errorf("reqmock: %s is not called", r)
+		}
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	t.calls++
+	var found *Responder
+	var rep *reply
+	for _, r := range t.responders {
+		if (r.times > 0 && r.calls >= r.times) || !r.match(req, body) {
+			continue
+		}
+		found = r
+		if len(r.replies) > 0 {
+			rep = r.replies[min(r.calls, len(r.replies)-1)]
+		}
+		r.calls++
+		break
+	}
+	t.mu.Unlock()
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoResponder, req.Method, req.URL)
+	}
+	if found.err != nil {
+		return nil, found.err
+	}
+	if rep == nil {
+		rep = &reply{status: http.StatusOK, header: make(http.Header), body: func() ([]byte, error) {
+			return nil, nil
+		}}
+	}
+	return rep.respond(req)
+}
+
+// Responder replies to the matching requests, see Transport.On, with an
+// empty 200 response if no reply is added. The matchers and the replies
+// must be set before the requests are sent.
+type Responder struct {
+	t        *Transport
+	method   string
+	pattern  *url.URL
+	re       *regexp.Regexp
+	matchers []func(req *http.Request, body []byte) bool
+	replies  []*reply
+	times    int
+	maybe    bool
+	err      error
+
+	calls int // guarded by the mutex of the Transport
+}
+
+func newResponder(method string) *Responder {
+	if method == "*" {
+		method = ""
+	}
+	return &Responder{method: strings.ToUpper(method)}
+}
+
+// String returns the method and the pattern of the responder.
+func (r *Responder) String() string {
+	method := r.method
+	if method == "" {
+		method = "*"
+	}
+	switch {
+	case r.re != nil:
+		return fmt.Sprintf("responder of %s %s", method, r.re)
+	case r.pattern != nil:
+		return fmt.Sprintf("responder of %s %s", method, r.pattern)
+	default:
+		return fmt.Sprintf("responder of %s", method)
+	}
+}
+
+func (r *Responder) match(req *http.Request, body []byte) bool {
+	if r.method != "" && r.method != req.Method {
+		return false
+	}
+	if r.re != nil && !r.re.MatchString(req.URL.String()) {
+		return false
+	}
+	if p := r.pattern; p != nil {
+		if p.Scheme != "" && p.Scheme != req.URL.Scheme {
+			return false
+		}
+		if p.Host != "" && p.Host != req.URL.Host {
+			return false
+		}
+		if ok, _ := path.Match(cmp.Or(p.Path, "/"), cmp.Or(req.URL.Path, "/")); !ok {
+			return false
+		}
+	}
+	for _, m := range r.matchers {
+		if !m(req, body) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match adds a matcher of the requests, which is passed the request body
+// already read.
+func (r *Responder) Match(fn func(req *http.Request, body []byte) bool) *Responder {
+	r.matchers = append(r.matchers, fn)
+	return r
+}
+
+// WithQuery matches the requests with the query parameter.
+func (r *Responder) WithQuery(key, value string) *Responder {
+	return r.Match(func(req *http.Request, body []byte) bool {
+		return slices.Contains(req.URL.Query()[key], value)
+	})
+}
+
+// WithHeader matches the requests with the header.
+func (r *Responder) WithHeader(key, value string) *Responder {
+	return r.Match(func(req *http.Request, body []byte) bool {
+		return slices.Contains(req.Header.Values(key), value)
+	})
+}
+
+// WithBody matches the requests with the body.
+func (r *Responder) WithBody(body string) *Responder {
+	return r.Match(func(req *http.Request, b []byte) bool {
+		return string(b) == body
+	})
+}
+
+// WithBodyContains matches the requests whose body contains s.
+func (r *Responder) WithBodyContains(s string) *Responder {
+	return r.Match(func(req *http.Request, b []byte) bool {
+		return bytes.Contains(b, []byte(s))
+	})
+}
+
+// WithJSONBody matches the requests whose JSON body equals v marshalled
+// to JSON, whatever the formatting and the order of the object keys.
+func (r *Responder) WithJSONBody(v any) *Responder {
+	want, err := jsonValue(v)
+	if err != nil {
+		r.err = fmt.Errorf("reqmock: invalid JSON body: %w", err)
+	}
+	return r.Match(func(req *http.Request, b []byte) bool {
+		var got any
+		return json.Unmarshal(b, &got) == nil && reflect.DeepEqual(want, got)
+	})
+}
+
+func jsonValue(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	err = json.Unmarshal(data, &value)
+	return value, err
+}
+
+// Times sets the number of requests the responder replies to, after which
+// the requests go to the next matching responders, and which is expected
+// by Transport.AssertExpectations.
+func (r *Responder) Times(n int) *Responder {
+	r.times = n
+	return r
+}
+
+// Once is Times(1).
+func (r *Responder) Once() *Responder {
+	return r.Times(1)
+}
+
+// Maybe makes the responder optional for Transport.AssertExpectations.
+func (r *Responder) Maybe() *Responder {
+	r.maybe = true
+	return r
+}
+
+// Calls returns the number of requests the responder replied to.
+func (r *Responder) Calls() int {
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	return r.calls
+}
+
+// reply is a reply of a Responder.
+type reply struct {
+	status        int
+	header        http.Header
+	trailer       http.Header
+	body          func() ([]byte, error)
+	err           error
+	fn            func(req *http.Request) (*http.Response, error)
+	delay         time.Duration
+	chunkSize     int
+	chunkInterval time.Duration
+	dropAfter     int
+}
+
+// Reply adds a reply with the status and the body. The requests get the
+// replies in the order they are added, and the last reply once all of them
+// are used.
+func (r *Responder) Reply(status int, body string) *Responder {
+	return r.addReply(&reply{status: status, body: func() ([]byte, error) {
+		return []byte(body), nil
+	}})
+}
+
+// ReplyJSON adds a reply with the status and v marshalled to JSON.
+func (r *Responder) ReplyJSON(status int, v any) *Responder {
+	r.addReply(&reply{status: status, body: func() ([]byte, error) {
+		return json.Marshal(v)
+	}})
+	return r.Header("Content-Type", "application/json; charset=utf-8")
+}
+
+// ReplyXML adds a reply with the status and v marshalled to XML.
+func (r *Responder) ReplyXML(status int, v any) *Responder {
+	r.addReply(&reply{status: status, body: func() ([]byte, error) {
+		return xml.Marshal(v)
+	}})
+	return r.Header("Content-Type", "application/xml; charset=utf-8")
+}
+
+// ReplyFile adds a reply with the status and the content of the file, read
+// when the request is sent.
+func (r *Responder) ReplyFile(status int, filename string) *Responder {
+	return r.addReply(&reply{status: status, body: func() ([]byte, error) {
+		return os.ReadFile(filename)
+	}})
+}
+
+// ReplyError adds a reply which fails the round trip with err, like a
+// network error.
+func (r *Responder) ReplyError(err error) *Responder {
+	return r.addReply(&reply{err: err})
+}
+
+// ReplyFunc adds a reply returned by fn.
+func (r *Responder) ReplyFunc(fn func(req *http.Request) (*http.Response, error)) *Responder {
+	return r.addReply(&reply{fn: fn})
+}
+
+func (r *Responder) addReply(rep *reply) *Responder {
+	rep.header = make(http.Header)
+	r.replies = append(r.replies, rep)
+	return r
+}
+
+// lastReply returns the reply the options apply to, a 200 reply without
+// body if there is none yet.
+func (r *Responder) lastReply() *reply {
+	if len(r.replies) == 0 {
+		r.Reply(http.StatusOK, "")
+	}
+	return r.replies[len(r.replies)-1]
+}
+
+// Header adds a header to the last reply.
+func (r *Responder) Header(key, value string) *Responder {
+	r.lastReply().header.Add(key, value)
+	return r
+}
+
+// Trailer adds a trailer to the last reply, which is set in the Trailer of
+// the response once its body is read.
+func (r *Responder) Trailer(key, value string) *Responder {
+	rep := r.lastReply()
+	if rep.trailer == nil {
+		rep.trailer = make(http.Header)
+	}
+	rep.trailer.Add(key, value)
+	return r
+}
+
+// Delay delays the last reply, or its failure, by d, unless the request is
+// canceled before.
+func (r *Responder) Delay(d time.Duration) *Responder {
+	r.lastReply().delay = d
+	return r
+}
+
+// Chunked makes the body of the last reply chunked, with an unknown length
+// and read by chunks of size bytes, interval apart.
+func (r *Responder) Chunked(size int, interval time.Duration) *Responder {
+	rep := r.lastReply()
+	rep.chunkSize, rep.chunkInterval = max(size, 1), interval
+	return r
+}
+
+// DropAfter makes the connection of the last reply drop after n bytes of
+// its body are read, the read fails with io.ErrUnexpectedEOF.
+func (r *Responder) DropAfter(n int) *Responder {
+	r.lastReply().dropAfter = max(n, 0) + 1
+	return r
+}
+
+func (rep *reply) respond(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if rep.delay > 0 {
+		if err := sleep(ctx, rep.delay); err != nil {
+			return nil, err
+		}
+	}
+	if rep.err != nil {
+		return nil, rep.err
+	}
+	if rep.fn != nil {
+		return rep.fn(req)
+	}
+	body, err := rep.body()
+	if err != nil {
+		return nil, err
+	}
+	resp := &http.Response{
+		Status:        strconv.Itoa(rep.status) + " " + http.StatusText(rep.status),
+		StatusCode:    rep.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rep.header.Clone(),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	b := &replyBody{ctx: ctx, data: body, resp: resp, rep: rep}
+	if rep.chunkSize > 0 || rep.trailer != nil {
+		resp.ContentLength = -1
+		resp.TransferEncoding = []string{"chunked"}
+	}
+	if rep.trailer != nil {
+		resp.Trailer = make(http.Header)
+		for key := range rep.trailer {
+			resp.Trailer[key] = nil
+		}
+	}
+	if rep.dropAfter > 0 {
+		b.drop = rep.dropAfter - 1
+	} else {
+		b.drop = -1
+	}
+	resp.Body = b
+	return resp, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// replyBody is the body of a reply.
+type replyBody struct {
+	ctx  context.Context
+	data []byte
+	off  int
+	drop int // the offset the connection drops at, -1 if never
+	resp *http.Response
+	rep  *reply
+}
+
+func (b *replyBody) Read(p []byte) (int, error) {
+	if b.off == b.drop {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if b.off >= len(b.data) {
+		for key, values := range b.rep.trailer {
+			b.resp.Trailer[key] = values
+		}
+		return 0, io.EOF
+	}
+	if b.rep.chunkInterval > 0 && b.off > 0 {
+		if err := sleep(b.ctx, b.rep.chunkInterval); err != nil {
+			return 0, err
+		}
+	}
+	end := len(b.data)
+	if b.rep.chunkSize > 0 {
+		end = min(end, b.off+b.rep.chunkSize)
+	}
+	if b.drop >= 0 {
+		end = min(end, b.drop)
+	}
+	n := copy(p, b.data[b.off:end])
+	b.off += n
+	return n, nil
+}
+
+func (b *replyBody) Close() error {
+	return nil
+}
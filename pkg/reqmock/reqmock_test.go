@@ -0,0 +1,200 @@
+package reqmock
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+type user struct {
+	XMLName xml.Name `json:"-" xml:"user"`
+	ID      int      `json:"id" xml:"id"`
+	Name    string   `json:"name" xml:"name"`
+}
+
+// recordingTB records the errors of AssertExpectations.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestResponders(t *testing.T) {
+	mock := New()
+	c := mock.Install(req.C())
+	mock.On("GET", "https://api.example.com/users/*?fields=name").ReplyJSON(200, &user{ID: 1, Name: "roc"})
+	mock.On("GET", "/users/*").ReplyXML(200, &user{ID: 2, Name: "req"})
+	mock.On("POST", "/users").WithJSONBody(map[string]any{"name": "roc", "id": 3}).Reply(201, "created")
+	mock.OnRegexp("*", regexp.MustCompile(`/teapot$`)).Reply(http.StatusTeapot, "").Header("X-Teapot", "yes").Maybe()
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filename, []byte("file content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mock.On("", "/file").WithHeader("X-Token", "abc").ReplyFile(200, filename)
+
+	var u user
+	resp, err := c.R().SetQueryParam("fields", "name").SetSuccessResult(&u).Get("https://api.example.com/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 || u.Name != "roc" || resp.GetContentType() != "application/json; charset=utf-8" {
+		t.Errorf("unexpected JSON response: %+v %s", u, resp.GetContentType())
+	}
+
+	u = user{}
+	_, err = c.R().SetSuccessResult(&u).Get("https://other.example.com/users/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 2 || u.Name != "req" {
+		t.Errorf("unexpected XML response: %+v", u)
+	}
+
+	resp, err = c.R().SetBodyJsonString(`{"id": 3, "name": "roc"}`).Post("https://api.example.com/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 || resp.String() != "created" {
+		t.Errorf("unexpected response: %d %s", resp.StatusCode, resp.String())
+	}
+	_, err = c.R().SetBodyJsonString(`{"id": 4, "name": "roc"}`).Post("https://api.example.com/users")
+	if !errors.Is(err, ErrNoResponder) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	resp, err = c.R().SetHeader("X-Token", "abc").Put("https://api.example.com/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.String() != "file content" {
+		t.Errorf("unexpected file response: %s", resp.String())
+	}
+
+	if n := mock.CallCount(); n != 5 {
+		t.Errorf("CallCount() = %d, want 5", n)
+	}
+	mock.AssertExpectations(t)
+}
+
+func TestExpectations(t *testing.T) {
+	mock := New()
+	c := mock.Install(req.C())
+	once := mock.On("GET", "/").Once().Reply(200, "first")
+	mock.On("GET", "/").Reply(200, "then")
+	mock.On("GET", "/never").Times(2)
+
+	for _, want := range []string{"first", "then", "then"} {
+		resp, err := c.R().Get("http://example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.String() != want {
+			t.Errorf("got %q, want %q", resp.String(), want)
+		}
+	}
+	if n := once.Calls(); n != 1 {
+		t.Errorf("Calls() = %d, want 1", n)
+	}
+	_, err := c.R().Get("http://example.com/never")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := &recordingTB{}
+	mock.AssertExpectations(tb)
+	if len(tb.errors) != 1 || tb.errors[0] != "reqmock: responder of GET /never is called 1 times, expected 2" {
+		t.Errorf("unexpected errors: %q", tb.errors)
+	}
+
+	mock.Reset()
+	tb = &recordingTB{}
+	mock.AssertExpectations(tb)
+	if len(tb.errors) != 0 || mock.CallCount() != 0 {
+		t.Errorf("unexpected errors after reset: %q", tb.errors)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	mock := New()
+	c := mock.Install(req.C()).
+		SetCommonRetryCount(3).
+		SetCommonRetryFixedInterval(time.Millisecond)
+	mock.On("GET", "/").
+		ReplyError(errors.New("connection reset")).
+		Reply(200, "hello world").DropAfter(5).
+		Reply(200, "hello world")
+
+	resp, err := c.R().Get("http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.String() != "hello world" {
+		t.Errorf("unexpected response: %s", resp.String())
+	}
+	if n := mock.CallCount(); n != 3 {
+		t.Errorf("CallCount() = %d, want 3", n)
+	}
+}
+
+func TestBody(t *testing.T) {
+	mock := New()
+	c := mock.Install(req.C())
+	mock.On("GET", "/chunked").
+		Reply(200, "hello world").Chunked(4, 0).Trailer("X-Checksum", "abc")
+	mock.On("GET", "/drop").Reply(200, "hello world").DropAfter(5)
+	mock.On("GET", "/slow").Reply(200, "hello").Delay(time.Second)
+
+	resp, err := c.R().DisableAutoReadResponse().Get("http://example.com/chunked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentLength != -1 || len(resp.TransferEncoding) != 1 {
+		t.Errorf("unexpected length %d %q", resp.ContentLength, resp.TransferEncoding)
+	}
+	buf := make([]byte, 100)
+	n, _ := resp.Body.Read(buf)
+	if n != 4 {
+		t.Errorf("read %d bytes, want a chunk of 4", n)
+	}
+	if resp.Trailer.Get("X-Checksum") != "" {
+		t.Error("trailer is set before the body is read")
+	}
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || string(buf[:n])+string(rest) != "hello world" {
+		t.Errorf("unexpected body %q: %v", rest, err)
+	}
+	if resp.Trailer.Get("X-Checksum") != "abc" {
+		t.Errorf("unexpected trailer: %v", resp.Trailer)
+	}
+
+	resp, err = c.R().DisableAutoReadResponse().Get("http://example.com/drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if string(data) != "hello" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("unexpected body %q: %v", data, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.R().SetContext(ctx).Get("http://example.com/slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package req
+
+import (
+	"sync"
+
+	h2internal "github.com/imroc/req/v3/internal/http2"
+	"github.com/imroc/req/v3/internal/transport"
+)
+
+// ConnEventType is the type of a ConnEvent.
+type ConnEventType uint8
+
+// The types of the connection events.
+const (
+	// ConnEventOpened is emitted when a connection is opened.
+	ConnEventOpened ConnEventType = iota + 1
+	// ConnEventReused is emitted when a connection which served requests
+	// before starts serving another one, for each stream after the first
+	// one of HTTP/2 and HTTP/3 connections.
+	ConnEventReused
+	// ConnEventClosed is emitted when a connection is closed, e.g. by the
+	// server or because of an error.
+	ConnEventClosed
+	// ConnEventEvicted is emitted when a connection is closed by the pool,
+	// because it was idle for too long, there were too many idle
+	// connections or CloseIdleConnections was called.
+	ConnEventEvicted
+)
+
+// String returns the name of the event type.
+func (t ConnEventType) String() string {
+	switch t {
+	case ConnEventOpened:
+		return "opened"
+	case ConnEventReused:
+		return "reused"
+	case ConnEventClosed:
+		return "closed"
+	case ConnEventEvicted:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnEvent is an event of the lifecycle of a connection of the pool, see
+// Transport.SetConnEventHook.
+type ConnEvent struct {
+	// Type is the type of the event.
+	Type ConnEventType
+
+	// Addr is the host:port the connection is for.
+	Addr string
+
+	// Proto is the protocol of the connection, "HTTP/1.1", "HTTP/2.0" or
+	// "HTTP/3.0".
+	Proto string
+
+	// Err is the reason the connection is closed or evicted, if known.
+	Err error
+}
+
+// HTTP2ConnState is the state of an HTTP/2 connection, see HostStats.
+type HTTP2ConnState = h2internal.ClientConnState
+
+// HostStats is a snapshot of the connections of the pool to a host, see
+// Transport.Stats.
+type HostStats struct {
+	// ActiveConns is the number of connections serving requests.
+	ActiveConns int
+
+	// IdleConns is the number of connections waiting for requests.
+	IdleConns int
+
+	// Streams is the number of HTTP/2 and HTTP/3 streams in use.
+	Streams int
+
+	// HTTP2Conns are the states of the HTTP/2 connections, with their
+	// streams in use and the MaxConcurrentStreams advertised by the
+	// server.
+	HTTP2Conns []HTTP2ConnState
+
+	// Dialing is the number of connections being dialed.
+	Dialing int
+
+	// Waiting is the number of requests waiting for a connection.
+	Waiting int
+
+	// WaitingMaxConns is the number of the requests of Waiting which can
+	// not dial a connection because of MaxConnsPerHost.
+	WaitingMaxConns int
+}
+
+// connStats counts the connections of the pool of a Transport, it is the
+// ConnStateHook of the Transport.
+type connStats struct {
+	t *Transport
+
+	mu    sync.Mutex
+	hosts map[string]*HostStats // by host:port, only the counters are set
+}
+
+func (s *connStats) observe(change *transport.ConnStateChange) {
+	s.mu.Lock()
+	if s.hosts == nil {
+		s.hosts = make(map[string]*HostStats)
+	}
+	hs := s.hosts[change.Addr]
+	if hs == nil {
+		hs = &HostStats{}
+		s.hosts[change.Addr] = hs
+	}
+	if change.From != change.To {
+		hs.addConns(change.From, -1)
+		hs.addConns(change.To, 1)
+	}
+	hs.Streams += change.Streams
+	if hs.ActiveConns == 0 && hs.IdleConns == 0 && hs.Streams == 0 {
+		delete(s.hosts, change.Addr)
+	}
+	s.mu.Unlock()
+
+	if m := s.t.metrics; m != nil {
+		m.ObserveConnState(change)
+	}
+	if hook := s.t.connEventHook; hook != nil {
+		e := &ConnEvent{Addr: change.Addr, Proto: change.Proto}
+		switch {
+		case change.From == ConnNew && change.To != ConnNew:
+			e.Type = ConnEventOpened
+		case change.Reused:
+			e.Type = ConnEventReused
+		case change.To == ConnClosed && change.Evicted:
+			e.Type, e.Err = ConnEventEvicted, change.Err
+		case change.To == ConnClosed:
+			e.Type, e.Err = ConnEventClosed, change.Err
+		default:
+			return
+		}
+		hook(e)
+	}
+}
+
+func (hs *HostStats) addConns(state ConnState, delta int) {
+	switch state {
+	case ConnActive:
+		hs.ActiveConns += delta
+	case ConnIdle:
+		hs.IdleConns += delta
+	}
+}
+
+// SetConnEventHook set the hook which is called when a connection of the
+// pool is opened, reused, closed or evicted, nil to disable it. The hook
+// is called concurrently, sometimes with the lock of the connection held,
+// so it must be fast and must not call the Transport.
+func (t *Transport) SetConnEventHook(hook func(e *ConnEvent)) *Transport {
+	t.connEventHook = hook
+	return t
+}
+
+// Stats returns a snapshot of the connections of the pool, and of the
+// requests waiting for one, by host:port, which helps to diagnose the
+// starvation of the pool.
+func (t *Transport) Stats() map[string]*HostStats {
+	stats := make(map[string]*HostStats)
+	host := func(addr string) *HostStats {
+		hs := stats[addr]
+		if hs == nil {
+			hs = &HostStats{}
+			stats[addr] = hs
+		}
+		return hs
+	}
+
+	t.connStats.mu.Lock()
+	for addr, hs := range t.connStats.hosts {
+		*host(addr) = *hs
+	}
+	t.connStats.mu.Unlock()
+
+	t.idleMu.Lock()
+	for key, q := range t.idleConnWait {
+		q.all(func(w *wantConn) {
+			if w.waiting() {
+				host(key.addr).Waiting++
+			}
+		})
+	}
+	t.idleMu.Unlock()
+
+	t.connsPerHostMu.Lock()
+	for key, q := range t.connsPerHostWait {
+		q.all(func(w *wantConn) {
+			if w.waiting() {
+				host(key.addr).WaitingMaxConns++
+			}
+		})
+	}
+	t.dialsInProgress.all(func(w *wantConn) {
+		if w.cancelCtx != nil {
+			host(w.key.addr).Dialing++
+		}
+	})
+	t.connsPerHostMu.Unlock()
+
+	if t.t2 != nil {
+		for addr, states := range t.t2.ConnStates() {
+			host(addr).HTTP2Conns = states
+		}
+	}
+	return stats
+}
@@ -0,0 +1,140 @@
+package req
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+type connEventRecorder struct {
+	mu     sync.Mutex
+	events []ConnEvent
+}
+
+func (r *connEventRecorder) record(e *ConnEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, *e)
+	r.mu.Unlock()
+}
+
+// count returns the number of the recorded events of type typ.
+func (r *connEventRecorder) count(typ ConnEventType) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, e := range r.events {
+		if e.Type == typ {
+			n++
+		}
+	}
+	return n
+}
+
+// last returns the last recorded event of type typ.
+func (r *connEventRecorder) last(typ ConnEventType) ConnEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].Type == typ {
+			return r.events[i]
+		}
+	}
+	return ConnEvent{}
+}
+
+// waitFor waits for cond to be true, for the asynchronous changes of the
+// connections.
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	for range 100 {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("timeout waiting for %s", desc)
+}
+
+func TestPoolStatsHTTP1(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	var rec connEventRecorder
+	c := C().SetConnEventHook(rec.record)
+	c.SetMaxConnsPerHost(1)
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() {
+			resp, err := c.R().Get(srv.URL)
+			assertSuccess(t, resp, err)
+		})
+	}
+	waitFor(t, "waiting requests", func() bool {
+		hs := c.Stats()[host]
+		return hs != nil && hs.ActiveConns == 1 && hs.Waiting == 2 && hs.WaitingMaxConns == 2
+	})
+	close(release)
+	wg.Wait()
+
+	waitFor(t, "idle connection", func() bool {
+		hs := c.Stats()[host]
+		return hs != nil && hs.IdleConns == 1 && hs.ActiveConns == 0 && hs.Waiting == 0
+	})
+	tests.AssertEqual(t, 1, rec.count(ConnEventOpened))
+	tests.AssertEqual(t, 2, rec.count(ConnEventReused))
+	tests.AssertEqual(t, "HTTP/1.1", rec.last(ConnEventReused).Proto)
+
+	c.CloseIdleConnections()
+	waitFor(t, "evicted connection", func() bool {
+		return rec.count(ConnEventEvicted) == 1
+	})
+	e := rec.last(ConnEventEvicted)
+	tests.AssertEqual(t, host, e.Addr)
+	tests.AssertErrorContains(t, e.Err, "CloseIdleConnections")
+	tests.AssertEqual(t, 0, len(c.Stats()))
+}
+
+func TestPoolStatsHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	var rec connEventRecorder
+	c := C().EnableInsecureSkipVerify().SetConnEventHook(rec.record)
+	for range 2 {
+		resp, err := c.R().Get(srv.URL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "HTTP/2.0", resp.String())
+	}
+	waitFor(t, "idle connection", func() bool {
+		hs := c.Stats()[host]
+		return hs != nil && hs.IdleConns == 1 && hs.Streams == 0
+	})
+	hs := c.Stats()[host]
+	tests.AssertEqual(t, 1, len(hs.HTTP2Conns))
+	tests.AssertEqual(t, 0, hs.HTTP2Conns[0].StreamsActive)
+	tests.AssertEqual(t, true, hs.HTTP2Conns[0].MaxConcurrentStreams > 0)
+	tests.AssertEqual(t, 1, rec.count(ConnEventOpened))
+	tests.AssertEqual(t, 1, rec.count(ConnEventReused))
+	tests.AssertEqual(t, "HTTP/2.0", rec.last(ConnEventReused).Proto)
+
+	c.CloseIdleConnections()
+	waitFor(t, "evicted connection", func() bool {
+		return rec.count(ConnEventEvicted) == 1
+	})
+	tests.AssertErrorContains(t, rec.last(ConnEventEvicted).Err, "CloseIdleConnections")
+	tests.AssertEqual(t, 0, rec.count(ConnEventClosed))
+}
@@ -0,0 +1,109 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SetProxyChain makes the Transport connect through an ordered chain of
+// proxies, the first one is dialed directly and each next hop is reached
+// through a tunnel opened by the previous one, the last one connects to
+// the target. "http", "https", "socks5", "socks5h", "socks4" and "socks4a"
+// proxies are supported and can be mixed. Credentials are given per hop as
+// the userinfo of each URL, and GetProxyConnectHeader is called for each
+// hop with its URL. Calling it with a single proxy is the same as
+// SetProxy(http.ProxyURL(proxyURL)), calling it with no proxy disables the
+// proxy.
+//
+// Each hop is reported in TraceInfo.ProxyHops. HTTP/3 requests can not be
+// relayed through a chain and fail.
+func (t *Transport) SetProxyChain(proxyURLs ...*url.URL) *Transport {
+	switch len(proxyURLs) {
+	case 0:
+		t.proxyChain = nil
+		t.Proxy = nil
+	case 1:
+		t.proxyChain = nil
+		t.Proxy = http.ProxyURL(proxyURLs[0])
+	default:
+		chain := append([]*url.URL(nil), proxyURLs...)
+		t.proxyChain = chain
+		t.Proxy = http.ProxyURL(chain[len(chain)-1])
+	}
+	return t
+}
+
+// proxyChainHops returns the proxies to go through before reaching
+// proxyURL, if it is the last hop of the proxy chain.
+func (t *Transport) proxyChainHops(proxyURL *url.URL) []*url.URL {
+	n := len(t.proxyChain)
+	// proxyURL may be a copy of the last hop, e.g. made by a wrapper of
+	// the proxy function.
+	if n == 0 || proxyURL.String() != t.proxyChain[n-1].String() {
+		return nil
+	}
+	return t.proxyChain[:n-1]
+}
+
+// dialProxyChain dials the first hop and opens a tunnel through each hop
+// to the next one, the returned conn is connected to last.
+func (t *Transport) dialProxyChain(ctx context.Context, hops []*url.URL, last *url.URL) (net.Conn, error) {
+	conn, err := t.dial(ctx, "tcp", canonicalAddr(hops[0]))
+	if err != nil {
+		return nil, err
+	}
+	for i, hop := range hops {
+		next := last
+		if i+1 < len(hops) {
+			next = hops[i+1]
+		}
+		start := time.Now()
+		conn, err = t.tunnelThroughHop(ctx, conn, hop, canonicalAddr(next))
+		traceProxyHop(ctx, hop, canonicalAddr(next), start, err)
+		if err != nil {
+			return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Addr: hopAddr{hop}, Err: err}
+		}
+	}
+	return conn, nil
+}
+
+// tunnelThroughHop opens a tunnel to target through the proxy hop which
+// conn is connected to, conn is closed on failure.
+func (t *Transport) tunnelThroughHop(ctx context.Context, conn net.Conn, hop *url.URL, target string) (net.Conn, error) {
+	switch hop.Scheme {
+	case "http", "https", "socks5", "socks5h", "socks4", "socks4a":
+	default:
+		conn.Close()
+		return nil, errors.New("unsupported proxy scheme " + hop.Scheme + " in proxy chain")
+	}
+	if hop.Scheme == "https" {
+		// The tunnel only carries the CONNECT request, so HTTP/1.1 is
+		// always negotiated with intermediate hops.
+		pc := &persistConn{t: t, conn: conn, cacheKey: connectMethodKey{scheme: "http"}}
+		if err := pc.addTLS(ctx, hop.Hostname(), nil, true); err != nil {
+			return nil, err
+		}
+		conn = pc.conn
+	}
+	cm := connectMethod{proxyURL: hop, targetScheme: "https", targetAddr: target}
+	if err := t.connectThroughProxy(ctx, conn, cm); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// hopAddr is the net.Addr of a proxy hop in errors.
+type hopAddr struct {
+	u *url.URL
+}
+
+func (a hopAddr) Network() string { return a.u.Scheme }
+
+func (a hopAddr) String() string { return canonicalAddr(a.u) }
+
+var errProxyChainUDP = errors.New("HTTP/3 can not be relayed through a proxy chain")
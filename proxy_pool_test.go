@@ -0,0 +1,174 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+// startForwardProxy starts a plain HTTP forward proxy which sets the
+// X-Proxy header of the responses to name.
+func startForwardProxy(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("X-Proxy", name)
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+}
+
+func deadProxyURL(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return "http://" + addr
+}
+
+func newTestRequest(t *testing.T) *http.Request {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestProxyPoolEjectsFailingProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	proxy := startForwardProxy("alive")
+	defer proxy.Close()
+
+	dead := deadProxyURL(t)
+	pool, err := NewProxyPool(dead, proxy.URL)
+	tests.AssertNoError(t, err)
+	pool.SetEjectPolicy(1, time.Minute)
+	client := tc().SetProxyPool(pool)
+
+	_, err = client.R().Get(backend.URL)
+	if err == nil {
+		t.Fatal("expected the request through the dead proxy to fail")
+	}
+	for range 3 {
+		resp, err := client.R().Get(backend.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "alive", resp.GetHeader("X-Proxy"))
+	}
+
+	stats := pool.Stats()
+	tests.AssertEqual(t, 2, len(stats))
+	tests.AssertEqual(t, int64(1), stats[0].Failures)
+	tests.AssertEqual(t, false, stats[0].EjectedUntil.IsZero())
+	tests.AssertEqual(t, int64(3), stats[1].Requests)
+	tests.AssertEqual(t, true, stats[1].EjectedUntil.IsZero())
+}
+
+func TestProxyPoolNoProxyAvailable(t *testing.T) {
+	pool, err := NewProxyPool("http://127.0.0.1:1")
+	tests.AssertNoError(t, err)
+	pool.ReportFailure(&url.URL{Scheme: "http", Host: "127.0.0.1:1"})
+	_, err = pool.Proxy(newTestRequest(t))
+	if !errors.Is(err, ErrNoProxyAvailable) {
+		t.Fatalf("err = %v; want ErrNoProxyAvailable", err)
+	}
+}
+
+func TestProxyPoolStrategies(t *testing.T) {
+	pool, err := NewProxyPool("http://a:1", "http://b:1", "http://c:1")
+	tests.AssertNoError(t, err)
+	pool.SetEjectPolicy(3, time.Minute)
+
+	var got []string
+	for range 4 {
+		u, err := pool.Proxy(newTestRequest(t))
+		tests.AssertNoError(t, err)
+		got = append(got, u.Hostname())
+	}
+	tests.AssertEqual(t, "a b c a", strings.Join(got, " "))
+
+	pool.SetStrategy(ProxyLeastFailures)
+	pool.ReportFailure(&url.URL{Scheme: "http", Host: "a:1"})
+	pool.ReportFailure(&url.URL{Scheme: "http", Host: "c:1"})
+	for range 3 {
+		u, err := pool.Proxy(newTestRequest(t))
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "b", u.Hostname())
+	}
+
+	pool.SetStrategy(ProxyRandom)
+	pool.Remove("http://a:1")
+	pool.Remove("http://b:1")
+	u, err := pool.Proxy(newTestRequest(t))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "c", u.Hostname())
+}
+
+func TestProxyPoolStickySession(t *testing.T) {
+	pool, err := NewProxyPool("http://a:1", "http://b:1")
+	tests.AssertNoError(t, err)
+	pool.SetStickyKey(StickyKeyByHeader("X-Session"), time.Minute)
+
+	request := func(session string) string {
+		r := newTestRequest(t)
+		r.Header.Set("X-Session", session)
+		u, err := pool.Proxy(r)
+		tests.AssertNoError(t, err)
+		return u.Hostname()
+	}
+	s1, s2 := request("1"), request("2")
+	if s1 == s2 {
+		t.Fatalf("sessions were assigned the same proxy %s", s1)
+	}
+	for range 3 {
+		tests.AssertEqual(t, s1, request("1"))
+		tests.AssertEqual(t, s2, request("2"))
+	}
+
+	// The session moves to another proxy when its proxy is ejected.
+	pool.ReportFailure(&url.URL{Scheme: "http", Host: s1 + ":1"})
+	tests.AssertEqual(t, s2, request("1"))
+}
+
+func TestProxyPoolHealthCheck(t *testing.T) {
+	pool, err := NewProxyPool("http://a:1", "http://b:1")
+	tests.AssertNoError(t, err)
+	// A zero interval falls back to the default one.
+	pool.EnableHealthCheck(0, func(ctx context.Context, proxyURL *url.URL) error {
+		if proxyURL.Hostname() == "a" {
+			return errors.New("down")
+		}
+		return nil
+	})
+	defer pool.Close()
+	for deadline := time.Now().Add(5 * time.Second); pool.Stats()[0].Healthy; {
+		if time.Now().After(deadline) {
+			t.Fatal("health check did not run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for range 3 {
+		u, err := pool.Proxy(newTestRequest(t))
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "b", u.Hostname())
+	}
+}
@@ -0,0 +1,76 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/imroc/req/v3/internal/socks"
+)
+
+// SOCKSReplyError is the error returned when a SOCKS proxy replies to a
+// command with a failure code, use errors.As to inspect it in a retry
+// condition, its Temporary method reports whether retrying may succeed:
+//
+//	client.SetCommonRetryCondition(func(resp *req.Response, err error) bool {
+//		var e *req.SOCKSReplyError
+//		return errors.As(err, &e) && e.Temporary()
+//	})
+type SOCKSReplyError = socks.ReplyError
+
+// SOCKS reply errors, which can be matched with errors.Is.
+var (
+	ErrSOCKSGeneralFailure       = socks.ErrGeneralFailure
+	ErrSOCKSNotAllowed           = socks.ErrNotAllowed
+	ErrSOCKSNetworkUnreachable   = socks.ErrNetworkUnreachable
+	ErrSOCKSHostUnreachable      = socks.ErrHostUnreachable
+	ErrSOCKSConnectionRefused    = socks.ErrConnectionRefused
+	ErrSOCKSTTLExpired           = socks.ErrTTLExpired
+	ErrSOCKSCommandNotSupported  = socks.ErrCommandNotSupported
+	ErrSOCKSAddrTypeNotSupported = socks.ErrAddrTypeNotSupported
+	ErrSOCKS4Rejected            = socks.Err4Rejected
+	ErrSOCKS4IdentdFailed        = socks.Err4IdentdFailed
+	ErrSOCKS4IdentdMismatch      = socks.Err4IdentdMismatch
+)
+
+// socks5Dialer returns a SOCKS5 dialer for the proxy, which connects to
+// it with the Transport's dial function.
+func (t *Transport) socks5Dialer(proxyURL *url.URL) *socks.Dialer {
+	addr := canonicalAddr(proxyURL)
+	d := socks.NewDialer("tcp", addr)
+	d.ProxyDial = t.dial
+	if u := proxyURL.User; u != nil {
+		auth := &socks.UsernamePassword{
+			Username: u.Username(),
+		}
+		auth.Password, _ = u.Password()
+		d.AuthMethods = []socks.AuthMethod{
+			socks.AuthMethodNotRequired,
+			socks.AuthMethodUsernamePassword,
+		}
+		d.Authenticate = auth.Authenticate
+	}
+	return d
+}
+
+// socksPacketConn relays the datagrams of HTTP/3 connections through
+// SOCKS5 proxies with UDP ASSOCIATE, the domain names are resolved by the
+// proxy. Other proxies are not able to carry UDP, so HTTP/3 requests
+// through them fail rather than bypassing the proxy.
+func (t *Transport) socksPacketConn(ctx context.Context, proxyURL *url.URL) (pc net.PacketConn, err error) {
+	if proxyURL.Scheme != "socks5" && proxyURL.Scheme != "socks5h" {
+		return nil, fmt.Errorf("HTTP/3 can not be relayed through a %s proxy, only socks5 proxies support UDP", proxyURL.Scheme)
+	}
+	if t.OnProxyConnectDone != nil {
+		defer func() { t.OnProxyConnectDone(ctx, proxyURL, err) }()
+	}
+	if len(t.proxyChainHops(proxyURL)) > 0 {
+		return nil, errProxyChainUDP
+	}
+	c, err := t.socks5Dialer(proxyURL).ListenPacket(ctx, "udp")
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
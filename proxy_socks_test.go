@@ -0,0 +1,65 @@
+package req
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestHTTP3NonSocksProxy(t *testing.T) {
+	_, err := C().EnableForceHTTP3().SetProxyURL("http://127.0.0.1:1").R().Get("https://example.com")
+	if err == nil || !strings.Contains(err.Error(), "only socks5 proxies support UDP") {
+		t.Fatalf("err = %v; want the HTTP/3 proxy error", err)
+	}
+}
+
+// TestSocks5ReplyError verifies that a failure reply of a SOCKS5 proxy
+// surfaces as a SOCKSReplyError that retry conditions can inspect.
+func TestSocks5ReplyError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				b := make([]byte, 262)
+				if _, err := io.ReadFull(c, b[:2]); err != nil {
+					return
+				}
+				io.ReadFull(c, b[:b[1]])
+				c.Write([]byte{0x05, 0x00})
+				c.Read(b) // the CONNECT request
+				// host unreachable
+				c.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+			}()
+		}
+	}()
+
+	var retries int
+	_, err = C().SetProxyURL("socks5://" + ln.Addr().String()).
+		SetCommonRetryCount(1).
+		SetCommonRetryCondition(func(resp *Response, err error) bool {
+			var e *SOCKSReplyError
+			if errors.As(err, &e) && e.Temporary() {
+				retries++
+				return true
+			}
+			return false
+		}).
+		R().Get("http://example.com")
+	if !errors.Is(err, ErrSOCKSHostUnreachable) {
+		t.Fatalf("err = %v; want ErrSOCKSHostUnreachable", err)
+	}
+	if retries != 1 {
+		t.Errorf("retry condition matched %d times; want 1", retries)
+	}
+}
@@ -0,0 +1,418 @@
+package req
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	h2internal "github.com/imroc/req/v3/internal/http2"
+	"github.com/imroc/req/v3/internal/http3"
+	"github.com/imroc/req/v3/internal/transport"
+)
+
+// proxyTunnelPool holds the multiplexed proxy connections (HTTP/2 and
+// HTTP/3) over which CONNECT tunnels are opened as individual streams.
+type proxyTunnelPool struct {
+	mu  sync.Mutex
+	h2  map[string][]*h2internal.ClientConn // keyed by proxy URL
+	t3  *http3.Transport
+	opt *Transport
+
+	// h3Tunnels is the number of open tunnels over t3, whose connections
+	// are not closed by closeIdleConnections while it is positive.
+	h3Tunnels int
+}
+
+func (t *Transport) getProxyTunnelPool() *proxyTunnelPool {
+	t.proxyTunnelsMu.Lock()
+	defer t.proxyTunnelsMu.Unlock()
+	if t.proxyTunnels == nil {
+		t.proxyTunnels = &proxyTunnelPool{opt: t}
+	}
+	return t.proxyTunnels
+}
+
+// proxyTunnelOptions returns the options of a new connection to a proxy,
+// read when it is dialed so that the changes of the options of t apply
+// to the connections dialed afterwards.
+func (t *Transport) proxyTunnelOptions() *transport.Options {
+	// Proxy connections must not be dumped, and the tunnelled bytes
+	// must never be decompressed.
+	opts := t.Options
+	opts.Dump = nil
+	opts.DisableCompression = true
+	opts.TLSClientConfig = proxyTLSConfig(t.TLSClientConfig)
+	return &opts
+}
+
+// cachedHTTP2Conn returns an HTTP/2 connection to the proxy with a stream
+// reserved for a new tunnel, or nil if there is none. Connections that can
+// no longer take new streams are dropped from the pool, their existing
+// tunnels are unaffected.
+func (p *proxyTunnelPool) cachedHTTP2Conn(proxyURL *url.URL) *h2internal.ClientConn {
+	key := proxyURL.String()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := p.h2[key]
+	for len(conns) > 0 {
+		cc := conns[0]
+		if cc.ReserveNewRequest() {
+			p.h2[key] = conns
+			return cc
+		}
+		conns = conns[1:]
+	}
+	delete(p.h2, key)
+	return nil
+}
+
+// addHTTP2Conn registers conn, which has negotiated HTTP/2 with the proxy,
+// so that subsequent tunnels to the same proxy can share it.
+func (p *proxyTunnelPool) addHTTP2Conn(proxyURL *url.URL, conn net.Conn) (*h2internal.ClientConn, error) {
+	t2 := &h2internal.Transport{Options: p.opt.proxyTunnelOptions()}
+	cc, err := t2.NewClientConn(conn)
+	if err != nil {
+		return nil, err
+	}
+	key := proxyURL.String()
+	p.mu.Lock()
+	if p.h2 == nil {
+		p.h2 = make(map[string][]*h2internal.ClientConn)
+	}
+	p.h2[key] = append(p.h2[key], cc)
+	p.mu.Unlock()
+	return cc, nil
+}
+
+func (p *proxyTunnelPool) http3Transport() *http3.Transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.t3 == nil {
+		p.t3 = &http3.Transport{
+			GetOptions:         p.opt.proxyTunnelOptions,
+			DisableCompression: true,
+		}
+	}
+	return p.t3
+}
+
+// proxyTLSConfig returns the TLS configuration of the connections to the
+// proxies, derived from the one of the targets without their server name
+// and ECH configuration.
+func proxyTLSConfig(cfg *tls.Config) *tls.Config {
+	cfg = cloneTLSConfig(cfg)
+	cfg.ServerName = ""
+	cfg.EncryptedClientHelloConfigList = nil
+	cfg.NextProtos = nil
+	return cfg
+}
+
+// closeIdleConnections closes the proxy connections which carry no
+// tunnel, the closed HTTP/2 connections are dropped by cachedHTTP2Conn.
+func (p *proxyTunnelPool) closeIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conns := range p.h2 {
+		for _, cc := range conns {
+			cc.CloseIfIdle()
+		}
+	}
+	if p.t3 != nil && p.h3Tunnels == 0 {
+		p.t3.CloseIdleConnections()
+	}
+}
+
+// trackHTTP3Tunnel counts an open tunnel over the HTTP/3 connections, and
+// returns the function to call once it is closed.
+func (p *proxyTunnelPool) trackHTTP3Tunnel() func() {
+	p.mu.Lock()
+	p.h3Tunnels++
+	p.mu.Unlock()
+	return func() {
+		p.mu.Lock()
+		p.h3Tunnels--
+		p.mu.Unlock()
+	}
+}
+
+// proxyConnectHeader returns the headers to send in the CONNECT request
+// to the proxy of cm, honoring GetProxyConnectHeader, ProxyConnectHeader
+// and the proxy credentials.
+func (t *Transport) proxyConnectHeader(ctx context.Context, cm connectMethod) (http.Header, error) {
+	var hdr http.Header
+	if t.GetProxyConnectHeader != nil {
+		var err error
+		hdr, err = t.GetProxyConnectHeader(ctx, cm.proxyURL, cm.targetAddr)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		hdr = t.ProxyConnectHeader
+	}
+	if hdr == nil {
+		hdr = make(http.Header)
+	}
+	if pa := cm.proxyAuth(); pa != "" {
+		hdr = hdr.Clone()
+		hdr.Set("Proxy-Authorization", pa)
+	}
+	return hdr, nil
+}
+
+// dialHTTP2ProxyTunnel opens a CONNECT tunnel to cm.targetAddr as a new
+// stream on the HTTP/2 proxy connection cc.
+func (t *Transport) dialHTTP2ProxyTunnel(ctx context.Context, cm connectMethod, cc *h2internal.ClientConn) (net.Conn, error) {
+	return t.dialStreamProxyTunnel(ctx, cm, cc.RoundTrip, &url.URL{Scheme: "https", Host: canonicalAddr(cm.proxyURL)})
+}
+
+// dialHTTP3ProxyTunnel opens a CONNECT tunnel to cm.targetAddr as a new
+// stream on an HTTP/3 connection to the proxy, which is dialed if needed.
+func (t *Transport) dialHTTP3ProxyTunnel(ctx context.Context, cm connectMethod) (net.Conn, error) {
+	p := t.getProxyTunnelPool()
+	closed := p.trackHTTP3Tunnel()
+	conn, err := t.dialStreamProxyTunnel(ctx, cm, p.http3Transport().RoundTrip, &url.URL{Scheme: "https", Host: canonicalAddr(cm.proxyURL)})
+	if err != nil {
+		closed()
+		return nil, err
+	}
+	conn.(*proxyTunnelConn).onClose = closed
+	return conn, nil
+}
+
+func (t *Transport) dialStreamProxyTunnel(ctx context.Context, cm connectMethod, roundTrip func(*http.Request) (*http.Response, error), proxyAddr *url.URL) (_ net.Conn, err error) {
+	start := time.Now()
+	defer func() { traceProxyHop(ctx, cm.proxyURL, cm.targetAddr, start, err) }()
+	// The stream outlives the dial, so it must not be bound to the
+	// cancellation of the dial context.
+	streamCtx, cancelStream := context.WithCancel(context.WithoutCancel(ctx))
+	pr, pw := io.Pipe()
+	connectReq := (&http.Request{
+		Method:        "CONNECT",
+		URL:           proxyAddr,
+		Host:          cm.targetAddr,
+		Body:          pr,
+		ContentLength: -1,
+	}).WithContext(streamCtx)
+	resp, err := t.roundTripConnect(ctx, cm, connectReq, roundTrip, func() {
+		cancelStream()
+		pw.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &proxyTunnelConn{
+		r:             resp.Body,
+		w:             pw,
+		cancel:        cancelStream,
+		target:        cm.targetAddr,
+		proxy:         cm.proxyURL.Host,
+		reads:         make(chan tunnelRead),
+		closed:        make(chan struct{}),
+		readDeadline:  newTunnelDeadline(),
+		writeDeadline: newTunnelDeadline(),
+	}, nil
+}
+
+// proxyTunnelConn is a net.Conn backed by a CONNECT stream of a
+// multiplexed (HTTP/2 or HTTP/3) proxy connection.
+type proxyTunnelConn struct {
+	r         io.ReadCloser
+	w         *io.PipeWriter
+	cancel    context.CancelFunc
+	target    string
+	proxy     string
+	onClose   func()
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	// The stream is read by a goroutine, so that Read can return at the
+	// read deadline without losing data.
+	readOnce     sync.Once
+	reads        chan tunnelRead
+	readMu       sync.Mutex
+	unread       []byte
+	readErr      error
+	readDeadline *tunnelDeadline
+
+	writeDeadline *tunnelDeadline
+}
+
+type tunnelRead struct {
+	b   []byte
+	err error
+}
+
+func (c *proxyTunnelConn) readLoop() {
+	for {
+		buf := make([]byte, 32<<10)
+		n, err := c.r.Read(buf)
+		select {
+		case c.reads <- tunnelRead{buf[:n], err}:
+		case <-c.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *proxyTunnelConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.readOnce.Do(func() { go c.readLoop() })
+	for len(c.unread) == 0 && c.readErr == nil {
+		select {
+		case r := <-c.reads:
+			c.unread, c.readErr = r.b, r.err
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-c.closed:
+			return 0, net.ErrClosed
+		}
+	}
+	if len(c.unread) > 0 {
+		n := copy(p, c.unread)
+		c.unread = c.unread[n:]
+		return n, nil
+	}
+	return 0, c.readErr
+}
+
+// Write writes to the stream. Like for a TLS connection, a write which
+// times out breaks the connection, since the stream cannot be resumed
+// after a partial write.
+func (c *proxyTunnelConn) Write(p []byte) (int, error) {
+	expired := c.writeDeadline.wait()
+	select {
+	case <-expired:
+		c.w.CloseWithError(os.ErrDeadlineExceeded)
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-expired:
+			c.w.CloseWithError(os.ErrDeadlineExceeded)
+		case <-done:
+		}
+	}()
+	n, err := c.w.Write(p)
+	if err != nil {
+		select {
+		case <-expired:
+			err = os.ErrDeadlineExceeded
+		default:
+		}
+	}
+	return n, err
+}
+
+func (c *proxyTunnelConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.w.Close()
+		c.r.Close()
+		c.cancel()
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return nil
+}
+
+func (c *proxyTunnelConn) LocalAddr() net.Addr {
+	return tunnelAddr(c.proxy)
+}
+
+func (c *proxyTunnelConn) RemoteAddr() net.Addr {
+	return tunnelAddr(c.target)
+}
+
+func (c *proxyTunnelConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *proxyTunnelConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *proxyTunnelConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// tunnelDeadline is a deadline of a proxyTunnelConn, like the deadlines
+// of net.Pipe.
+type tunnelDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed once the deadline is exceeded
+}
+
+func newTunnelDeadline() *tunnelDeadline {
+	return &tunnelDeadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline, the zero value means no deadline.
+func (d *tunnelDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel which is closed once the deadline is exceeded.
+func (d *tunnelDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "tunnel" }
+func (a tunnelAddr) String() string  { return string(a) }
@@ -0,0 +1,266 @@
+package req
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// relayConnect relays the CONNECT stream of r to its target.
+func relayConnect(w http.ResponseWriter, r *http.Request) {
+	backend, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer backend.Close()
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	go func() {
+		io.Copy(backend, r.Body)
+		backend.(*net.TCPConn).CloseWrite()
+	}()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := backend.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			w.(http.Flusher).Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// startHTTP2ConnectProxy starts a TLS proxy speaking HTTP/2 which relays
+// CONNECT streams to their targets, and returns it along with the number
+// of TCP connections it has accepted.
+func startHTTP2ConnectProxy(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var conns atomic.Int32
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.ProtoMajor != 2 {
+			http.Error(w, "only HTTP/2 is supported", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Header().Set("X-Proxy-Auth", r.Header.Get("Proxy-Authorization"))
+		w.Header().Set("X-Connect-Header", r.Header.Get("X-Connect-Header"))
+		relayConnect(w, r)
+	}))
+	proxy.EnableHTTP2 = true
+	proxy.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	proxy.StartTLS()
+	return proxy, &conns
+}
+
+func TestHTTP2ProxyMultiplexesTunnels(t *testing.T) {
+	proxy, proxyConns := startHTTP2ConnectProxy(t)
+	defer proxy.Close()
+
+	newBackend := func(body string) *httptest.Server {
+		s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		s.EnableHTTP2 = true
+		s.StartTLS()
+		return s
+	}
+	backend1 := newBackend("backend1")
+	defer backend1.Close()
+	backend2 := newBackend("backend2")
+	defer backend2.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	var mu sync.Mutex
+	var connectResponses []*http.Response
+	client := C().
+		EnableInsecureSkipVerify().
+		EnableHTTP2Proxy().
+		SetProxy(http.ProxyURL(proxyURL))
+	client.GetTransport().
+		SetGetProxyConnectHeader(func(ctx context.Context, proxyURL *url.URL, target string) (http.Header, error) {
+			return http.Header{"X-Connect-Header": []string{target}}, nil
+		}).
+		OnProxyConnectResponse = func(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+		mu.Lock()
+		connectResponses = append(connectResponses, connectRes)
+		mu.Unlock()
+		return nil
+	}
+
+	for _, backend := range []*httptest.Server{backend1, backend2, backend1} {
+		resp, err := client.R().Get(backend.URL)
+		if err != nil {
+			t.Fatalf("request via http2 proxy failed: %v", err)
+		}
+		want := "backend1"
+		if backend == backend2 {
+			want = "backend2"
+		}
+		if resp.String() != want {
+			t.Fatalf("body = %q; want %q", resp.String(), want)
+		}
+	}
+
+	if n := proxyConns.Load(); n != 1 {
+		t.Errorf("proxy accepted %d connections; want 1", n)
+	}
+	client.CloseIdleConnections()
+	resp, err := client.R().Get(backend1.URL)
+	assertSuccess(t, resp, err)
+	if n := proxyConns.Load(); n != 2 {
+		t.Errorf("proxy accepted %d connections after CloseIdleConnections; want 2", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(connectResponses) != 3 {
+		t.Fatalf("OnProxyConnectResponse called %d times; want 3", len(connectResponses))
+	}
+	for _, res := range connectResponses {
+		if res.ProtoMajor != 2 {
+			t.Errorf("CONNECT response proto = %s; want HTTP/2.0", res.Proto)
+		}
+		if got := res.Header.Get("X-Proxy-Auth"); got != "Basic "+basicAuth("user", "pass") {
+			t.Errorf("Proxy-Authorization = %q", got)
+		}
+		if got := res.Header.Get("X-Connect-Header"); got == "" {
+			t.Error("GetProxyConnectHeader headers were not sent")
+		}
+	}
+}
+
+func TestHTTP2ProxyConnectRejected(t *testing.T) {
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	proxy.EnableHTTP2 = true
+	proxy.StartTLS()
+	defer proxy.Close()
+
+	client := C().
+		EnableInsecureSkipVerify().
+		EnableHTTP2Proxy().
+		SetProxyURL(proxy.URL)
+	_, err := client.R().Get("https://example.com")
+	tests.AssertErrorContains(t, err, "Forbidden")
+}
+
+func TestHTTP3Proxy(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proxyConns atomic.Int32
+	var serverNames sync.Map
+	proxy := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				serverNames.Store(hello.ServerName, true)
+				return nil, nil
+			},
+		}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodConnect {
+				http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+				return
+			}
+			relayConnect(w, r)
+		}),
+		ConnContext: func(ctx context.Context, c *quic.Conn) context.Context {
+			proxyConns.Add(1)
+			return ctx
+		},
+	}
+	go proxy.Serve(pc)
+	defer proxy.Close()
+
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	defer backend.Close()
+
+	client := C().EnableInsecureSkipVerify().
+		SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true, ServerName: "backend.example.com"}).
+		SetProxyURL("quic://" + pc.LocalAddr().String())
+	for range 2 {
+		resp, err := client.R().Get(backend.URL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "HTTP/1.1", resp.String())
+	}
+	tests.AssertEqual(t, int32(1), proxyConns.Load())
+	// The server name of the target is not sent to the proxy.
+	_, ok := serverNames.Load("backend.example.com")
+	tests.AssertEqual(t, false, ok)
+
+	client.CloseIdleConnections()
+	resp, err := client.R().Get(backend.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, int32(2), proxyConns.Load())
+
+	// The TLS configuration is read when the proxy connection is dialed.
+	client.SetTLSClientConfig(&tls.Config{})
+	client.CloseIdleConnections()
+	_, err = client.R().Get(backend.URL)
+	tests.AssertErrorContains(t, err, "proxyconnect")
+}
+
+func TestProxyTunnelConnDeadline(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	_, w := io.Pipe()
+	c := &proxyTunnelConn{
+		r:             pr,
+		w:             w,
+		cancel:        func() {},
+		reads:         make(chan tunnelRead),
+		closed:        make(chan struct{}),
+		readDeadline:  newTunnelDeadline(),
+		writeDeadline: newTunnelDeadline(),
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	buf := make([]byte, 5)
+	_, err := c.Read(buf)
+	tests.AssertEqual(t, true, errors.Is(err, os.ErrDeadlineExceeded))
+	// The connection can still be read after the deadline is extended.
+	c.SetReadDeadline(time.Time{})
+	go pw.Write([]byte("hello"))
+	n, err := c.Read(buf)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "hello", string(buf[:n]))
+
+	c.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = c.Write([]byte("hello")) // never read
+	tests.AssertEqual(t, true, errors.Is(err, os.ErrDeadlineExceeded))
+}
@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"unsafe"
 
@@ -47,6 +48,20 @@ func createTestServer() *httptest.Server {
 
 func handleHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Method", r.Method)
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/har/"):
+		handleHAR(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/curl"):
+		handleCurlEcho(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/cassette/"):
+		handleCassette(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/pagination/"):
+		handlePagination(w, r)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet, http.MethodHead:
 		handleGet(w, r)
@@ -164,6 +179,119 @@ func handlePost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleHAR serves the requests recorded by the HAR tests.
+func handleHAR(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/har/redirect":
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		http.Redirect(w, r, "/har/final?x=1&y=a+b", http.StatusFound)
+	case "/har/form":
+		r.ParseForm()
+		w.Write([]byte(r.PostForm.Get("name")))
+	case "/har/binary":
+		w.Header().Set(header.ContentType, "application/octet-stream")
+		w.Write([]byte{0xff, 0xfe, 0x00})
+	default:
+		w.Header().Set(header.ContentType, "text/plain")
+		w.Write([]byte("hello world"))
+	}
+}
+
+// handleCurlEcho responds with the method, the URL, the headers and the
+// body of the requests as JSON, see curlEcho.
+func handleCurlEcho(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	json.NewEncoder(w).Encode(map[string]any{
+		"method": r.Method,
+		"url":    r.URL.String(),
+		"header": r.Header,
+		"body":   string(body),
+	})
+}
+
+// cassetteHits counts the requests of the cassette tests which reached the
+// test server, rather than being replayed.
+var cassetteHits atomic.Int32
+
+// handleCassette serves the requests recorded by the cassette tests, the
+// responses include the number of the request.
+func handleCassette(w http.ResponseWriter, r *http.Request) {
+	n := cassetteHits.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("X-Hit", strconv.Itoa(int(n)))
+	switch r.URL.Path {
+	case "/cassette/binary":
+		w.Write([]byte{0xff, 0x00})
+	case "/cassette/login":
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+	default:
+		w.Write([]byte(r.Method + " " + string(body) + " " + strconv.Itoa(int(n))))
+	}
+}
+
+// paginationRequests counts the requests of the pagination tests.
+var paginationRequests atomic.Int32
+
+// handlePagination serves the items 1 to 5, 2 per page, with the
+// pagination styles of the Pagers.
+func handlePagination(w http.ResponseWriter, r *http.Request) {
+	n := paginationRequests.Add(1)
+	items := []int{1, 2, 3, 4, 5}
+	writeJSON := func(v any) {
+		w.Header().Set(header.ContentType, header.JsonContentType)
+		json.NewEncoder(w).Encode(v)
+	}
+	if r.Header.Get("X-Token") != "abc" {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(&ErrorMessage{ErrorMessage: "unauthorized"})
+		return
+	}
+	seen := make(map[string]bool)
+	for _, cookie := range r.Cookies() {
+		if seen[cookie.Name] {
+			http.Error(w, "duplicate cookie "+cookie.Name, http.StatusBadRequest)
+			return
+		}
+		seen[cookie.Name] = true
+	}
+	q := r.URL.Query()
+	for name, values := range q {
+		if len(values) > 1 {
+			http.Error(w, "duplicate query parameter "+name, http.StatusBadRequest)
+			return
+		}
+	}
+	switch r.URL.Path {
+	case "/pagination/link":
+		page, _ := strconv.Atoi(q.Get("page"))
+		page = max(page, 1)
+		if page < 3 {
+			w.Header().Add("Link", fmt.Sprintf(`</pagination/link?page=%d&per_page=2>; rel="next", </pagination/link?page=3&per_page=2>; rel="last"`, page+1))
+		}
+		writeJSON(items[(page-1)*2 : min(page*2, len(items))])
+	case "/pagination/cursor":
+		cursor, _ := strconv.Atoi(q.Get("cursor"))
+		var next any
+		if cursor < 4 {
+			next = strconv.Itoa(cursor + 2)
+		}
+		writeJSON(map[string]any{
+			"data": map[string]any{"items": items[cursor:min(cursor+2, len(items))]},
+			"meta": map[string]any{"next": next},
+		})
+	case "/pagination/page":
+		page, _ := strconv.Atoi(q.Get("page"))
+		if page == 2 && n == 2 { // fails once
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(items[min((page-1)*2, len(items)):min(page*2, len(items))])
+	case "/pagination/offset":
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		writeJSON(items[min(offset, len(items)):min(offset+2, len(items))])
+	}
+}
+
 func handleGetUserProfile(w http.ResponseWriter, r *http.Request) {
 	user := strings.TrimLeft(r.URL.Path, "/user")
 	user = strings.TrimSuffix(user, "/profile")
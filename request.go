@@ -69,6 +69,7 @@ type Request struct {
 	outputFile         string
 	output             io.Writer
 	trace              *clientTrace
+	metricsTrace       *clientTrace // trace of the attempt for the Metrics if trace is disabled
 	dumpBuffer         *bytes.Buffer
 	responseReturnTime time.Time
 	afterResponse      []ResponseMiddleware
@@ -92,67 +93,11 @@ func (r *Request) TraceInfo() TraceInfo {
 		return TraceInfo{}
 	}
 
-	ti := TraceInfo{
-		IsConnReused:  ct.gotConnInfo.Reused,
-		IsConnWasIdle: ct.gotConnInfo.WasIdle,
-		ConnIdleTime:  ct.gotConnInfo.IdleTime,
-	}
-
 	endTime := ct.endTime
 	if endTime.IsZero() { // in case timeout
 		endTime = r.responseReturnTime
 	}
-
-	if !ct.tlsHandshakeStart.IsZero() {
-		if !ct.tlsHandshakeDone.IsZero() {
-			ti.TLSHandshakeTime = ct.tlsHandshakeDone.Sub(ct.tlsHandshakeStart)
-		} else {
-			ti.TLSHandshakeTime = endTime.Sub(ct.tlsHandshakeStart)
-		}
-	}
-
-	if ct.gotConnInfo.Reused {
-		ti.TotalTime = endTime.Sub(ct.getConn)
-	} else {
-		if ct.dnsStart.IsZero() {
-			ti.TotalTime = endTime.Sub(r.StartTime)
-		} else {
-			ti.TotalTime = endTime.Sub(ct.dnsStart)
-		}
-	}
-
-	dnsDone := ct.dnsDone
-	if dnsDone.IsZero() {
-		dnsDone = endTime
-	}
-
-	if !ct.dnsStart.IsZero() {
-		ti.DNSLookupTime = dnsDone.Sub(ct.dnsStart)
-	}
-
-	// Only calculate on successful connections
-	if !ct.connectDone.IsZero() {
-		ti.TCPConnectTime = ct.connectDone.Sub(dnsDone)
-	}
-
-	// Only calculate on successful connections
-	if !ct.gotConn.IsZero() {
-		ti.ConnectTime = ct.gotConn.Sub(ct.getConn)
-	}
-
-	// Only calculate on successful connections
-	if !ct.gotFirstResponseByte.IsZero() {
-		ti.FirstResponseTime = ct.gotFirstResponseByte.Sub(ct.gotConn)
-		ti.ResponseTime = endTime.Sub(ct.gotFirstResponseByte)
-	}
-
-	// Capture remote address info when connection is non-nil
-	if ct.gotConnInfo.Conn != nil {
-		ti.RemoteAddr = ct.gotConnInfo.Conn.RemoteAddr()
-		ti.LocalAddr = ct.gotConnInfo.Conn.LocalAddr()
-	}
-
-	return ti
+	return ct.info(r.StartTime, endTime)
 }
 
 // HeaderToString get all header as string.
@@ -758,11 +703,14 @@ retry:
 			}
 		}
 
+		r.metricsTrace = nil
+		start := time.Now()
 		if r.client.wrappedRoundTrip != nil {
 			resp, err = r.client.wrappedRoundTrip.RoundTrip(r)
 		} else {
 			resp, err = r.client.roundTrip(r)
 		}
+		r.observeMetrics(start, resp, err)
 
 		// Determine if the error is from a canceled context.
 		// Store it here so it doesn't get lost when processing the AfterResponse middleware.
@@ -2,11 +2,13 @@ package req
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strconv"
@@ -840,6 +842,33 @@ func TestTraceInfo(t *testing.T) {
 	testWithAllTransport(t, testTraceInfo)
 }
 
+func TestTraceInfoTLS(t *testing.T) {
+	for _, c := range []*Client{tc(), tc().ImpersonateChrome()} {
+		c.EnableTraceAll()
+		resp, err := c.R().Get("/")
+		assertSuccess(t, resp, err)
+		info := resp.TraceInfo().TLS
+		tests.AssertNotNil(t, info)
+		tests.AssertEqual(t, uint16(tls.VersionTLS13), info.Version)
+		tests.AssertEqual(t, "h2", info.NegotiatedProtocol)
+		tests.AssertEqual(t, 1, len(info.PeerCertificates))
+		tests.AssertEqual(t, CertificatePin(testServer.Certificate()), info.PeerCertificates[0].Pin)
+		tests.AssertContains(t, resp.TraceInfo().String(), "tlsversion        : tls 1.3", true)
+
+		// The details of reused connections come from the response.
+		resp, err = c.R().Get("/")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, true, resp.TraceInfo().IsConnReused)
+		tests.AssertEqual(t, "h2", resp.TraceInfo().TLS.NegotiatedProtocol)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	resp, err := C().EnableTraceAll().R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertIsNil(t, resp.TraceInfo().TLS)
+}
+
 func testTraceInfo(t *testing.T, c *Client) {
 	// enable trace at client level
 	c.EnableTraceAll()
@@ -1142,3 +1171,28 @@ func TestRestoreResponseBody(t *testing.T) {
 	tests.AssertNoError(t, err)
 	tests.AssertEqual(t, true, len(body) > 0)
 }
+
+func TestTraceInfoTLSViaHTTPSProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	}))
+	defer backend.Close()
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	// The handshake with the proxy is not the one of the target.
+	resp, err := C().EnableInsecureSkipVerify().EnableTraceAll().SetProxyURL(proxy.URL).R().Get(backend.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "plain", resp.String())
+	tests.AssertIsNil(t, resp.TraceInfo().TLS)
+}
@@ -0,0 +1,416 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver resolves host names to IP addresses, network is "ip", "ip4" or
+// "ip6". *net.Resolver implements it, see also NewDoHResolver,
+// NewDoTResolver and NewCachingResolver.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// ttlResolver is implemented by the resolvers which know the TTL of the
+// records, which NewCachingResolver honors.
+type ttlResolver interface {
+	lookupNetIPTTL(ctx context.Context, network, host string) ([]netip.Addr, time.Duration, error)
+}
+
+// IPPreference controls which IP addresses of a host are dialed first, see
+// Client.SetIPPreference.
+type IPPreference int
+
+const (
+	// IPPreferenceNone dials the addresses in the order of the resolver.
+	IPPreferenceNone IPPreference = iota
+	// PreferIPv4 dials the IPv4 addresses first.
+	PreferIPv4
+	// PreferIPv6 dials the IPv6 addresses first.
+	PreferIPv6
+	// IPv4Only only resolves and dials IPv4 addresses.
+	IPv4Only
+	// IPv6Only only resolves and dials IPv6 addresses.
+	IPv6Only
+)
+
+// network returns the network to resolve with the preference.
+func (p IPPreference) network() string {
+	switch p {
+	case IPv4Only:
+		return "ip4"
+	case IPv6Only:
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// sort filters and orders addrs with the preference.
+func (p IPPreference) sort(addrs []netip.Addr) []netip.Addr {
+	switch p {
+	case IPv4Only, IPv6Only:
+		return slices.DeleteFunc(addrs, func(a netip.Addr) bool { return a.Unmap().Is4() != (p == IPv4Only) })
+	case PreferIPv4, PreferIPv6:
+		slices.SortStableFunc(addrs, func(a, b netip.Addr) int {
+			a4, b4 := a.Unmap().Is4(), b.Unmap().Is4()
+			switch {
+			case a4 == b4:
+				return 0
+			case a4 == (p == PreferIPv4):
+				return -1
+			default:
+				return 1
+			}
+		})
+	}
+	return addrs
+}
+
+// SetResolver set the resolver of the host names dialed for HTTP/1, HTTP/2
+// and HTTP/3, see Client.SetResolver.
+func (t *Transport) SetResolver(r Resolver) *Transport {
+	t.resolver = r
+	t.useResolver()
+	return t
+}
+
+// SetIPPreference set which IP addresses of a host are dialed first, or
+// only, see Client.SetIPPreference.
+func (t *Transport) SetIPPreference(p IPPreference) *Transport {
+	t.ipPreference = p
+	t.useResolver()
+	return t
+}
+
+// setResolveOverride set the addresses of host, see
+// Client.SetResolveOverride.
+func (t *Transport) setResolveOverride(host string, addrs ...string) error {
+	host = hostsMapKey(host)
+	if len(addrs) == 0 {
+		delete(t.resolveOverrides, host)
+		return nil
+	}
+	ips := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		ip, err := netip.ParseAddr(strings.Trim(addr, "[]"))
+		if err != nil {
+			return fmt.Errorf("invalid IP address %q for host %q", addr, host)
+		}
+		ips = append(ips, ip)
+	}
+	if t.resolveOverrides == nil {
+		t.resolveOverrides = make(map[string][]netip.Addr)
+	}
+	t.resolveOverrides[host] = ips
+	t.useResolver()
+	return nil
+}
+
+// useResolver installs the dialer which resolves host names with
+// lookupNetIP, the dialer of SetDial dials the resolved addresses. The
+// dialer of Client.SetHosts, which resolves the host names itself, is
+// replaced.
+func (t *Transport) useResolver() {
+	if t.resolverDial {
+		return
+	}
+	if t.rejectProxyWithSetHosts {
+		t.innerDial = nil
+		t.rejectProxyWithSetHosts = false
+	} else {
+		t.innerDial = t.DialContext
+	}
+	t.DialContext = t.dialResolved
+	t.resolverDial = true
+}
+
+// resolverEnabled reports whether the host names are resolved with
+// lookupNetIP rather than by net.Dialer.
+func (t *Transport) resolverEnabled() bool {
+	return t.resolver != nil || t.ipPreference != IPPreferenceNone || len(t.resolveOverrides) > 0
+}
+
+// lookupNetIP resolves host with the overrides, the resolver and the IP
+// preference of the transport.
+func (t *Transport) lookupNetIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{ip}, nil
+	}
+	if addrs, ok := t.resolveOverrides[hostsMapKey(host)]; ok {
+		addrs = t.ipPreference.sort(slices.Clone(addrs))
+		if len(addrs) == 0 {
+			return nil, &net.DNSError{Err: "no suitable address", Name: host, IsNotFound: true}
+		}
+		return addrs, nil
+	}
+
+	r := t.resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	// *net.Resolver reports to the trace itself.
+	trace := httptrace.ContextClientTrace(ctx)
+	_, isNetResolver := r.(*net.Resolver)
+	if trace != nil && !isNetResolver && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	addrs, err := r.LookupNetIP(ctx, t.ipPreference.network(), host)
+	if err == nil {
+		addrs = t.ipPreference.sort(addrs)
+		if len(addrs) == 0 {
+			err = &net.DNSError{Err: "no suitable address", Name: host, IsNotFound: true}
+		}
+	}
+	if trace != nil && !isNetResolver && trace.DNSDone != nil {
+		info := httptrace.DNSDoneInfo{Err: err}
+		for _, addr := range addrs {
+			info.Addrs = append(info.Addrs, net.IPAddr{IP: addr.AsSlice(), Zone: addr.Zone()})
+		}
+		trace.DNSDone(info)
+	}
+	return addrs, err
+}
+
+// lookupHTTP3 resolves host for HTTP/3, nil if resolverEnabled is false.
+func (t *Transport) lookupHTTP3(ctx context.Context, host string) ([]netip.Addr, error) {
+	if !t.resolverEnabled() {
+		return nil, nil
+	}
+	return t.lookupNetIP(ctx, host)
+}
+
+// happyEyeballsDelay is how long dialResolved waits for the connection to
+// the addresses of the first family before dialing the addresses of the
+// other family, like net.Dialer.
+const happyEyeballsDelay = 300 * time.Millisecond
+
+// dialResolved dials the addresses of the host of addr with the dialer of
+// SetDial, if any. Like net.Dialer, the IPv4 and IPv6 addresses are raced
+// (Happy Eyeballs, RFC 6555): the addresses of the family of the first
+// address are dialed in order, and the addresses of the other family start
+// being dialed after happyEyeballsDelay, or as soon as the first ones fail.
+func (t *Transport) dialResolved(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := t.lookupNetIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var primaries, fallbacks []netip.Addr
+	for _, ip := range addrs {
+		if ip.Unmap().Is4() == addrs[0].Unmap().Is4() {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	if len(fallbacks) == 0 {
+		return t.dialSerial(ctx, network, port, primaries)
+	}
+
+	returned := make(chan struct{})
+	defer close(returned)
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan dialResult) // unbuffered
+	startRacer := func(ctx context.Context, primary bool) {
+		ips := primaries
+		if !primary {
+			ips = fallbacks
+		}
+		conn, err := t.dialSerial(ctx, network, port, ips)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	primaryCtx, primaryCancel := context.WithCancel(ctx)
+	defer primaryCancel()
+	go startRacer(primaryCtx, true)
+	fallbackTimer := time.NewTimer(happyEyeballsDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr error
+	var done int
+	for {
+		select {
+		case <-fallbackTimer.C:
+			fallbackCtx, fallbackCancel := context.WithCancel(ctx)
+			defer fallbackCancel()
+			go startRacer(fallbackCtx, false)
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+			} else if primaryErr == nil {
+				primaryErr = res.err
+			}
+			if done++; done == 2 {
+				return nil, primaryErr
+			}
+			if res.primary && fallbackTimer.Stop() {
+				// The fallback addresses are dialed right away.
+				fallbackTimer.Reset(0)
+			}
+		}
+	}
+}
+
+// dialSerial dials the addresses in order until a connection succeeds, and
+// returns the first error otherwise.
+func (t *Transport) dialSerial(ctx context.Context, network, port string, addrs []netip.Addr) (net.Conn, error) {
+	var firstErr error
+	for i, ip := range addrs {
+		dialCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok && i < len(addrs)-1 {
+			// Leave time for the remaining addresses, like net.Dialer.
+			var cancel context.CancelFunc
+			dialCtx, cancel = context.WithDeadline(ctx, partialDeadline(deadline, len(addrs)-i))
+			defer cancel()
+		}
+		conn, err := t.dialAddr(dialCtx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// dialAddr dials a resolved address with the dialer of SetDial, if any.
+func (t *Transport) dialAddr(ctx context.Context, network, addr string) (net.Conn, error) {
+	if t.innerDial != nil {
+		conn, err := t.innerDial(ctx, network, addr)
+		if conn == nil && err == nil {
+			err = errors.New("req: the dial function returned (nil, nil)")
+		}
+		return conn, err
+	}
+	return zeroDialer.DialContext(ctx, network, addr)
+}
+
+// partialDeadline returns the deadline of one of the remaining dials
+// before deadline, with a minimum of 2 seconds.
+func partialDeadline(deadline time.Time, remaining int) time.Time {
+	timeout := time.Until(deadline) / time.Duration(remaining)
+	if timeout < 2*time.Second {
+		timeout = 2 * time.Second
+	}
+	if d := time.Now().Add(timeout); d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+const (
+	defaultResolverTTL = time.Minute
+	negativeTTL        = 30 * time.Second
+)
+
+type resolverCacheEntry struct {
+	addrs   []netip.Addr
+	err     error
+	expires time.Time
+}
+
+// CachingResolver caches the addresses resolved by another resolver, for
+// the TTL of the records if the resolver knows it, see NewCachingResolver.
+type CachingResolver struct {
+	r          Resolver
+	defaultTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]resolverCacheEntry
+}
+
+// NewCachingResolver returns a resolver which caches the addresses resolved
+// by r, for the TTL of the records with NewDoHResolver and NewDoTResolver,
+// or for defaultTTL with other resolvers, 1 minute if it is zero. Names
+// which do not exist are cached for 30 seconds at most.
+func NewCachingResolver(r Resolver, defaultTTL time.Duration) *CachingResolver {
+	if defaultTTL <= 0 {
+		defaultTTL = defaultResolverTTL
+	}
+	return &CachingResolver{
+		r:          r,
+		defaultTTL: defaultTTL,
+		entries:    make(map[string]resolverCacheEntry),
+	}
+}
+
+// LookupNetIP implements Resolver.
+func (c *CachingResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, _, err := c.lookupNetIPTTL(ctx, network, host)
+	return addrs, err
+}
+
+func (c *CachingResolver) lookupNetIPTTL(ctx context.Context, network, host string) ([]netip.Addr, time.Duration, error) {
+	key := network + "/" + strings.ToLower(host)
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return slices.Clone(e.addrs), e.expires.Sub(now), e.err
+	}
+
+	var addrs []netip.Addr
+	var err error
+	ttl := c.defaultTTL
+	if r, ok := c.r.(ttlResolver); ok {
+		addrs, ttl, err = r.lookupNetIPTTL(ctx, network, host)
+	} else {
+		addrs, err = c.r.LookupNetIP(ctx, network, host)
+	}
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return nil, 0, err
+		}
+		ttl = min(ttl, negativeTTL)
+	}
+	if ttl > 0 {
+		c.mu.Lock()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.entries[key] = resolverCacheEntry{addrs: slices.Clone(addrs), err: err, expires: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return addrs, ttl, err
+}
+
+// Flush removes all the cached addresses.
+func (c *CachingResolver) Flush() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.mu.Unlock()
+}
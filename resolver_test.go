@@ -0,0 +1,276 @@
+package req
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var testDNSRecords = map[string][]netip.Addr{
+	"app.test.": {netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::1")},
+}
+
+// testDNSAnswer answers query with testDNSRecords.
+func testDNSAnswer(query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	h.Response = true
+	addrs, ok := testDNSRecords[q.Name.String()]
+	if !ok {
+		h.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, h)
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, addr := range addrs {
+		switch {
+		case addr.Is4() && q.Type == dnsmessage.TypeA:
+			b.AResource(rh, dnsmessage.AResource{A: addr.As4()})
+		case addr.Is6() && q.Type == dnsmessage.TypeAAAA:
+			b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: addr.As16()})
+		}
+	}
+	msg, _ := b.Finish()
+	return msg
+}
+
+func newTestDoHServer(t *testing.T, queries *atomic.Int32) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(testDNSAnswer(query))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDoHResolver(t *testing.T) {
+	var queries atomic.Int32
+	srv := newTestDoHServer(t, &queries)
+	r := NewCachingResolver(NewDoHResolver(srv.URL+"/dns-query", C().EnableInsecureSkipVerify()), 0)
+
+	addrs, err := r.LookupNetIP(context.Background(), "ip", "app.test")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, testDNSRecords["app.test."], addrs)
+	tests.AssertEqual(t, int32(2), queries.Load())
+
+	_, ttl, err := r.lookupNetIPTTL(context.Background(), "ip", "APP.test")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, ttl > 0 && ttl.Seconds() <= 60)
+	tests.AssertEqual(t, int32(2), queries.Load())
+
+	addrs, err = r.LookupNetIP(context.Background(), "ip4", "app.test")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, testDNSRecords["app.test."][:1], addrs)
+	tests.AssertEqual(t, int32(3), queries.Load())
+
+	for range 2 {
+		_, err = r.LookupNetIP(context.Background(), "ip", "missing.test")
+		var dnsErr *net.DNSError
+		tests.AssertEqual(t, true, errors.As(err, &dnsErr) && dnsErr.IsNotFound)
+	}
+	tests.AssertEqual(t, int32(5), queries.Load())
+
+	r.Flush()
+	_, err = r.LookupNetIP(context.Background(), "ip", "app.test")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, int32(7), queries.Load())
+}
+
+func TestDoTResolver(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// Answer the pipelined queries in reverse order.
+				var answers [][]byte
+				for range 2 {
+					var l [2]byte
+					if _, err := io.ReadFull(conn, l[:]); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(l[:]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					answers = append([][]byte{testDNSAnswer(query)}, answers...)
+				}
+				for _, answer := range answers {
+					conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+					conn.Write(answer)
+				}
+			}()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(testcert.LocalhostCert)
+	r := NewDoTResolver(ln.Addr().String(), &tls.Config{RootCAs: roots})
+	addrs, err := r.LookupNetIP(context.Background(), "ip", "app.test")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, testDNSRecords["app.test."], addrs)
+
+	tests.AssertEqual(t, "dns.example.com:853", NewDoTResolver("dns.example.com", nil).addr)
+}
+
+func TestIPPreference(t *testing.T) {
+	addrs := func() []netip.Addr {
+		return []netip.Addr{netip.MustParseAddr("::1"), netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::2")}
+	}
+	tests.AssertEqual(t, addrs(), IPPreferenceNone.sort(addrs()))
+	tests.AssertEqual(t, "[127.0.0.1 ::1 ::2]", fmtAddrs(PreferIPv4.sort(addrs())))
+	tests.AssertEqual(t, "[::1 ::2 127.0.0.1]", fmtAddrs(PreferIPv6.sort(addrs())))
+	tests.AssertEqual(t, "[127.0.0.1]", fmtAddrs(IPv4Only.sort(addrs())))
+	tests.AssertEqual(t, "[::1 ::2]", fmtAddrs(IPv6Only.sort(addrs())))
+}
+
+func fmtAddrs(addrs []netip.Addr) string {
+	s := make([]string, len(addrs))
+	for i, addr := range addrs {
+		s[i] = addr.String()
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+func TestResolverWithSetDial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	// The IPv6 address never answers, the IPv4 address is dialed after
+	// the Happy Eyeballs delay.
+	var dialed atomic.Int32
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed.Add(1)
+		if strings.HasPrefix(addr, "[") {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	url := "http://resolved.example.com:" + port
+	for name, c := range map[string]*Client{
+		"dial first":     C().SetDial(dial).SetResolveOverride("resolved.example.com", "::2", "127.0.0.1"),
+		"resolver first": C().SetResolveOverride("resolved.example.com", "::2", "127.0.0.1").SetDial(dial),
+	} {
+		dialed.Store(0)
+		start := time.Now()
+		resp, err := c.SetTimeout(10 * time.Second).R().Get(url)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "ok", resp.String())
+		tests.AssertEqual(t, int32(2), dialed.Load())
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%s: the IPv4 address was dialed after %v", name, d)
+		}
+	}
+
+	// SetHosts replaces the resolver.
+	c := C().SetResolveOverride("resolved.example.com", "::2").SetHosts(map[string]string{"resolved.example.com": "127.0.0.1"})
+	resp, err := c.R().Get(url)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "ok", resp.String())
+}
+
+func TestSetResolverDoH(t *testing.T) {
+	var queries atomic.Int32
+	doh := newTestDoHServer(t, &queries)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	r := NewCachingResolver(NewDoHResolver(doh.URL, C().EnableInsecureSkipVerify()), 0)
+	c := C().EnableInsecureSkipVerify().EnableTraceAll().SetResolver(r).SetIPPreference(PreferIPv4)
+	resp, err := c.R().Get("https://app.test:" + port)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "app.test:"+port, resp.String())
+	tests.AssertEqual(t, true, resp.TraceInfo().DNSLookupTime > 0)
+
+	// The dialer is installed on the clones as well.
+	resp, err = c.Clone().DisableKeepAlives().R().Get("https://app.test:" + port)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "app.test:"+port, resp.String())
+	tests.AssertEqual(t, int32(2), queries.Load())
+
+	_, err = c.R().Get("https://missing.test:" + port)
+	tests.AssertErrorContains(t, err, "no such host")
+
+	// Overrides take precedence over the resolver.
+	resp, err = c.SetResolveOverride("missing.test", "127.0.0.1").R().Get("https://missing.test:" + port)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "missing.test:"+port, resp.String())
+
+	c = C().SetResolveOverride("example.com", "not an ip")
+	tests.AssertEqual(t, 0, len(c.resolveOverrides))
+}
+
+func TestSetResolveOverrideHTTP3(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+
+	c := C().EnableInsecureSkipVerify().EnableForceHTTP3().SetResolveOverride("h3.test", "127.0.0.1")
+	resp, err := c.R().Get("https://h3.test:" + port)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/3.0", resp.String())
+
+	// The next addresses are dialed if the first one does not answer.
+	c = C().EnableInsecureSkipVerify().EnableForceHTTP3().SetTimeout(4*time.Second).
+		SetResolveOverride("h3.test", "127.0.0.2", "127.0.0.1")
+	resp, err = c.R().Get("https://h3.test:" + port)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "HTTP/3.0", resp.String())
+}
@@ -193,7 +193,16 @@ func (r *Response) ErrorResult() any {
 
 // TraceInfo returns the TraceInfo from Request.
 func (r *Response) TraceInfo() TraceInfo {
-	return r.Request.TraceInfo()
+	ti := r.Request.TraceInfo()
+	// No handshake is traced on reused connections and with HTTP/3, the
+	// TLS state of plain HTTP responses is the one of an HTTPS proxy.
+	if ti.TLS == nil && r.Request.trace != nil && r.Response != nil && r.TLS != nil && r.Request.URL.Scheme == "https" {
+		ti.TLS = newTLSInfo(r.TLS)
+	}
+	if ti.TLS != nil {
+		ti.TLS.RevocationStatus = r.RevocationStatus()
+	}
+	return ti
 }
 
 // TotalTime returns the total time of the request, from request we sent to response we received.
@@ -0,0 +1,386 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+	"weak"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	// ErrCertificateRevoked is returned when the certificate of a server is
+	// revoked, see Client.EnableRevocationCheck.
+	ErrCertificateRevoked = errors.New("req: certificate revoked")
+	// ErrRevocationUnknown is returned in hard-fail mode when the revocation
+	// status of the certificate of a server cannot be determined.
+	ErrRevocationUnknown = errors.New("req: certificate revocation status unknown")
+)
+
+// maxRevocationResponseSize limits the size of fetched OCSP responses and CRLs.
+const maxRevocationResponseSize = 10 << 20
+
+// RevocationStatus is the revocation status of the certificate of a server.
+type RevocationStatus int
+
+const (
+	// RevocationNotChecked means that revocation checking is disabled, or
+	// that the connection does not use TLS.
+	RevocationNotChecked RevocationStatus = iota
+	// RevocationGood means that the certificate is not revoked.
+	RevocationGood
+	// RevocationRevoked means that the certificate is revoked.
+	RevocationRevoked
+	// RevocationUnknown means that the status could not be determined, e.g.
+	// the server did not staple an OCSP response and fetching is disabled.
+	RevocationUnknown
+)
+
+// String returns the name of the status.
+func (s RevocationStatus) String() string {
+	switch s {
+	case RevocationGood:
+		return "good"
+	case RevocationRevoked:
+		return "revoked"
+	case RevocationUnknown:
+		return "unknown"
+	default:
+		return "not checked"
+	}
+}
+
+// RevocationOptions controls the revocation checking of server
+// certificates, see Client.EnableRevocationCheck.
+type RevocationOptions struct {
+	// FetchOCSP fetches the OCSP response from the responder of the
+	// certificate when the server did not staple one.
+	FetchOCSP bool
+	// FetchCRL downloads the CRLs of the certificate when its status is
+	// still unknown after OCSP.
+	FetchCRL bool
+	// HardFail rejects certificates whose status cannot be determined,
+	// they are accepted by default (soft-fail).
+	HardFail bool
+	// Timeout limits each fetch, 10 seconds by default.
+	Timeout time.Duration
+	// CacheTTL is how long a status is cached when the OCSP response or CRL
+	// does not tell when it is updated next, 1 hour by default.
+	CacheTTL time.Duration
+}
+
+type revocationEntry struct {
+	status  RevocationStatus
+	expires time.Time
+}
+
+type crlEntry struct {
+	list    *x509.RevocationList
+	expires time.Time
+}
+
+// revocationFetchKey marks the contexts of the fetches of OCSP responses and
+// CRLs, the connections they open, e.g. to an https proxy, are not checked
+// so that the checker is not re-entered.
+type revocationFetchKeyType int
+
+const revocationFetchKey revocationFetchKeyType = iota
+
+// revocationChecker checks the leaf certificates of the TLS connections of a
+// Transport. OCSP responses and CRLs are fetched with the inner round trip
+// of the Transport, bypassing its HAR recorder, cassette, fault injector and
+// middlewares, only over plain HTTP.
+type revocationChecker struct {
+	opts      RevocationOptions
+	roundTrip func(*http.Request) (*http.Response, error)
+
+	mu       sync.Mutex
+	statuses map[[sha256.Size]byte]revocationEntry
+	crls     map[string]crlEntry
+	// conns holds the status each connection was checked with, by the
+	// leaf certificate of the connection, which is parsed for it.
+	conns map[weak.Pointer[x509.Certificate]]RevocationStatus
+}
+
+func newRevocationChecker(opts *RevocationOptions, roundTrip func(*http.Request) (*http.Response, error)) *revocationChecker {
+	rc := &revocationChecker{
+		roundTrip: roundTrip,
+		statuses:  make(map[[sha256.Size]byte]revocationEntry),
+		crls:      make(map[string]crlEntry),
+		conns:     make(map[weak.Pointer[x509.Certificate]]RevocationStatus),
+	}
+	if opts != nil {
+		rc.opts = *opts
+	}
+	if rc.opts.Timeout <= 0 {
+		rc.opts.Timeout = 10 * time.Second
+	}
+	if rc.opts.CacheTTL <= 0 {
+		rc.opts.CacheTTL = time.Hour
+	}
+	return rc
+}
+
+// status returns the status the connection with the leaf certificate was
+// checked with.
+func (rc *revocationChecker) status(leaf *x509.Certificate) RevocationStatus {
+	if rc == nil {
+		return RevocationNotChecked
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.conns[weak.Make(leaf)]
+}
+
+// record records the status of the connection with the leaf certificate,
+// until the certificate is garbage collected.
+func (rc *revocationChecker) record(leaf *x509.Certificate, status RevocationStatus) {
+	p := weak.Make(leaf)
+	rc.mu.Lock()
+	_, ok := rc.conns[p]
+	rc.conns[p] = status
+	rc.mu.Unlock()
+	if !ok {
+		runtime.AddCleanup(leaf, func(p weak.Pointer[x509.Certificate]) {
+			rc.mu.Lock()
+			delete(rc.conns, p)
+			rc.mu.Unlock()
+		}, p)
+	}
+}
+
+func (rc *revocationChecker) cached(cert *x509.Certificate, now time.Time) (RevocationStatus, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	e, ok := rc.statuses[sha256.Sum256(cert.Raw)]
+	if !ok || now.After(e.expires) {
+		return RevocationNotChecked, false
+	}
+	return e.status, true
+}
+
+func (rc *revocationChecker) store(cert *x509.Certificate, status RevocationStatus, expires time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	for k, e := range rc.statuses {
+		if now.After(e.expires) {
+			delete(rc.statuses, k)
+		}
+	}
+	rc.statuses[sha256.Sum256(cert.Raw)] = revocationEntry{status: status, expires: expires}
+}
+
+// expiry returns when a status based on a response updated next at
+// nextUpdate expires.
+func (rc *revocationChecker) expiry(nextUpdate time.Time) time.Time {
+	if nextUpdate.IsZero() {
+		return time.Now().Add(rc.opts.CacheTTL)
+	}
+	return nextUpdate
+}
+
+// verify checks the revocation status of the leaf certificate of the
+// connection to host, the fetches are canceled with ctx.
+func (rc *revocationChecker) verify(ctx context.Context, host string, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 || ctx.Value(revocationFetchKey) != nil {
+		return nil
+	}
+	leaf := cs.PeerCertificates[0]
+	status := rc.check(ctx, leaf, issuerOf(cs), cs.OCSPResponse)
+	rc.record(leaf, status)
+	switch {
+	case status == RevocationRevoked:
+		return fmt.Errorf("%w for %s", ErrCertificateRevoked, host)
+	case status == RevocationUnknown && rc.opts.HardFail:
+		return fmt.Errorf("%w for %s", ErrRevocationUnknown, host)
+	}
+	return nil
+}
+
+// issuerOf returns the issuer of the leaf certificate of cs, or nil if it
+// is not in the chain.
+func issuerOf(cs tls.ConnectionState) *x509.Certificate {
+	if len(cs.VerifiedChains) > 0 && len(cs.VerifiedChains[0]) > 1 {
+		return cs.VerifiedChains[0][1]
+	}
+	// Not verified, e.g. with InsecureSkipVerify.
+	if len(cs.PeerCertificates) > 1 && cs.PeerCertificates[0].CheckSignatureFrom(cs.PeerCertificates[1]) == nil {
+		return cs.PeerCertificates[1]
+	}
+	return nil
+}
+
+func (rc *revocationChecker) check(ctx context.Context, leaf, issuer *x509.Certificate, stapled []byte) RevocationStatus {
+	if issuer == nil {
+		rc.store(leaf, RevocationUnknown, time.Now().Add(rc.opts.CacheTTL))
+		return RevocationUnknown
+	}
+	if len(stapled) > 0 {
+		// An invalid staple is ignored, the status is looked up as if the
+		// server did not staple a response.
+		if resp, err := ocsp.ParseResponseForCert(stapled, leaf, issuer); err == nil && ocspFresh(resp) {
+			if status := ocspStatus(resp); status != RevocationUnknown {
+				rc.store(leaf, status, rc.expiry(resp.NextUpdate))
+				return status
+			}
+		}
+	}
+	if status, ok := rc.cached(leaf, time.Now()); ok {
+		return status
+	}
+
+	status, expires := RevocationUnknown, time.Now().Add(rc.opts.CacheTTL)
+	if rc.opts.FetchOCSP {
+		if resp := rc.fetchOCSP(ctx, leaf, issuer); resp != nil {
+			status, expires = ocspStatus(resp), rc.expiry(resp.NextUpdate)
+		}
+	}
+	if status == RevocationUnknown && rc.opts.FetchCRL {
+		if s, e, ok := rc.checkCRLs(ctx, leaf, issuer); ok {
+			status, expires = s, e
+		}
+	}
+	rc.store(leaf, status, expires)
+	return status
+}
+
+// ocspFresh reports whether resp is not outdated.
+func ocspFresh(resp *ocsp.Response) bool {
+	return resp.NextUpdate.IsZero() || time.Now().Before(resp.NextUpdate)
+}
+
+func ocspStatus(resp *ocsp.Response) RevocationStatus {
+	switch resp.Status {
+	case ocsp.Good:
+		return RevocationGood
+	case ocsp.Revoked:
+		return RevocationRevoked
+	default:
+		return RevocationUnknown
+	}
+}
+
+// fetch sends a request through the transport and returns the response
+// body. It is canceled with ctx, but does not inherit its values, such as
+// the client trace of the request.
+func (rc *revocationChecker) fetch(ctx context.Context, method, url, contentType string, body []byte) ([]byte, error) {
+	fetchCtx, cancel := context.WithTimeout(context.WithValue(context.Background(), revocationFetchKey, true), rc.opts.Timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	req, err := http.NewRequestWithContext(fetchCtx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported scheme %q", req.URL.Scheme)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := rc.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+}
+
+// fetchOCSP returns the response of the first OCSP responder of leaf which
+// answers, or nil.
+func (rc *revocationChecker) fetchOCSP(ctx context.Context, leaf, issuer *x509.Certificate) *ocsp.Response {
+	body, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil
+	}
+	for _, server := range leaf.OCSPServer {
+		data, err := rc.fetch(ctx, http.MethodPost, server, "application/ocsp-request", body)
+		if err != nil {
+			continue
+		}
+		if resp, err := ocsp.ParseResponseForCert(data, leaf, issuer); err == nil && ocspFresh(resp) {
+			return resp
+		}
+	}
+	return nil
+}
+
+// checkCRLs looks up leaf in its CRLs signed by issuer, ok is false if none
+// could be loaded.
+func (rc *revocationChecker) checkCRLs(ctx context.Context, leaf, issuer *x509.Certificate) (status RevocationStatus, expires time.Time, ok bool) {
+	for _, u := range leaf.CRLDistributionPoints {
+		list := rc.crl(ctx, u, issuer)
+		if list == nil {
+			continue
+		}
+		for _, entry := range list.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				return RevocationRevoked, rc.expiry(list.NextUpdate), true
+			}
+		}
+		return RevocationGood, rc.expiry(list.NextUpdate), true
+	}
+	return RevocationUnknown, time.Time{}, false
+}
+
+// crl returns the CRL at url signed by issuer, cached until its next update.
+func (rc *revocationChecker) crl(ctx context.Context, url string, issuer *x509.Certificate) *x509.RevocationList {
+	rc.mu.Lock()
+	e, ok := rc.crls[url]
+	rc.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.list
+	}
+
+	data, err := rc.fetch(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil || list.CheckSignatureFrom(issuer) != nil {
+		return nil
+	}
+	rc.mu.Lock()
+	rc.crls[url] = crlEntry{list: list, expires: rc.expiry(list.NextUpdate)}
+	rc.mu.Unlock()
+	return list
+}
+
+// EnableRevocationCheck enables the revocation checking of the certificates
+// of servers with specified options, see Client.EnableRevocationCheck.
+func (t *Transport) EnableRevocationCheck(opts *RevocationOptions) *Transport {
+	t.revocation = newRevocationChecker(opts, t.roundTrip)
+	return t
+}
+
+// DisableRevocationCheck disables the revocation checking of the
+// certificates of servers (disabled by default).
+func (t *Transport) DisableRevocationCheck() *Transport {
+	t.revocation = nil
+	return t
+}
+
+// RevocationStatus returns the revocation status the certificate of the
+// server was checked with when the connection of the response was made, see
+// Client.EnableRevocationCheck.
+func (r *Response) RevocationStatus() RevocationStatus {
+	if r.Response == nil || r.TLS == nil || len(r.TLS.PeerCertificates) == 0 ||
+		r.Request == nil || r.Request.client == nil {
+		return RevocationNotChecked
+	}
+	return r.Request.client.Transport.revocation.status(r.TLS.PeerCertificates[0])
+}
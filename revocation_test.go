@@ -0,0 +1,235 @@
+package req
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/internal/tests"
+	"golang.org/x/crypto/ocsp"
+)
+
+type revocationTestPKI struct {
+	ca      *x509.Certificate
+	caKey   crypto.Signer
+	caPEM   string
+	leaf    tls.Certificate
+	ocspHit atomic.Int32
+	crlHit  atomic.Int32
+	// ocspStatus is returned by the responder, -1 for an error.
+	ocspStatus atomic.Int32
+	revoked    atomic.Bool // the leaf is in the CRL
+}
+
+func newRevocationTestPKI(t *testing.T) *revocationTestPKI {
+	p := &revocationTestPKI{}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.AssertNoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "req test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	tests.AssertNoError(t, err)
+	p.ca, _ = x509.ParseCertificate(der)
+	p.caKey = caKey
+	p.caPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crl" {
+			p.crlHit.Add(1)
+			w.Write(p.crl(t))
+			return
+		}
+		p.ocspHit.Add(1)
+		status := int(p.ocspStatus.Load())
+		if status < 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(p.ocspResponse(t, status))
+	}))
+	t.Cleanup(responder.Close)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.AssertNoError(t, err)
+	leafTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:            []string{responder.URL},
+		CRLDistributionPoints: []string{responder.URL + "/crl"},
+	}
+	der, err = x509.CreateCertificate(rand.Reader, leafTmpl, p.ca, leafKey.Public(), caKey)
+	tests.AssertNoError(t, err)
+	leaf, _ := x509.ParseCertificate(der)
+	p.leaf = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: leafKey, Leaf: leaf}
+	return p
+}
+
+func (p *revocationTestPKI) ocspResponse(t *testing.T, status int) []byte {
+	resp, err := ocsp.CreateResponse(p.ca, p.ca, ocsp.Response{
+		Status:       status,
+		SerialNumber: p.leaf.Leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, p.caKey)
+	tests.AssertNoError(t, err)
+	return resp
+}
+
+func (p *revocationTestPKI) crl(t *testing.T) []byte {
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	if p.revoked.Load() {
+		tmpl.RevokedCertificateEntries = []x509.RevocationListEntry{{
+			SerialNumber:   p.leaf.Leaf.SerialNumber,
+			RevocationTime: time.Now().Add(-time.Minute),
+		}}
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, tmpl, p.ca, p.caKey)
+	tests.AssertNoError(t, err)
+	return crl
+}
+
+// server starts a TLS server with the leaf certificate and the OCSP
+// response staple, if any.
+func (p *revocationTestPKI) server(t *testing.T, staple []byte) *httptest.Server {
+	cert := p.leaf
+	cert.OCSPStaple = staple
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRevocationStapled(t *testing.T) {
+	p := newRevocationTestPKI(t)
+	good := p.server(t, p.ocspResponse(t, ocsp.Good))
+	revoked := p.server(t, p.ocspResponse(t, ocsp.Revoked))
+
+	for _, newClient := range []func() *Client{
+		func() *Client { return C() },
+		func() *Client { return C().ImpersonateChrome() },
+	} {
+		c := newClient().SetRootCertFromString(p.caPEM).EnableRevocationCheck(nil)
+		resp, err := c.R().Get(good.URL)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, RevocationGood, resp.RevocationStatus())
+
+		_, err = c.R().Get(revoked.URL)
+		tests.AssertEqual(t, true, errors.Is(err, ErrCertificateRevoked))
+	}
+	tests.AssertEqual(t, int32(0), p.ocspHit.Load())
+
+	resp, err := C().SetRootCertFromString(p.caPEM).R().Get(revoked.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, RevocationNotChecked, resp.RevocationStatus())
+}
+
+func TestRevocationFetch(t *testing.T) {
+	p := newRevocationTestPKI(t)
+	srv := p.server(t, nil)
+
+	// Soft-fail by default.
+	c := C().SetRootCertFromString(p.caPEM).EnableRevocationCheck(nil)
+	resp, err := c.R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, RevocationUnknown, resp.RevocationStatus())
+
+	c = C().SetRootCertFromString(p.caPEM).EnableRevocationCheck(&RevocationOptions{HardFail: true})
+	_, err = c.R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrRevocationUnknown))
+
+	p.ocspStatus.Store(int32(ocsp.Revoked))
+	c = C().SetRootCertFromString(p.caPEM).DisableKeepAlives().
+		EnableRevocationCheck(&RevocationOptions{FetchOCSP: true})
+	_, err = c.R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificateRevoked))
+	// The status is cached.
+	_, err = c.R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificateRevoked))
+	tests.AssertEqual(t, int32(1), p.ocspHit.Load())
+	// The fetches bypass the fault injector of the transport.
+	c = C().SetRootCertFromString(p.caPEM).DisableKeepAlives().
+		EnableRevocationCheck(&RevocationOptions{FetchOCSP: true}).
+		SetFaultInjector(NewFaultInjector(&FaultRule{
+			Probability: 1,
+			Match:       func(req *http.Request) bool { return req.URL.Scheme == "http" },
+			Reset:       true,
+		}))
+	_, err = c.R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificateRevoked))
+	tests.AssertEqual(t, int32(2), p.ocspHit.Load())
+
+	// The CRL is used when the responder fails.
+	p.ocspStatus.Store(-1)
+	c = C().SetRootCertFromString(p.caPEM).DisableKeepAlives().
+		EnableRevocationCheck(&RevocationOptions{FetchOCSP: true, FetchCRL: true, HardFail: true})
+	resp, err = c.R().EnableTrace().Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, RevocationGood, resp.RevocationStatus())
+	tests.AssertEqual(t, int32(1), p.crlHit.Load())
+	// The fetches are not traced as the request.
+	ti := resp.TraceInfo()
+	tests.AssertEqual(t, RevocationGood, ti.TLS.RevocationStatus)
+	tests.AssertEqual(t, srv.Listener.Addr().String(), ti.RemoteAddr.String())
+
+	p.revoked.Store(true)
+	c = c.Clone()
+	_, err = c.R().Get(srv.URL)
+	tests.AssertEqual(t, true, errors.Is(err, ErrCertificateRevoked))
+	tests.AssertEqual(t, int32(2), p.crlHit.Load())
+}
+
+func TestRevocationStatusPerConnection(t *testing.T) {
+	p := newRevocationTestPKI(t)
+	srv := p.server(t, p.ocspResponse(t, ocsp.Good))
+
+	c := C().SetRootCertFromString(p.caPEM).EnableRevocationCheck(nil)
+	resp, err := c.R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+	// The connection keeps the status it was checked with, whatever the
+	// checks of other connections.
+	c.revocation.store(p.leaf.Leaf, RevocationRevoked, time.Now().Add(time.Hour))
+	tests.AssertEqual(t, RevocationGood, resp.RevocationStatus())
+	resp, err = c.R().Get(srv.URL)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, RevocationGood, resp.RevocationStatus())
+
+	// The connections of the fetches do not check revocation again.
+	cs := *resp.TLS
+	cs.OCSPResponse = p.ocspResponse(t, ocsp.Revoked)
+	ctx := context.WithValue(context.Background(), revocationFetchKey, true)
+	tests.AssertNoError(t, c.revocation.verify(ctx, "127.0.0.1", cs))
+	tests.AssertEqual(t, true, errors.Is(c.revocation.verify(context.Background(), "127.0.0.1", cs), ErrCertificateRevoked))
+}
@@ -18,10 +18,19 @@ import (
 // Like the RoundTripper interface, the error types returned
 // by RoundTrip are unspecified.
 func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if t.harRecorder != nil {
+		var rec *harRecording
+		req, rec = t.harRecorder.start(req)
+		defer func() { rec.done(resp, err) }()
+	}
+	next := t.roundTripCassette
 	if t.wrappedRoundTrip != nil {
-		resp, err = t.wrappedRoundTrip.RoundTrip(req)
+		next = t.wrappedRoundTrip.RoundTrip
+	}
+	if t.faultInjector != nil {
+		resp, err = t.faultInjector.roundTrip(req, next)
 	} else {
-		resp, err = t.roundTrip(req)
+		resp, err = next(req)
 	}
 	if err != nil {
 		return
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net"
 	"net/http/httptrace"
+	"net/url"
+	"sync"
 	"time"
 )
 
@@ -25,6 +27,13 @@ ResponseTime      : %v
 IsConnReused:     : true
 RemoteAddr        : %v
 LocalAddr         : %v`
+	traceTLSFmt = `
+TLSVersion        : %s
+CipherSuite       : %s
+ALPN              : %s
+ServerName        : %s
+DidResume         : %v
+RevocationStatus  : %s`
 )
 
 // Blame return the human-readable reason of why request is slowing.
@@ -58,10 +67,20 @@ func (t TraceInfo) String() string {
 	if t.RemoteAddr == nil {
 		return "trace is not enabled"
 	}
+	var s string
 	if t.IsConnReused {
-		return fmt.Sprintf(traceReusedFmt, t.TotalTime, t.FirstResponseTime, t.ResponseTime, t.RemoteAddr, t.LocalAddr)
+		s = fmt.Sprintf(traceReusedFmt, t.TotalTime, t.FirstResponseTime, t.ResponseTime, t.RemoteAddr, t.LocalAddr)
+	} else {
+		s = fmt.Sprintf(traceFmt, t.TotalTime, t.DNSLookupTime, t.TCPConnectTime, t.TLSHandshakeTime, t.FirstResponseTime, t.ResponseTime, t.RemoteAddr, t.LocalAddr)
 	}
-	return fmt.Sprintf(traceFmt, t.TotalTime, t.DNSLookupTime, t.TCPConnectTime, t.TLSHandshakeTime, t.FirstResponseTime, t.ResponseTime, t.RemoteAddr, t.LocalAddr)
+	if t.TLS != nil {
+		s += fmt.Sprintf(traceTLSFmt, tls.VersionName(t.TLS.Version), tls.CipherSuiteName(t.TLS.CipherSuite),
+			t.TLS.NegotiatedProtocol, t.TLS.ServerName, t.TLS.DidResume, t.TLS.RevocationStatus)
+		for _, cert := range t.TLS.PeerCertificates {
+			s += "\nPeerCertificate   : " + cert.Subject
+		}
+	}
+	return s
 }
 
 // TraceInfo represents the trace information.
@@ -107,6 +126,98 @@ type TraceInfo struct {
 
 	// LocalAddr returns the local network address.
 	LocalAddr net.Addr
+
+	// ECHAccepted is whether the server accepted the Encrypted Client
+	// Hello of a new TLS connection (see Client.SetECHConfigList).
+	ECHAccepted bool
+
+	// TLS holds the details of the TLS connection, nil if the connection
+	// does not use TLS.
+	TLS *TLSInfo
+
+	// ProxyHops holds the timing of each proxy the connection went
+	// through, in order, if a new connection was made through a proxy
+	// (see Client.SetProxyChain).
+	ProxyHops []ProxyHopInfo
+}
+
+// ProxyHopInfo represents the trace information of a proxy hop.
+type ProxyHopInfo struct {
+	// Proxy is the proxy URL, without password.
+	Proxy string
+
+	// Target is the address the proxy was asked to connect to, the next
+	// proxy of the chain or the target host.
+	Target string
+
+	// ConnectTime is a duration that took to open the tunnel through the
+	// proxy, including the TLS handshake with "https" proxies which are
+	// not the first hop.
+	ConnectTime time.Duration
+
+	// Err is the error if the tunnel failed.
+	Err error
+}
+
+// TLSInfo represents the details of a TLS connection.
+type TLSInfo struct {
+	// Version is the TLS version, see tls.VersionName.
+	Version uint16
+
+	// CipherSuite is the cipher suite, see tls.CipherSuiteName.
+	CipherSuite uint16
+
+	// NegotiatedProtocol is the protocol negotiated with ALPN.
+	NegotiatedProtocol string
+
+	// ServerName is the server name sent with SNI, empty for IP addresses.
+	ServerName string
+
+	// DidResume is whether the connection resumed a previous session.
+	DidResume bool
+
+	// RevocationStatus is the revocation status the certificate of the
+	// server was checked with, see Client.EnableRevocationCheck.
+	RevocationStatus RevocationStatus
+
+	// PeerCertificates summarizes the certificates sent by the server,
+	// starting with its own.
+	PeerCertificates []CertificateInfo
+}
+
+// CertificateInfo represents the summary of a certificate.
+type CertificateInfo struct {
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	DNSNames     []string
+	NotBefore    time.Time
+	NotAfter     time.Time
+
+	// Pin is the SPKI pin of the certificate, see CertificatePin.
+	Pin string
+}
+
+func newTLSInfo(cs *tls.ConnectionState) *TLSInfo {
+	info := &TLSInfo{
+		Version:            cs.Version,
+		CipherSuite:        cs.CipherSuite,
+		NegotiatedProtocol: cs.NegotiatedProtocol,
+		ServerName:         cs.ServerName,
+		DidResume:          cs.DidResume,
+	}
+	for _, cert := range cs.PeerCertificates {
+		info.PeerCertificates = append(info.PeerCertificates, CertificateInfo{
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			SerialNumber: cert.SerialNumber.String(),
+			DNSNames:     cert.DNSNames,
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			Pin:          CertificatePin(cert),
+		})
+	}
+	return info
 }
 
 type clientTrace struct {
@@ -120,11 +231,117 @@ type clientTrace struct {
 	gotFirstResponseByte time.Time
 	endTime              time.Time
 	gotConnInfo          httptrace.GotConnInfo
+	echAccepted          bool
+	tlsState             *tls.ConnectionState
+
+	mu        sync.Mutex // guards proxyHops and tlsState, which are set while dialing
+	proxyHops []ProxyHopInfo
+}
+
+// info returns the trace information of the request started at startTime
+// and completed at endTime.
+func (ct *clientTrace) info(startTime, endTime time.Time) TraceInfo {
+	ti := TraceInfo{
+		IsConnReused:  ct.gotConnInfo.Reused,
+		IsConnWasIdle: ct.gotConnInfo.WasIdle,
+		ConnIdleTime:  ct.gotConnInfo.IdleTime,
+		ECHAccepted:   ct.echAccepted,
+	}
+
+	if !ct.tlsHandshakeStart.IsZero() {
+		if !ct.tlsHandshakeDone.IsZero() {
+			ti.TLSHandshakeTime = ct.tlsHandshakeDone.Sub(ct.tlsHandshakeStart)
+		} else {
+			ti.TLSHandshakeTime = endTime.Sub(ct.tlsHandshakeStart)
+		}
+	}
+
+	if ct.gotConnInfo.Reused {
+		ti.TotalTime = endTime.Sub(ct.getConn)
+	} else {
+		if ct.dnsStart.IsZero() {
+			ti.TotalTime = endTime.Sub(startTime)
+		} else {
+			ti.TotalTime = endTime.Sub(ct.dnsStart)
+		}
+	}
+
+	dnsDone := ct.dnsDone
+	if dnsDone.IsZero() {
+		dnsDone = endTime
+	}
+
+	if !ct.dnsStart.IsZero() {
+		ti.DNSLookupTime = dnsDone.Sub(ct.dnsStart)
+	}
+
+	// Only calculate on successful connections
+	if !ct.connectDone.IsZero() {
+		ti.TCPConnectTime = ct.connectDone.Sub(dnsDone)
+	}
+
+	// Only calculate on successful connections
+	if !ct.gotConn.IsZero() {
+		ti.ConnectTime = ct.gotConn.Sub(ct.getConn)
+	}
+
+	// Only calculate on successful connections
+	if !ct.gotFirstResponseByte.IsZero() {
+		ti.FirstResponseTime = ct.gotFirstResponseByte.Sub(ct.gotConn)
+		ti.ResponseTime = endTime.Sub(ct.gotFirstResponseByte)
+	}
+
+	// Capture remote address info when connection is non-nil
+	if ct.gotConnInfo.Conn != nil {
+		ti.RemoteAddr = ct.gotConnInfo.Conn.RemoteAddr()
+		ti.LocalAddr = ct.gotConnInfo.Conn.LocalAddr()
+	}
+
+	ct.mu.Lock()
+	if ct.tlsState != nil {
+		ti.TLS = newTLSInfo(ct.tlsState)
+	}
+	ti.ProxyHops = ct.proxyHops
+	ct.mu.Unlock()
+
+	return ti
+}
+
+type clientTraceKeyType int
+
+const clientTraceKey clientTraceKeyType = iota
+
+// traceProxyHop records the proxy hop in the client trace of ctx, if any.
+func traceProxyHop(ctx context.Context, proxyURL *url.URL, target string, start time.Time, err error) {
+	t, ok := ctx.Value(clientTraceKey).(*clientTrace)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	t.proxyHops = append(t.proxyHops, ProxyHopInfo{
+		Proxy:       proxyURL.Redacted(),
+		Target:      target,
+		ConnectTime: time.Since(start),
+		Err:         err,
+	})
+	t.mu.Unlock()
+}
+
+// traceTLSState records the state of the TLS connection to the target host
+// in the client trace of ctx, if any, the handshakes with proxies are not.
+func traceTLSState(ctx context.Context, cs tls.ConnectionState) {
+	t, ok := ctx.Value(clientTraceKey).(*clientTrace)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	t.tlsState = &cs
+	t.mu.Unlock()
 }
 
 func (t *clientTrace) createContext(ctx context.Context) context.Context {
 	return httptrace.WithClientTrace(
-		ctx,
+		context.WithValue(ctx, clientTraceKey, t),
 		&httptrace.ClientTrace{
 			DNSStart: func(_ httptrace.DNSStartInfo) {
 				t.dnsStart = time.Now()
@@ -145,6 +362,10 @@ func (t *clientTrace) createContext(ctx context.Context) context.Context {
 			},
 			GetConn: func(_ string) {
 				t.getConn = time.Now()
+				t.mu.Lock()
+				t.tlsState = nil
+				t.proxyHops = nil
+				t.mu.Unlock()
 			},
 			GotConn: func(ci httptrace.GotConnInfo) {
 				t.gotConn = time.Now()
@@ -156,8 +377,9 @@ func (t *clientTrace) createContext(ctx context.Context) context.Context {
 			TLSHandshakeStart: func() {
 				t.tlsHandshakeStart = time.Now()
 			},
-			TLSHandshakeDone: func(_ tls.ConnectionState, _ error) {
+			TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
 				t.tlsHandshakeDone = time.Now()
+				t.echAccepted = cs.ECHAccepted
 			},
 		},
 	)
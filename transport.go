@@ -19,16 +19,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"mime"
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/netip"
 	"net/textproto"
 	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	_ "unsafe"
 
@@ -133,11 +136,46 @@ type Transport struct {
 	// fail-closed static host mapping installed by Client.SetHosts.
 	rejectProxyWithSetHosts bool
 
+	// http2Proxy, if true, offers HTTP/2 to https proxies and multiplexes
+	// CONNECT tunnels over a single proxy connection when it is negotiated.
+	http2Proxy     bool
+	proxyChain     []*url.URL // see SetProxyChain
+	proxyTunnels   *proxyTunnelPool
+	proxyTunnelsMu sync.Mutex
+
 	transport.Options
 
 	t2 *h2internal.Transport // non-nil if http2 wired up
 	t3 *http3.Transport
 
+	// see SetHTTP3Settings, SetHTTP3PseudoHeaderOrder and SetQUICParameters
+	http3Settings          []HTTP3Setting
+	http3PseudoHeaderOrder []string
+	quicParams             *QUICParameters
+
+	echLookup   ECHConfigLookupFunc // see SetECHConfigLookup
+	echCache    *echConfigCache     // see EnableECHFromDNS
+	echRequired bool                // see EnableECHRequired
+	certPins    map[string][]string // SPKI SHA-256 hashes by host, see Client.SetCertificatePins
+
+	revocation *revocationChecker // see EnableRevocationCheck
+
+	// see SetResolver, SetIPPreference and Client.SetResolveOverride
+	resolver         Resolver
+	ipPreference     IPPreference
+	resolveOverrides map[string][]netip.Addr
+	resolverDial     bool // DialContext is dialResolved
+	// innerDial is the dialer of SetDial, which dials the addresses
+	// resolved by dialResolved.
+	innerDial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	metrics       Metrics          // see SetMetrics
+	connEventHook func(*ConnEvent) // see SetConnEventHook
+	connStats     connStats
+	harRecorder   *HARRecorder   // see SetHARRecorder
+	cassette      *Cassette      // see SetCassette
+	faultInjector *FaultInjector // see SetFaultInjector
+
 	// disableAutoDecode, if true, prevents auto detect response
 	// body's charset and decode it to utf-8
 	disableAutoDecode bool
@@ -168,6 +206,8 @@ func T() *Transport {
 		},
 	}
 	t.t2 = &h2internal.Transport{Options: &t.Options}
+	t.connStats.t = t
+	t.ConnStateHook = t.connStats.observe
 	return t
 }
 
@@ -210,7 +250,7 @@ func (t *Transport) WrapRoundTrip(wrappers ...HttpRoundTripWrapper) *Transport {
 	if t.wrappedRoundTrip == nil {
 		t.httpRoundTripWrappers = wrappers
 		fn := func(req *http.Request) (*http.Response, error) {
-			return t.roundTrip(req)
+			return t.roundTripCassette(req)
 		}
 		t.wrappedRoundTrip = HttpRoundTripFunc(fn)
 	} else {
@@ -460,16 +500,20 @@ func (t *Transport) SetDebug(debugf func(format string, v ...any)) *Transport {
 	return t
 }
 
-// SetProxy set the http proxy, only valid for HTTP1 and HTTP2, which specifies a function
+// SetProxy set the http proxy, only valid for HTTP1 and HTTP2 except for SOCKS5
+// proxies which also carry HTTP3 through UDP ASSOCIATE, which specifies a function
 // to return a proxy for a given Request. If the function returns a non-nil error, the request
 // is aborted with the provided error.
 //
 // The proxy type is determined by the URL scheme. "http",
-// "https", "socks5", "socks5h", "socks4", and "socks4a" are
+// "https", "quic", "socks5", "socks5h", "socks4", and "socks4a" are
 // supported. If the scheme is empty, "http" is assumed.
 // "socks5" is treated the same as "socks5h".
 // "socks4" resolves domain names locally to IPv4; "socks4a" lets the
 // proxy resolve domain names. SOCKS4 only supports IPv4 destinations.
+// "quic" is an HTTP/3 proxy, tunnels are opened as CONNECT streams of
+// a single QUIC connection to the proxy. See EnableHTTP2Proxy to do the
+// same with HTTP/2 for "https" proxies.
 //
 // If Proxy is nil or returns a nil *URL, no proxy is used.
 func (t *Transport) SetProxy(proxy func(*http.Request) (*url.URL, error)) *Transport {
@@ -477,6 +521,14 @@ func (t *Transport) SetProxy(proxy func(*http.Request) (*url.URL, error)) *Trans
 	return t
 }
 
+// SetProxyPool picks the proxy of each request from the pool, and reports
+// proxy connect errors to the pool so failing proxies are ejected.
+func (t *Transport) SetProxyPool(pool *ProxyPool) *Transport {
+	t.Proxy = pool.Proxy
+	t.OnProxyConnectDone = pool.onProxyConnectDone
+	return t
+}
+
 // SetDial set the custom DialContext function, only valid for HTTP1 and HTTP2, which specifies the
 // dial function for creating unencrypted TCP connections.
 // If it is nil, then the transport dials using package net.
@@ -484,8 +536,14 @@ func (t *Transport) SetProxy(proxy func(*http.Request) (*url.URL, error)) *Trans
 // The dial function runs concurrently with calls to RoundTrip.
 // A RoundTrip call that initiates a dial may end up using a connection dialed previously when the
 // earlier connection becomes idle before the later dial function completes.
+//
+// If the host names are resolved by the transport (see SetResolver, SetIPPreference and
+// Client.SetResolveOverride), the dial function dials the resolved addresses.
 func (t *Transport) SetDial(fn func(ctx context.Context, network, addr string) (net.Conn, error)) *Transport {
-	t.DialContext = fn
+	t.innerDial = fn
+	if !t.resolverDial {
+		t.DialContext = fn
+	}
 	t.rejectProxyWithSetHosts = false
 	return t
 }
@@ -511,12 +569,30 @@ func (t *Transport) SetTLSHandshake(fn func(ctx context.Context, addr string, pl
 	return t
 }
 
+// EnableHTTP2Proxy enables HTTP/2 for "https" proxies (disabled by default).
+// HTTP/2 is offered to the proxy during the TLS handshake, and if the proxy
+// accepts it, CONNECT tunnels to https targets are multiplexed as streams over
+// a single proxy connection instead of opening one TCP connection per target.
+// Proxies that only speak HTTP/1.1 keep working as before.
+func (t *Transport) EnableHTTP2Proxy() *Transport {
+	t.http2Proxy = true
+	return t
+}
+
+// DisableHTTP2Proxy disables HTTP/2 for "https" proxies, every CONNECT
+// tunnel uses its own HTTP/1.1 connection to the proxy.
+func (t *Transport) DisableHTTP2Proxy() *Transport {
+	t.http2Proxy = false
+	return t
+}
+
 type pendingAltSvc struct {
 	CurrentIndex int
 	Entries      []*altsvc.AltSvc
 	Mu           sync.Mutex
 	LastTime     time.Time
 	Transport    http.RoundTripper
+	ProxyURL     *url.URL // the proxy the HTTP/3 connection is dialed through
 }
 
 // EnableForceHTTP1 enable force using HTTP1 (disabled by default).
@@ -595,9 +671,13 @@ func (t *Transport) EnableHTTP3() {
 		t.pendingAltSvcs = make(map[string]*pendingAltSvc)
 	}
 	t3 := &http3.Transport{
-		Options: &t.Options,
+		Options:          &t.Options,
+		ProxyPacketConn:  t.socksPacketConn,
+		VerifyConnection: t.verifyConnection,
+		LookupNetIP:      t.lookupHTTP3,
 	}
 	t.t3 = t3
+	t.applyHTTP3Fingerprint()
 }
 
 type wrapResponseBodyKeyType int
@@ -631,6 +711,10 @@ func (t *Transport) handleAltSvc(req *http.Request, value string) {
 	if ok {
 		return
 	}
+	proxyURL, ok := t.altSvcProxy(req)
+	if !ok {
+		return
+	}
 	ass, err := altsvcutil.ParseHeader(value)
 	if err != nil {
 		if t.Debugf != nil {
@@ -646,20 +730,34 @@ func (t *Transport) handleAltSvc(req *http.Request, value string) {
 	}
 	if len(entries) > 0 {
 		pas := &pendingAltSvc{
-			Entries: entries,
+			Entries:  entries,
+			ProxyURL: proxyURL,
 		}
 		t.pendingAltSvcs[addr] = pas
 		go t.handlePendingAltSvc(req.URL, pas)
 	}
 }
 
+// altSvcProxy returns the proxy of req, and whether HTTP/3 alternative
+// services can be used through it, only SOCKS5 proxies relay UDP.
+func (t *Transport) altSvcProxy(req *http.Request) (*url.URL, bool) {
+	if t.Proxy == nil {
+		return nil, true
+	}
+	proxyURL, err := t.Proxy(req)
+	if err != nil {
+		return nil, false
+	}
+	return proxyURL, proxyURL == nil || proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h"
+}
+
 func (t *Transport) handlePendingAltSvc(u *url.URL, pas *pendingAltSvc) {
 	for i := pas.CurrentIndex; i < len(pas.Entries); i++ {
 		switch pas.Entries[i].Protocol {
 		case "h3": // only support h3 in alt-svc for now
 			u2 := altsvcutil.ConvertURL(pas.Entries[i], u)
 			hostname := u2.Host
-			err := t.t3.AddConn(context.Background(), hostname)
+			err := t.t3.AddConn(context.Background(), hostname, pas.ProxyURL)
 			if err != nil {
 				if t.Debugf != nil {
 					t.Debugf("failed to get http3 connection: %s", err.Error())
@@ -755,11 +853,43 @@ func (t *Transport) Clone() *Transport {
 		autoDecodeContentType:   t.autoDecodeContentType,
 		forceHttpVersion:        t.forceHttpVersion,
 		rejectProxyWithSetHosts: t.rejectProxyWithSetHosts,
+		http2Proxy:              t.http2Proxy,
+		proxyChain:              t.proxyChain,
+		http3Settings:           cloneSlice(t.http3Settings),
+		http3PseudoHeaderOrder:  cloneSlice(t.http3PseudoHeaderOrder),
+		quicParams:              t.quicParams,
+		echLookup:               t.echLookup,
+		echCache:                t.echCache,
+		echRequired:             t.echRequired,
+		certPins:                maps.Clone(t.certPins),
+		resolver:                t.resolver,
+		ipPreference:            t.ipPreference,
+		resolveOverrides:        maps.Clone(t.resolveOverrides),
+		metrics:                 t.metrics,
+		connEventHook:           t.connEventHook,
+		harRecorder:             t.harRecorder,
+		cassette:                t.cassette,
+		faultInjector:           t.faultInjector,
 		httpRoundTripWrappers:   t.httpRoundTripWrappers,
 	}
+	tt.connStats.t = tt
+	tt.ConnStateHook = tt.connStats.observe
+	if tt.TLSClientConfig != nil {
+		if w, ok := tt.TLSClientConfig.KeyLogWriter.(*keyLogFile); ok {
+			w.retain()
+		}
+	}
+	if t.revocation != nil {
+		tt.revocation = newRevocationChecker(&t.revocation.opts, tt.roundTrip)
+	}
+	if t.resolverDial {
+		tt.innerDial = t.innerDial
+		tt.resolverDial = true
+		tt.DialContext = tt.dialResolved
+	}
 	if len(tt.httpRoundTripWrappers) > 0 { // clone transport middleware
 		fn := func(req *http.Request) (*http.Response, error) {
-			return tt.roundTrip(req)
+			return tt.roundTripCassette(req)
 		}
 		tt.wrappedRoundTrip = HttpRoundTripFunc(fn)
 		for _, w := range tt.httpRoundTripWrappers {
@@ -1231,6 +1361,12 @@ func (t *Transport) CloseIdleConnections() {
 	if t2 := t.t2; t2 != nil {
 		t2.CloseIdleConnections()
 	}
+	t.proxyTunnelsMu.Lock()
+	proxyTunnels := t.proxyTunnels
+	t.proxyTunnelsMu.Unlock()
+	if proxyTunnels != nil {
+		proxyTunnels.closeIdleConnections()
+	}
 }
 
 // prepareTransportCancel sets up state to convert Transport.CancelRequest into context cancellation.
@@ -1388,6 +1524,7 @@ func (t *Transport) tryPutIdleConn(pconn *persistConn) error {
 			for q.len() > 0 {
 				w := q.popFront()
 				if w.tryDeliver(pconn, nil, time.Time{}) {
+					pconn.setConnReused()
 					done = true
 					break
 				}
@@ -1429,6 +1566,7 @@ func (t *Transport) tryPutIdleConn(pconn *persistConn) error {
 	}
 	t.idleConn[key] = append(idles, pconn)
 	t.idleLRU.add(pconn)
+	pconn.setConnState(transport.ConnIdle, nil)
 	if t.MaxIdleConns != 0 && t.idleLRU.len() > t.MaxIdleConns {
 		oldest := t.idleLRU.removeOldest()
 		oldest.close(errTooManyIdle)
@@ -1513,6 +1651,7 @@ func (t *Transport) queueForIdleConn(w *wantConn) (delivered bool) {
 					// Remove it from the list.
 					t.idleLRU.remove(pconn)
 					list = list[:len(list)-1]
+					pconn.setConnState(transport.ConnActive, nil)
 				}
 			}
 			stop = true
@@ -1984,6 +2123,28 @@ func (pc *persistConn) addTLS(ctx context.Context, name string, trace *httptrace
 	if pc.cacheKey.onlyH1 {
 		cfg.NextProtos = nil
 	}
+	if forProxy {
+		// HTTP/2 is only spoken to the proxy if CONNECT tunnels can be
+		// multiplexed over it, plain http targets are forwarded over HTTP/1.1.
+		if pc.t.http2Proxy && pc.cacheKey.scheme == "https" {
+			cfg.NextProtos = []string{h2internal.NextProtoTLS, "http/1.1"}
+		} else {
+			cfg.NextProtos = nil
+		}
+		// The ECH configuration is the one of the target host.
+		cfg.EncryptedClientHelloConfigList = nil
+	} else {
+		list, err := pc.t.echConfigList(ctx, cfg, cfg.ServerName)
+		if err != nil {
+			pc.conn.Close()
+			return err
+		}
+		cfg.EncryptedClientHelloConfigList = list
+		if list != nil && cfg.MinVersion != 0 && cfg.MinVersion < tls.VersionTLS13 {
+			cfg.MinVersion = tls.VersionTLS13
+		}
+	}
+	cfg.VerifyConnection = pc.t.wrapVerifyConnection(ctx, cfg.VerifyConnection, cfg.ServerName)
 	plainConn := pc.conn
 	tlsConn := tls.Client(plainConn, cfg)
 	errc := make(chan error, 2)
@@ -2019,6 +2180,9 @@ func (pc *persistConn) addTLS(ctx context.Context, name string, trace *httptrace
 	if trace != nil && trace.TLSHandshakeDone != nil {
 		trace.TLSHandshakeDone(cs, nil)
 	}
+	if !forProxy {
+		traceTLSState(ctx, cs)
+	}
 	pc.tlsState = &cs
 	pc.conn = tlsConn
 	if !forProxy && pc.t.forceHttpVersion == h2 && cs.NegotiatedProtocol != h2internal.NextProtoTLS {
@@ -2061,6 +2225,7 @@ func (t *Transport) customTlsHandshake(ctx context.Context, trace *httptrace.Cli
 			if trace != nil && trace.TLSHandshakeDone != nil {
 				trace.TLSHandshakeDone(*tlsState, nil)
 			}
+			traceTLSState(ctx, *tlsState)
 		}
 		errc <- err
 	}()
@@ -2091,7 +2256,51 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		}
 		return err
 	}
-	if cm.scheme() == "https" && t.hasCustomTLSDialer() {
+	proxyConnected := false
+	if cm.proxyURL != nil && t.OnProxyConnectDone != nil {
+		defer func() {
+			if !proxyConnected {
+				t.OnProxyConnectDone(ctx, cm.proxyURL, err)
+			}
+		}()
+	}
+
+	// chain holds the proxies to go through before the proxy of cm, see
+	// SetProxyChain.
+	var chain []*url.URL
+	if cm.proxyURL != nil {
+		chain = t.proxyChainHops(cm.proxyURL)
+	}
+
+	// tunnelled reports whether pconn.conn is a CONNECT stream of a
+	// multiplexed (HTTP/2 or HTTP/3) proxy connection.
+	var tunnelled bool
+	if cm.proxyURL != nil {
+		switch {
+		case cm.proxyURL.Scheme == "quic" && len(chain) > 0:
+			return nil, wrapErr(errProxyChainUDP)
+		case cm.proxyURL.Scheme == "quic":
+			conn, err := t.dialHTTP3ProxyTunnel(ctx, cm)
+			if err != nil {
+				return nil, wrapErr(err)
+			}
+			pconn.conn = conn
+			tunnelled = true
+		case cm.proxyURL.Scheme == "https" && t.http2Proxy && cm.targetScheme == "https":
+			if cc := t.getProxyTunnelPool().cachedHTTP2Conn(cm.proxyURL); cc != nil {
+				conn, err := t.dialHTTP2ProxyTunnel(ctx, cm, cc)
+				if err != nil {
+					return nil, wrapErr(err)
+				}
+				pconn.conn = conn
+				tunnelled = true
+			}
+		}
+	}
+
+	if tunnelled {
+		// The tunnel is already established.
+	} else if cm.scheme() == "https" && t.hasCustomTLSDialer() && len(chain) == 0 {
 		var err error
 		pconn.conn, err = t.customDialTLS(ctx, "tcp", cm.addr())
 		if err != nil {
@@ -2114,13 +2323,23 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 			if trace != nil && trace.TLSHandshakeDone != nil {
 				trace.TLSHandshakeDone(cs, nil)
 			}
+			traceTLSState(ctx, cs)
 			pconn.tlsState = &cs
 			if cm.proxyURL == nil && pconn.t.forceHttpVersion == h2 && cs.NegotiatedProtocol != h2internal.NextProtoTLS {
 				return nil, newHttp2NotSupportedError(cs.NegotiatedProtocol)
 			}
 		}
+		if err := t.verifyDialTLSConnection(ctx, cm.tlsHost(), pconn.conn); err != nil {
+			go pconn.conn.Close()
+			return nil, err
+		}
 	} else {
-		conn, err := t.dial(ctx, "tcp", cm.addr())
+		var conn net.Conn
+		if len(chain) > 0 {
+			conn, err = t.dialProxyChain(ctx, chain, cm.proxyURL)
+		} else {
+			conn, err = t.dial(ctx, "tcp", cm.addr())
+		}
 		if err != nil {
 			return nil, wrapErr(err)
 		}
@@ -2147,126 +2366,48 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		t.Debugf("connect %s via proxy %s", cm.targetAddr, cm.proxyURL.String())
 	}
 
+	if cm.proxyURL != nil && cm.proxyURL.Scheme == "https" && !tunnelled &&
+		pconn.tlsState != nil && pconn.tlsState.NegotiatedProtocol == h2internal.NextProtoTLS {
+		cc, err := t.getProxyTunnelPool().addHTTP2Conn(cm.proxyURL, pconn.conn)
+		if err != nil {
+			pconn.conn.Close()
+			return nil, wrapErr(err)
+		}
+		conn, err := t.dialHTTP2ProxyTunnel(ctx, cm, cc)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		pconn.conn = conn
+		pconn.tlsState = nil
+		tunnelled = true
+	}
+
 	// Proxy setup.
 	switch {
 	case cm.proxyURL == nil:
 		// Do nothing. Not using a proxy.
-	case cm.proxyURL.Scheme == "socks5" || cm.proxyURL.Scheme == "socks5h":
-		conn := pconn.conn
-		d := socks.NewDialer("tcp", conn.RemoteAddr().String())
-		if u := cm.proxyURL.User; u != nil {
-			auth := &socks.UsernamePassword{
-				Username: u.Username(),
-			}
-			auth.Password, _ = u.Password()
-			d.AuthMethods = []socks.AuthMethod{
-				socks.AuthMethodNotRequired,
-				socks.AuthMethodUsernamePassword,
-			}
-			d.Authenticate = auth.Authenticate
-		}
-		if _, err := d.DialWithConn(ctx, conn, "tcp", cm.targetAddr); err != nil {
-			conn.Close()
-			return nil, err
-		}
-	case cm.proxyURL.Scheme == "socks4" || cm.proxyURL.Scheme == "socks4a":
-		conn := pconn.conn
-		d := socks.NewDialer("tcp", conn.RemoteAddr().String())
-		d.Version = socks.Version4
-		d.Socks4A = cm.proxyURL.Scheme == "socks4a"
-		if u := cm.proxyURL.User; u != nil {
-			d.UserID = u.Username()
-		}
-		if _, err := d.DialWithConn(ctx, conn, "tcp", cm.targetAddr); err != nil {
-			conn.Close()
-			return nil, err
-		}
-	case cm.targetScheme == "http":
+	case tunnelled:
+		// Do nothing. The CONNECT stream is already established.
+	case cm.targetScheme == "http" && !isSocksProxy(cm.proxyURL):
 		pconn.isProxy = true
 		if pa := cm.proxyAuth(); pa != "" {
 			pconn.mutateHeaderFunc = func(h http.Header) {
 				h.Set("Proxy-Authorization", pa)
 			}
 		}
-	case cm.targetScheme == "https":
-		conn := pconn.conn
-		var hdr http.Header
-		if t.GetProxyConnectHeader != nil {
-			var err error
-			hdr, err = t.GetProxyConnectHeader(ctx, cm.proxyURL, cm.targetAddr)
-			if err != nil {
-				conn.Close()
-				return nil, err
-			}
-		} else {
-			hdr = t.ProxyConnectHeader
-		}
-		if hdr == nil {
-			hdr = make(http.Header)
-		}
-		if pa := cm.proxyAuth(); pa != "" {
-			hdr = hdr.Clone()
-			hdr.Set("Proxy-Authorization", pa)
-		}
-		connectReq := &http.Request{
-			Method: "CONNECT",
-			URL:    &url.URL{Opaque: cm.targetAddr},
-			Host:   cm.targetAddr,
-			Header: hdr,
-		}
-
-		// Set a (long) timeout here to make sure we don't block forever
-		// and leak a goroutine if the connection stops replying after
-		// the TCP connect.
-		connectCtx, cancel := testHookProxyConnectTimeout(ctx, 1*time.Minute)
-		defer cancel()
-
-		didReadResponse := make(chan struct{}) // closed after CONNECT write+read is done or fails
-		var (
-			resp *http.Response
-			err  error // write or read error
-		)
-		// Write the CONNECT request & read the response.
-		go func() {
-			defer close(didReadResponse)
-			err = connectReq.Write(conn)
-			if err != nil {
-				return
-			}
-			// Okay to use and discard buffered reader here, because
-			// TLS server will not speak until spoken to.
-			br := bufio.NewReader(conn)
-			resp, err = http.ReadResponse(br, connectReq)
-		}()
-		select {
-		case <-connectCtx.Done():
-			conn.Close()
-			<-didReadResponse
-			return nil, connectCtx.Err()
-		case <-didReadResponse:
-			// resp or err now set
-		}
+	default:
+		start := time.Now()
+		err := t.connectThroughProxy(ctx, pconn.conn, cm)
+		traceProxyHop(ctx, cm.proxyURL, cm.targetAddr, start, err)
 		if err != nil {
-			conn.Close()
+			pconn.conn.Close()
 			return nil, err
 		}
+	}
 
-		if t.OnProxyConnectResponse != nil {
-			err = t.OnProxyConnectResponse(ctx, cm.proxyURL, connectReq, resp)
-			if err != nil {
-				conn.Close()
-				return nil, err
-			}
-		}
-
-		if resp.StatusCode != 200 {
-			_, text, ok := util.CutString(resp.Status, " ")
-			conn.Close()
-			if !ok {
-				return nil, errors.New("unknown status code")
-			}
-			return nil, errors.New(text)
-		}
+	if cm.proxyURL != nil && t.OnProxyConnectDone != nil {
+		proxyConnected = true
+		t.OnProxyConnectDone(ctx, cm.proxyURL, nil)
 	}
 
 	if cm.proxyURL != nil && cm.targetScheme == "https" {
@@ -2299,9 +2440,120 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 
 	go pconn.readLoop()
 	go pconn.writeLoop()
+	pconn.setConnState(transport.ConnActive, nil)
 	return pconn, nil
 }
 
+// connectThroughProxy asks the proxy of cm, which conn is connected to,
+// to open a tunnel to cm.targetAddr: a SOCKS command for SOCKS proxies, a
+// CONNECT request otherwise.
+func (t *Transport) connectThroughProxy(ctx context.Context, conn net.Conn, cm connectMethod) (err error) {
+	switch cm.proxyURL.Scheme {
+	case "socks5", "socks5h":
+		d := t.socks5Dialer(cm.proxyURL)
+		_, err := d.DialWithConn(ctx, conn, "tcp", cm.targetAddr)
+		return err
+	case "socks4", "socks4a":
+		d := socks.NewDialer("tcp", conn.RemoteAddr().String())
+		d.Version = socks.Version4
+		d.Socks4A = cm.proxyURL.Scheme == "socks4a"
+		if u := cm.proxyURL.User; u != nil {
+			d.UserID = u.Username()
+		}
+		_, err := d.DialWithConn(ctx, conn, "tcp", cm.targetAddr)
+		return err
+	}
+
+	connectReq := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: cm.targetAddr},
+		Host:   cm.targetAddr,
+	}
+	_, err = t.roundTripConnect(ctx, cm, connectReq, func(req *http.Request) (*http.Response, error) {
+		if err := req.Write(conn); err != nil {
+			return nil, err
+		}
+		// Okay to use and discard buffered reader here, because
+		// TLS server will not speak until spoken to.
+		br := bufio.NewReader(conn)
+		return http.ReadResponse(br, req)
+	}, func() { conn.Close() })
+	return err
+}
+
+// roundTripConnect sends connectReq, the CONNECT request to the proxy of
+// cm, with roundTrip and returns the response of the proxy if the tunnel
+// is established. The headers of connectReq are set by proxyConnectHeader,
+// abort is called to break the connection to the proxy on failure.
+func (t *Transport) roundTripConnect(ctx context.Context, cm connectMethod, connectReq *http.Request, roundTrip func(*http.Request) (*http.Response, error), abort func()) (*http.Response, error) {
+	hdr, err := t.proxyConnectHeader(ctx, cm)
+	if err != nil {
+		abort()
+		return nil, err
+	}
+	connectReq.Header = hdr
+
+	// Set a (long) timeout here to make sure we don't block forever
+	// and leak a goroutine if the connection stops replying after
+	// the TCP connect.
+	connectCtx, cancel := testHookProxyConnectTimeout(ctx, 1*time.Minute)
+	defer cancel()
+
+	didReadResponse := make(chan struct{}) // closed after CONNECT write+read is done or fails
+	// resp and err (write or read error) are set by the goroutine below.
+	var resp *http.Response
+	// Write the CONNECT request & read the response.
+	go func() {
+		defer close(didReadResponse)
+		resp, err = roundTrip(connectReq)
+	}()
+	select {
+	case <-connectCtx.Done():
+		abort()
+		<-didReadResponse
+		return nil, connectCtx.Err()
+	case <-didReadResponse:
+		// resp or err now set
+	}
+	if err != nil {
+		abort()
+		return nil, err
+	}
+	fail := func(err error) (*http.Response, error) {
+		abort()
+		resp.Body.Close()
+		return nil, err
+	}
+
+	if t.OnProxyConnectResponse != nil {
+		// The request is passed as it is sent to an HTTP/1 proxy, whatever
+		// the protocol spoken with the proxy.
+		hookReq := connectReq.WithContext(connectReq.Context())
+		hookReq.URL = &url.URL{Opaque: cm.targetAddr}
+		err = t.OnProxyConnectResponse(ctx, cm.proxyURL, hookReq, resp)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	if resp.StatusCode != 200 {
+		_, text, ok := util.CutString(resp.Status, " ")
+		if !ok {
+			return fail(errors.New("unknown status code"))
+		}
+		return fail(errors.New(text))
+	}
+	return resp, nil
+}
+
+func isSocksProxy(proxyURL *url.URL) bool {
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h", "socks4", "socks4a":
+		return true
+	}
+	return false
+}
+
 // persistConnWriter is the io.Writer written to by pc.bw.
 // It accumulates the number of bytes written to the underlying conn,
 // so the retry logic can determine whether any bytes made it across
@@ -2347,6 +2599,7 @@ var _ io.ReaderFrom = (*persistConnWriter)(nil)
 //	socks4a://proxy.com|https|foo.com socks4a to proxy, then https to foo.com
 //	https://proxy.com|https|foo.com   https to proxy, then CONNECT to foo.com
 //	https://proxy.com|http            https to proxy, http to anywhere after that
+//	quic://proxy.com|https|foo.com    http3 to proxy, then CONNECT to foo.com
 type connectMethod struct {
 	_            incomparable
 	proxyURL     *url.URL // nil for no proxy, else full proxy URL
@@ -2375,7 +2628,7 @@ func (cm *connectMethod) key() connectMethodKey {
 	}
 }
 
-// scheme returns the first hop scheme: http, https, socks5, socks5h, socks4, or socks4a
+// scheme returns the first hop scheme: http, https, quic, socks5, socks5h, socks4, or socks4a
 func (cm *connectMethod) scheme() string {
 	if cm.proxyURL != nil {
 		return cm.proxyURL.Scheme
@@ -2451,6 +2704,8 @@ type persistConn struct {
 	idleAt    time.Time   // time it last become idle
 	idleTimer *time.Timer // holding an AfterFunc to close it
 
+	connState atomic.Uint32 // transport.ConnState, see setConnState
+
 	mu                   sync.Mutex // guards following fields
 	numExpectedResponses int
 	closed               error // set non-nil when conn is closed, before closech is closed
@@ -3555,6 +3810,60 @@ func (tr *transportRequest) logf(format string, args ...any) {
 	}
 }
 
+// setConnState reports the change of the state of the HTTP/1 connection pc
+// to the ConnStateHook, err is the reason it is closed. Connections which
+// were never opened are not reported, and closed connections stay closed.
+func (pc *persistConn) setConnState(state transport.ConnState, err error) {
+	if pc.alt != nil {
+		return
+	}
+	for {
+		old := transport.ConnState(pc.connState.Load())
+		if old == state || old == transport.ConnClosed {
+			return
+		}
+		if !pc.connState.CompareAndSwap(uint32(old), uint32(state)) {
+			continue
+		}
+		if hook := pc.t.ConnStateHook; hook != nil && !(old == transport.ConnNew && state == transport.ConnClosed) {
+			hook(&transport.ConnStateChange{
+				Addr:    pc.cacheKey.addr,
+				Proto:   "HTTP/1.1",
+				From:    old,
+				To:      state,
+				Reused:  old == transport.ConnIdle && state == transport.ConnActive,
+				Err:     err,
+				Evicted: isEvictionError(err),
+			})
+		}
+		return
+	}
+}
+
+// setConnReused reports to the ConnStateHook that the active HTTP/1
+// connection pc is handed to another request without becoming idle.
+func (pc *persistConn) setConnReused() {
+	if hook := pc.t.ConnStateHook; hook != nil && pc.alt == nil && transport.ConnState(pc.connState.Load()) == transport.ConnActive {
+		hook(&transport.ConnStateChange{
+			Addr:   pc.cacheKey.addr,
+			Proto:  "HTTP/1.1",
+			From:   transport.ConnActive,
+			To:     transport.ConnActive,
+			Reused: true,
+		})
+	}
+}
+
+// isEvictionError reports whether err is the reason of a connection
+// closed by the pool.
+func isEvictionError(err error) bool {
+	switch err {
+	case errCloseIdle, errTooManyIdle, errTooManyIdleHost, errCloseIdleConns, errIdleConnTimeout:
+		return true
+	}
+	return false
+}
+
 // markReused marks this connection as having been successfully used for a
 // request and response.
 func (pc *persistConn) markReused() {
@@ -3582,6 +3891,7 @@ func (pc *persistConn) closeLocked(err error) {
 	if pc.closed == nil {
 		pc.closed = err
 		pc.t.decConnsPerHost(pc.cacheKey)
+		pc.setConnState(transport.ConnClosed, err)
 		// Close HTTP/1 (pc.alt == nil) connection.
 		// HTTP/2 closes its connection itself.
 		if pc.alt == nil {
@@ -3597,6 +3907,7 @@ func (pc *persistConn) closeLocked(err error) {
 var portMap = map[string]string{
 	"http":    "80",
 	"https":   "443",
+	"quic":    "443",
 	"socks5":  "1080",
 	"socks5h": "1080",
 	"socks4":  "1080",